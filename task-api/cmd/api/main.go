@@ -1,59 +1,349 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
+    "errors"
+    "flag"
     "fmt"
     "log"
+    "log/slog"
     "net/http"
+    "os"
+    "os/signal"
+    "syscall"
+    "task-api/internal/audit"
+    "task-api/internal/auth"
+    "task-api/internal/config"
+    "task-api/internal/events"
     "task-api/internal/external"
     "task-api/internal/handlers"
+    "task-api/internal/health"
+    "task-api/internal/metrics"
     "task-api/internal/middleware"
     "task-api/internal/models"
+    "task-api/internal/ratelimit"
+    "task-api/internal/recurrence"
     "task-api/internal/storage"
+    "task-api/internal/webhooks"
+    "time"
 )
 
 func main() {
-    store := storage.NewTaskStore()
-    apiClient := external.NewAPIClient()
-    handler := handlers.NewTaskHandler(store, apiClient)
+    cfg, opts, err := config.Load(os.Args[1:], os.LookupEnv)
+    if errors.Is(err, flag.ErrHelp) {
+        config.Usage(os.Stdout)
+        return
+    }
+    if opts.PrintConfig {
+        out, _ := json.MarshalIndent(cfg.Redacted(), "", "  ")
+        fmt.Println(string(out))
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    if opts.PrintConfig {
+        return
+    }
     
-    store.Create(models.Task{Title: "Write unit tests", Done: false})
-    store.Create(models.Task{Title: "Deploy service", Done: true})
-    store.Create(models.Task{Title: "Learn Go", Done: false})
+    logger, err := middleware.NewLogger(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+    if err != nil {
+        log.Fatalf("failed to init logger: %v", err)
+    }
+    slog.SetDefault(logger)
+    
+    store, err := newTaskRepository(cfg.Store)
+    if err != nil {
+        log.Fatalf("failed to init task store: %v", err)
+    }
+    
+    //аудит подписывается первым, чтобы демо-задачи тоже попали в историю
+    auditLog, err := audit.NewLog(cfg.Audit.Path, cfg.Audit.MaxEntriesPerTask, cfg.Audit.CompactEvery)
+    if err != nil {
+        log.Fatalf("failed to init audit log: %v", err)
+    }
+    store.OnChange(auditLog.Record)
+    
+    //события публикуются хранилищем, поэтому видны все мутации, включая импорт
+    broker := events.NewBroker(cfg.Events.BufferSize)
+    store.OnChange(broker.Publish)
+    
+    dispatcher := webhooks.NewDispatcher(webhooks.Config{
+        Workers:             cfg.Webhooks.Workers,
+        QueueSize:           cfg.Webhooks.QueueSize,
+        MaxAttempts:         cfg.Webhooks.MaxAttempts,
+        Timeout:             time.Duration(cfg.Webhooks.Timeout),
+        BaseBackoff:         time.Duration(cfg.Webhooks.BaseBackoff),
+        MaxBackoff:          time.Duration(cfg.Webhooks.MaxBackoff),
+        AllowPrivateTargets: cfg.Webhooks.AllowPrivateTargets,
+    }, logger)
+    store.OnChange(dispatcher.Handle)
+    
+    registry := metrics.NewRegistry()
+    httpMetrics := metrics.NewHTTPMetrics(registry)
+    externalMetrics := metrics.NewExternalMetrics(registry)
+    registry.NewGaugeFunc("task_store_tasks", "Number of tasks currently held in the task store.", func() float64 {
+        return float64(store.Count())
+    })
+    registry.NewGaugeFunc("task_events_subscribers", "Number of open /tasks/events streams.", func() float64 {
+        return float64(broker.Subscribers())
+    })
+    
+    externalConfig := external.DefaultConfig()
+    externalConfig.BaseURL = cfg.External.BaseURL
+    externalConfig.Timeout = time.Duration(cfg.External.Timeout)
+    externalConfig.MaxRetries = cfg.External.MaxRetries
+    externalConfig.CacheTTL = time.Duration(cfg.External.CacheTTL)
+    externalConfig.CacheMaxStale = time.Duration(cfg.External.CacheMaxStale)
+    externalConfig.BreakerThreshold = cfg.External.BreakerThreshold
+    externalConfig.BreakerCooldown = time.Duration(cfg.External.BreakerCooldown)
+    externalConfig.MaxResponseBytes = cfg.External.MaxResponseBytes
+    externalConfig.Observer = externalMetrics.Observe
+    apiClient := external.NewAPIClient(externalConfig)
+    handler := handlers.NewTaskHandler(store, apiClient, time.Duration(cfg.Server.WriteTimeout))
+    
+    //ключи из API_KEYS получают скоупы задач и внешнего API, если в записи не указаны другие,
+    //остальные выпускаются через /admin/keys
+    apiKeys := auth.NewKeyStore()
+    if err := auth.LoadKeys(apiKeys, cfg.Auth.APIKeys); err != nil {
+        log.Fatalf("failed to load API_KEYS: %v", err)
+    }
+    keyHandler := handlers.NewKeyHandler(apiKeys)
+    eventHandler := handlers.NewEventHandler(broker, time.Duration(cfg.Events.Heartbeat))
+    webhookHandler := handlers.NewWebhookHandler(dispatcher)
+    historyHandler := handlers.NewHistoryHandler(auditLog)
+    
+    //демо-задачи только для пустого хранилища, иначе файловый бэкенд плодит дубли
+    if store.Count() == 0 {
+        store.Create(context.Background(), models.Task{Title: "Write unit tests", Done: false, UserID: 1})
+        store.Create(context.Background(), models.Task{Title: "Deploy service", Done: true, UserID: 1})
+        store.Create(context.Background(), models.Task{Title: "Learn Go", Done: false, UserID: 1})
+    }
+    
+    //повторяющиеся задачи: закрытие вхождения обрабатывает хранилище, а
+    //наступившее время - фоновый планировщик
+    scheduler := recurrence.NewScheduler(store, time.Duration(cfg.Schedule.Interval), logger)
+    scheduler.Start()
+    
+    //хранилище критично для готовности, внешний апи нужен только части ручек
+    probes := health.NewRegistry(time.Duration(cfg.Health.CheckTimeout))
+    probes.Register("store", true, func(ctx context.Context) error {
+        return store.Ping()
+    })
+    probes.Register("external_api", false, apiClient.Ping)
     
     mux := http.NewServeMux()
     
-    mux.HandleFunc("GET /tasks", handler.GetTask)
-    mux.HandleFunc("POST /tasks", handler.CreateTask)
-    mux.HandleFunc("PATCH /tasks", handler.UpdateTask)
-    mux.HandleFunc("DELETE /tasks", handler.DeleteTask)
+    //route регистрирует хендлер, доступный только ключам с нужным скоупом;
+    //по тому же скоупу выбирается лимит частоты запросов
+    routeScopes := map[string]string{}
+    route := func(pattern, scope string, h http.HandlerFunc) {
+        routeScopes[pattern] = scope
+        mux.Handle(pattern, middleware.RequireScope(scope, h))
+    }
+    
+    route("GET /tasks", auth.ScopeTasksRead, handler.ListTasks)
+    route("POST /tasks", auth.ScopeTasksWrite, handler.CreateTask)
+    route("POST /tasks/bulk", auth.ScopeTasksWrite, handler.BulkTasks)
+    route("GET /tasks/events", auth.ScopeTasksRead, eventHandler.StreamTaskEvents)
+    route("GET /tasks/search", auth.ScopeTasksRead, handler.SearchTasks)
+    route("GET /tasks/export", auth.ScopeTasksRead, handler.ExportTasks)
+    route("POST /tasks/import", auth.ScopeTasksWrite, handler.ImportTasks)
+    route("GET /tasks/{id}", auth.ScopeTasksRead, handler.GetTaskByID)
+    route("GET /tasks/{id}/history", auth.ScopeTasksRead, historyHandler.GetTaskHistory)
+    route("GET /tasks/{id}/tree", auth.ScopeTasksRead, handler.GetTaskTree)
+    route("PUT /tasks/{id}", auth.ScopeTasksWrite, handler.ReplaceTask)
+    route("PATCH /tasks/{id}", auth.ScopeTasksWrite, handler.UpdateTask)
+    route("DELETE /tasks/{id}", auth.ScopeTasksWrite, handler.DeleteTask)
+    
+    //устаревшие формы с ?id=, отвечают с заголовком Deprecation
+    route("PATCH /tasks", auth.ScopeTasksWrite, handler.UpdateTask)
+    route("DELETE /tasks", auth.ScopeTasksWrite, handler.DeleteTask)
     
-    mux.HandleFunc("GET /external/todos", handler.GetExternalTodos)
-    mux.HandleFunc("POST /external/posts", handler.CreateExternalPost)
+    route("GET /external/todos", auth.ScopeExternalRead, handler.GetExternalTodos)
+    route("POST /external/posts", auth.ScopeExternalWrite, handler.CreateExternalPost)
+    mux.Handle("POST /external/todos/import", middleware.RequireScope(auth.ScopeExternalRead,
+        middleware.RequireScope(auth.ScopeTasksWrite, http.HandlerFunc(handler.ImportExternalTodos))))
+    routeScopes["POST /external/todos/import"] = auth.ScopeTasksWrite
+    
+    route("GET /webhooks", auth.ScopeWebhooks, webhookHandler.ListWebhooks)
+    route("POST /webhooks", auth.ScopeWebhooks, webhookHandler.CreateWebhook)
+    route("GET /webhooks/{id}", auth.ScopeWebhooks, webhookHandler.GetWebhook)
+    route("DELETE /webhooks/{id}", auth.ScopeWebhooks, webhookHandler.DeleteWebhook)
+    route("GET /webhooks/{id}/deliveries", auth.ScopeWebhooks, webhookHandler.ListDeliveries)
+    route("GET /webhooks/{id}/dead-letters", auth.ScopeWebhooks, webhookHandler.ListDeadLetters)
+    
+    route("GET /admin/keys", auth.ScopeKeysAdmin, keyHandler.ListKeys)
+    route("POST /admin/keys", auth.ScopeKeysAdmin, keyHandler.CreateKey)
+    route("DELETE /admin/keys/{id}", auth.ScopeKeysAdmin, keyHandler.RevokeKey)
+    route("POST /admin/keys/{id}/rotate", auth.ScopeKeysAdmin, keyHandler.RotateKey)
     
     mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
-        fmt.Fprintf(w, `{"status": "ok", "tasks": %d}`, store.Count())
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status":         "ok",
+            "tasks":          store.Count(),
+            "external_cache": apiClient.CacheStats(),
+        })
     })
     
-    stack := middleware.APIKeyMiddleware(
-        middleware.RequestIDMiddleware(
-            middleware.LoggingMiddleware(mux),
+    mux.Handle("GET /metrics", registry.Handler())
+    mux.Handle("GET /livez", probes.LivenessHandler())
+    mux.Handle("GET /readyz", probes.ReadinessHandler())
+    
+    var limiter *ratelimit.Limiter
+    if cfg.RateLimit.Enabled {
+        //спецификацию уже проверил config.Validate
+        scopeLimits, _ := ratelimit.ParseScopes(cfg.RateLimit.Scopes)
+        limiter = ratelimit.New(ratelimit.Config{
+            Scopes:     scopeLimits,
+            Default:    cfg.RateLimit.Default,
+            Anonymous:  cfg.RateLimit.Anonymous,
+            DailyQuota: cfg.RateLimit.DailyQuota,
+        })
+    }
+    publicPaths := []string{"/metrics", "/livez", "/readyz"}
+    //файл экспорта обычно больше общего предела тела, импорт ограничен своим
+    bodyLimits := map[string]int64{"POST /tasks/import": handlers.MaxImportBytes}
+    
+    //request ID ставится первым, чтобы его видели логи, в том числе для 401;
+    //маршрут ищется до проверки ключа, чтобы 401 попадали в метрики по шаблону,
+    //а лимитер по нему выбирал скоуп; 429 отдается раньше, чем читается тело
+    stack := middleware.RequestIDMiddleware(
+        middleware.RouteRecorder(mux)(
+            middleware.LoggingMiddleware(logger)(
+                middleware.MetricsMiddleware(httpMetrics)(
+                    middleware.RateLimitMiddleware(limiter, apiKeys, routeScopes, publicPaths...)(
+                        middleware.MaxBodyMiddleware(cfg.Server.MaxBodyBytes, bodyLimits)(
+                            middleware.APIKeyMiddleware(apiKeys, publicPaths...)(mux),
+                        ),
+                    ),
+                ),
+            ),
         ),
     )
     
-    port := ":8080"
+    port := cfg.Addr()
+    
+    //WriteTimeout ограничивает и долгие ответы, а ReadHeaderTimeout
+    //отдельно защищает от медленной отправки заголовков
+    server := &http.Server{
+        Addr:              port,
+        Handler:           stack,
+        ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+        ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+        WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+        IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+        MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+        ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+    }
+    //Shutdown не прерывает активные соединения, а SSE-потоки сами не заканчиваются
+    server.RegisterOnShutdown(broker.Close)
+    
     fmt.Printf("Server starting on http://localhost%s\n", port)
-    fmt.Println("Use API Key: secret12345")
+    if cfg.Auth.APIKeys == config.DefaultAPIKeys {
+        fmt.Println("Use API Key: secret12345 (tasks and external API; configure more via API_KEYS=key=userId:name[:scope+scope],...)")
+    }
     fmt.Println("\nAvailable endpoints:")
     fmt.Println("  GET    /tasks                    - Get all tasks")
-    fmt.Println("  GET    /tasks?id=1              - Get task by ID")
     fmt.Println("  GET    /tasks?done=true         - Get tasks filtered by status")
+    fmt.Println("         filters: title, tag, due_after, due_before; sort=-priority; limit, cursor")
     fmt.Println("  POST   /tasks                   - Create new task")
-    fmt.Println("  PATCH  /tasks?id=1              - Update task status")
-    fmt.Println("  DELETE /tasks?id=1              - Delete task")
+    fmt.Println("  POST   /tasks/bulk              - Create/update/delete many tasks (atomic or best_effort)")
+    fmt.Println("  GET    /tasks/events            - Stream task changes (SSE, Last-Event-ID)")
+    fmt.Println("  GET    /tasks/search?q=         - Full-text search: prefix*, \"phrases\", AND/OR/NOT, BM25 ranking")
+    fmt.Println("  GET    /tasks/export?format=    - Stream all tasks as jsonl (default) or csv")
+    fmt.Println("  POST   /tasks/import?format=    - Import jsonl/csv export, per-line errors; dry_run=true only validates")
+    fmt.Println("  GET    /tasks/{id}              - Get task by ID")
+    fmt.Println("  PUT    /tasks/{id}              - Replace task")
+    fmt.Println("  PATCH  /tasks/{id}              - Partially update task fields")
+    fmt.Println("  DELETE /tasks/{id}              - Delete task")
+    fmt.Println("  GET    /tasks/{id}/history      - Audit trail of task changes (kept after delete)")
+    fmt.Println("  GET    /tasks/{id}/tree         - Task with subtasks (parent_id) and open blockers (blocked_by)")
+    fmt.Println("         recurrence: {\"rule\": \"0 9 * * MON-FRI\" or \"FREQ=WEEKLY;BYDAY=MO\", \"timezone\": \"Europe/Berlin\"}")
+    fmt.Println("  (deprecated: GET/PATCH/DELETE /tasks?id=1)")
     fmt.Println("  GET    /external/todos          - Get todos from external API")
+    fmt.Println("  POST   /external/todos/import   - Import external todos as tasks")
     fmt.Println("  POST   /external/posts          - Create post on external API")
     fmt.Println("  GET    /health                  - Health check")
+    fmt.Println("  GET    /livez                   - Liveness probe (no API key)")
+    fmt.Println("  GET    /readyz                  - Readiness probe with dependency checks (no API key)")
+    fmt.Println("  GET    /metrics                 - Prometheus metrics (no API key)")
+    fmt.Println("  GET    /webhooks                - List webhook subscriptions")
+    fmt.Println("  POST   /webhooks                - Subscribe URL to task events (secret shown once)")
+    fmt.Println("  GET    /webhooks/{id}           - Get webhook subscription")
+    fmt.Println("  DELETE /webhooks/{id}           - Delete webhook subscription")
+    fmt.Println("  GET    /webhooks/{id}/deliveries   - Delivery log")
+    fmt.Println("  GET    /webhooks/{id}/dead-letters - Failed deliveries")
+    fmt.Println("  GET    /admin/keys              - List API keys")
+    fmt.Println("  POST   /admin/keys              - Create API key (shown once)")
+    fmt.Println("  DELETE /admin/keys/{id}         - Revoke API key")
+    fmt.Println("  POST   /admin/keys/{id}/rotate  - Rotate API key")
+    
+    quit := make(chan os.Signal, 1)
+    signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+    
+    serverErr := make(chan error, 1)
+    go func() {
+        if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            serverErr <- err
+        }
+    }()
     
-    log.Fatal(http.ListenAndServe(port, stack))
-}
\ No newline at end of file
+    select {
+    case err := <-serverErr:
+        store.Close()
+        log.Fatalf("server failed: %v", err)
+    case sig := <-quit:
+        logger.Info("shutdown started", "signal", sig.String())
+    }
+    
+    //сначала /readyz начинает отвечать 503, и балансировщик успевает убрать под
+    //из ротации, пока сервер еще принимает запросы
+    probes.StartShutdown()
+    if delay := time.Duration(cfg.Server.DrainDelay); delay > 0 {
+        time.Sleep(delay)
+    }
+    
+    grace := time.Duration(cfg.Server.ShutdownGrace)
+    ctx, cancel := context.WithTimeout(context.Background(), grace)
+    defer cancel()
+    
+    if err := server.Shutdown(ctx); err != nil {
+        logger.Error("graceful shutdown timed out, closing remaining connections", "grace", grace, "error", err)
+        server.Close()
+    }
+    
+    //доставки из очереди дорабатываются отдельным окном, запланированные ретраи теряются
+    hooksCtx, cancelHooks := context.WithTimeout(context.Background(), grace)
+    defer cancelHooks()
+    if err := dispatcher.Close(hooksCtx); err != nil {
+        logger.Warn("webhook deliveries interrupted", "error", err)
+    }
+    
+    scheduler.Stop()
+    
+    //хранилище сбрасывается только после того, как отработали запросы в полете
+    if err := store.Close(); err != nil {
+        logger.Error("failed to flush task store", "error", err)
+        os.Exit(1)
+    }
+    if err := auditLog.Close(); err != nil {
+        logger.Error("failed to flush audit log", "error", err)
+    }
+    logger.Info("server stopped")
+}
+
+//newTaskRepository выбирает бэкенд хранилища (memory|file)
+func newTaskRepository(cfg config.StoreConfig) (storage.TaskRepository, error) {
+    switch cfg.Backend {
+    case "memory":
+        return storage.NewTaskStore(), nil
+    case "file":
+        fmt.Printf("Using file task store at %s\n", cfg.Path)
+        return storage.NewFileTaskStore(cfg.Path, cfg.CompactEvery)
+    default:
+        return nil, fmt.Errorf("unknown task store backend %q, expected memory or file", cfg.Backend)
+    }
+}
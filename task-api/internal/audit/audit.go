@@ -0,0 +1,327 @@
+package audit
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "reflect"
+    "sort"
+    "sync"
+    "task-api/internal/models"
+)
+
+const (
+    DefaultMaxEntriesPerTask = 100
+    DefaultCompactEvery      = 1000
+)
+
+//record - строка файла аудита. OwnerID в API не отдается, но нужен после
+//перезапуска, чтобы историю удаленной задачи видел только ее владелец.
+type record struct {
+    models.AuditEntry
+    OwnerID int `json:"owner_id"`
+}
+
+//Log хранит историю изменений задач, в том числе удаленных. Пишется как
+//слушатель хранилища; если задан путь, записи дублируются в JSONL-файл и
+//читаются из него при старте. maxPerTask ограничивает и файл: когда в нем
+//накапливается compactEvery новых записей, он переписывается оставшейся историей.
+type Log struct {
+    mu           sync.RWMutex
+    entries      map[int][]models.AuditEntry
+    nextID       uint64
+    maxPerTask   int
+    path         string
+    file         *os.File
+    writer       *bufio.Writer
+    records      int
+    compactEvery int
+}
+
+func NewLog(path string, maxPerTask, compactEvery int) (*Log, error) {
+    if maxPerTask <= 0 {
+        maxPerTask = DefaultMaxEntriesPerTask
+    }
+    if compactEvery <= 0 {
+        compactEvery = DefaultCompactEvery
+    }
+
+    l := &Log{
+        entries:      make(map[int][]models.AuditEntry),
+        nextID:       1,
+        maxPerTask:   maxPerTask,
+        path:         path,
+        compactEvery: compactEvery,
+    }
+    if path == "" {
+        return l, nil
+    }
+
+    if err := l.replay(); err != nil {
+        return nil, err
+    }
+    //сразу компактим: записи сверх maxPerTask из прошлых запусков отбрасываются
+    if err := l.compactLocked(); err != nil {
+        return nil, err
+    }
+    return l, nil
+}
+
+func (l *Log) replay() error {
+    f, err := os.Open(l.path)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to open audit log: %w", err)
+    }
+    defer f.Close()
+
+    scanner := bufio.NewScanner(f)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        var rec record
+        if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+            log.Printf("audit log %s: skipping malformed record at line %d: %v", l.path, line, err)
+            continue
+        }
+        rec.AuditEntry.OwnerID = rec.OwnerID
+        l.appendLocked(rec.AuditEntry)
+        if rec.ID >= l.nextID {
+            l.nextID = rec.ID + 1
+        }
+    }
+
+    if err := scanner.Err(); err != nil {
+        return fmt.Errorf("failed to read audit log: %w", err)
+    }
+    return nil
+}
+
+//Record - слушатель storage.TaskRepository.OnChange. Вызывается под
+//блокировкой хранилища, поэтому порядок записей совпадает с порядком изменений.
+func (l *Log) Record(change models.TaskChange) {
+    var after *models.Task
+    if change.Type != models.TaskDeleted {
+        after = &change.Task
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    entry := models.AuditEntry{
+        ID:        l.nextID,
+        TaskID:    change.Task.ID,
+        OwnerID:   change.Task.UserID,
+        Type:      change.Type,
+        Version:   change.Task.Version,
+        Actor:     change.Actor,
+        RequestID: change.Actor.RequestID,
+        At:        change.At,
+        Changes:   Diff(change.Previous, after),
+    }
+    l.nextID++
+    l.appendLocked(entry)
+    l.writeLocked(entry)
+}
+
+//History отдает историю задачи владельцу, в том числе после удаления
+func (l *Log) History(ownerID, taskID int) (models.TaskHistory, bool) {
+    l.mu.RLock()
+    defer l.mu.RUnlock()
+
+    entries := l.entries[taskID]
+    if len(entries) == 0 || entries[0].OwnerID != ownerID {
+        return models.TaskHistory{}, false
+    }
+
+    return models.TaskHistory{
+        TaskID:  taskID,
+        Deleted: entries[len(entries)-1].Type == models.TaskDeleted,
+        Entries: append([]models.AuditEntry(nil), entries...),
+    }, true
+}
+
+//Close сбрасывает буфер и закрывает файл аудита
+func (l *Log) Close() error {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    if l.file == nil {
+        return nil
+    }
+    if err := l.writer.Flush(); err != nil {
+        return fmt.Errorf("failed to flush audit log: %w", err)
+    }
+    err := l.file.Close()
+    l.file = nil
+    return err
+}
+
+//appendLocked добавляет запись, у задачи остаются последние maxPerTask записей
+func (l *Log) appendLocked(entry models.AuditEntry) {
+    entries := append(l.entries[entry.TaskID], entry)
+    if len(entries) > l.maxPerTask {
+        entries = append([]models.AuditEntry(nil), entries[len(entries)-l.maxPerTask:]...)
+    }
+    l.entries[entry.TaskID] = entries
+}
+
+func (l *Log) writeLocked(entry models.AuditEntry) {
+    if l.file == nil {
+        return
+    }
+
+    data, err := json.Marshal(record{AuditEntry: entry, OwnerID: entry.OwnerID})
+    if err != nil {
+        log.Printf("audit log %s: failed to marshal record: %v", l.path, err)
+        return
+    }
+    data = append(data, '\n')
+
+    if _, err := l.writer.Write(data); err != nil {
+        log.Printf("audit log %s: failed to append record: %v", l.path, err)
+        return
+    }
+    if err := l.writer.Flush(); err != nil {
+        log.Printf("audit log %s: failed to flush record: %v", l.path, err)
+        return
+    }
+
+    l.records++
+    if l.records >= l.compactEvery {
+        //при ошибке записи продолжают идти в старый файл
+        if err := l.compactLocked(); err != nil {
+            log.Printf("audit log %s: compaction failed: %v", l.path, err)
+        }
+    }
+}
+
+//compactLocked переписывает файл оставшимися в памяти записями. Старый файл
+//остается открытым, пока новый не встал на его место.
+func (l *Log) compactLocked() error {
+    var entries []models.AuditEntry
+    for _, taskEntries := range l.entries {
+        entries = append(entries, taskEntries...)
+    }
+    sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+    tmpPath := l.path + ".tmp"
+    //снапшот сразу открыт на дозапись: после переименования он и есть новый файл
+    tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return fmt.Errorf("failed to create audit snapshot: %w", err)
+    }
+    discard := func(err error) error {
+        tmp.Close()
+        os.Remove(tmpPath)
+        return err
+    }
+
+    w := bufio.NewWriter(tmp)
+    enc := json.NewEncoder(w)
+    for _, entry := range entries {
+        if err := enc.Encode(record{AuditEntry: entry, OwnerID: entry.OwnerID}); err != nil {
+            return discard(fmt.Errorf("failed to write audit snapshot: %w", err))
+        }
+    }
+    if err := w.Flush(); err != nil {
+        return discard(fmt.Errorf("failed to flush audit snapshot: %w", err))
+    }
+    if err := tmp.Sync(); err != nil {
+        return discard(fmt.Errorf("failed to sync audit snapshot: %w", err))
+    }
+
+    if l.file != nil {
+        if err := l.writer.Flush(); err != nil {
+            return discard(fmt.Errorf("failed to flush audit log: %w", err))
+        }
+    }
+    if err := os.Rename(tmpPath, l.path); err != nil {
+        return discard(fmt.Errorf("failed to replace audit log: %w", err))
+    }
+    if l.file != nil {
+        if err := l.file.Close(); err != nil {
+            log.Printf("audit log %s: failed to close replaced log: %v", l.path, err)
+        }
+    }
+
+    l.file = tmp
+    l.writer = w
+    l.records = 0
+    return nil
+}
+
+//auditedFields - поля задачи, которые попадают в diff
+var auditedFields = []struct {
+    name  string
+    value func(task models.Task) any
+}{
+    {"title", func(t models.Task) any { return t.Title }},
+    {"description", func(t models.Task) any { return t.Description }},
+    {"done", func(t models.Task) any { return t.Done }},
+    {"due_at", func(t models.Task) any {
+        if t.DueAt == nil {
+            return nil
+        }
+        return *t.DueAt
+    }},
+    {"priority", func(t models.Task) any { return t.Priority }},
+    {"tags", func(t models.Task) any {
+        if len(t.Tags) == 0 {
+            return nil
+        }
+        return t.Tags
+    }},
+    {"parent_id", func(t models.Task) any {
+        if t.ParentID == nil {
+            return nil
+        }
+        return *t.ParentID
+    }},
+    {"blocked_by", func(t models.Task) any {
+        if len(t.BlockedBy) == 0 {
+            return nil
+        }
+        return t.BlockedBy
+    }},
+    {"recurrence", func(t models.Task) any {
+        if t.Recurrence == nil {
+            return nil
+        }
+        return *t.Recurrence
+    }},
+    {"external_ref", func(t models.Task) any { return t.ExternalRef }},
+}
+
+//Diff сравнивает задачу до и после изменения по полям. before nil - задача
+//создана, after nil - удалена.
+func Diff(before, after *models.Task) []models.FieldChange {
+    changes := []models.FieldChange{}
+    for _, field := range auditedFields {
+        var old, updated any
+        if before != nil {
+            old = field.value(*before)
+        }
+        if after != nil {
+            updated = field.value(*after)
+        }
+        //у созданной и удаленной задачи пустые поля не показываем
+        if before == nil && isEmpty(updated) || after == nil && isEmpty(old) {
+            continue
+        }
+        if reflect.DeepEqual(old, updated) {
+            continue
+        }
+        changes = append(changes, models.FieldChange{Field: field.name, Before: old, After: updated})
+    }
+    return changes
+}
+
+func isEmpty(value any) bool {
+    return value == nil || reflect.ValueOf(value).IsZero()
+}
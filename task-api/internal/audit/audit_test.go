@@ -0,0 +1,119 @@
+package audit
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "task-api/internal/models"
+)
+
+func TestLog(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    l, err := NewLog(path, 10, 0)
+    if err != nil {
+        t.Fatalf("expected no error, got %v", err)
+    }
+
+    actor := models.Actor{UserID: 1, Name: "alice", KeyID: "k1", RequestID: "req-1"}
+    created := models.Task{ID: 7, UserID: 1, Title: "draft", Priority: models.PriorityNormal, Version: 1}
+    updated := created
+    updated.Title = "final"
+    updated.Done = true
+    updated.Version = 2
+
+    l.Record(models.TaskChange{Type: models.TaskCreated, Task: created, Actor: actor, At: time.Now()})
+    l.Record(models.TaskChange{Type: models.TaskUpdated, Task: updated, Previous: &created, Actor: actor})
+    l.Record(models.TaskChange{Type: models.TaskDeleted, Task: updated, Previous: &updated})
+
+    history, ok := l.History(1, 7)
+    if !ok || len(history.Entries) != 3 || !history.Deleted {
+        t.Fatalf("expected 3 entries of deleted task, got %+v", history)
+    }
+
+    changes := history.Entries[1].Changes
+    if len(changes) != 2 || changes[0].Field != "title" || changes[0].Before != "draft" || changes[1].Field != "done" {
+        t.Errorf("expected title and done diff, got %+v", changes)
+    }
+    if history.Entries[1].RequestID != "req-1" || history.Entries[1].Actor.Name != "alice" {
+        t.Errorf("expected actor and request id, got %+v", history.Entries[1])
+    }
+    if len(history.Entries[0].Changes) != 2 {
+        t.Errorf("expected only non-empty fields on create, got %+v", history.Entries[0].Changes)
+    }
+
+    if _, ok := l.History(2, 7); ok {
+        t.Error("expected history to be hidden from other owners")
+    }
+
+    if err := l.Close(); err != nil {
+        t.Fatalf("expected no error on close, got %v", err)
+    }
+    reopened, err := NewLog(path, 10, 0)
+    if err != nil {
+        t.Fatalf("expected no error on replay, got %v", err)
+    }
+    defer reopened.Close()
+
+    replayed, ok := reopened.History(1, 7)
+    if !ok || len(replayed.Entries) != 3 || replayed.Entries[2].ID != 3 {
+        t.Errorf("expected history to survive restart, got %+v", replayed)
+    }
+    if _, ok := reopened.History(2, 7); ok {
+        t.Error("expected owner to survive restart")
+    }
+}
+
+func TestLogKeepsLastEntries(t *testing.T) {
+    l, _ := NewLog("", 2, 0)
+    task := models.Task{ID: 1, UserID: 1, Title: "t"}
+    for i := 0; i < 5; i++ {
+        previous := task
+        task.Version++
+        l.Record(models.TaskChange{Type: models.TaskUpdated, Task: task, Previous: &previous})
+    }
+
+    history, _ := l.History(1, 1)
+    if len(history.Entries) != 2 || history.Entries[1].Version != 5 {
+        t.Errorf("expected last 2 entries, got %+v", history.Entries)
+    }
+}
+
+func TestLogCompactsFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    l, err := NewLog(path, 2, 3)
+    if err != nil {
+        t.Fatalf("expected no error, got %v", err)
+    }
+    defer l.Close()
+
+    task := models.Task{ID: 1, UserID: 1, Title: "t", Version: 1}
+    l.Record(models.TaskChange{Type: models.TaskCreated, Task: task})
+    for i := 0; i < 4; i++ {
+        previous := task
+        task.Version++
+        l.Record(models.TaskChange{Type: models.TaskUpdated, Task: task, Previous: &previous})
+    }
+
+    //после третьей записи файл переписан двумя оставшимися, потом дописаны еще две
+    data, _ := os.ReadFile(path)
+    if lines := bytes.Count(data, []byte("\n")); lines != 4 {
+        t.Errorf("expected file trimmed to retained entries, got %d lines", lines)
+    }
+
+    reopened, err := NewLog(path, 2, 3)
+    if err != nil {
+        t.Fatalf("expected no error on replay, got %v", err)
+    }
+    defer reopened.Close()
+    history, _ := reopened.History(1, 1)
+    if len(history.Entries) != 2 || history.Entries[1].Version != 5 || history.Entries[1].ID != 5 {
+        t.Errorf("expected last 2 entries after restart, got %+v", history.Entries)
+    }
+    reopened.Record(models.TaskChange{Type: models.TaskDeleted, Task: task, Previous: &task})
+    if history, _ := reopened.History(1, 1); history.Entries[1].ID != 6 {
+        t.Errorf("expected ids to continue after compaction, got %+v", history.Entries)
+    }
+}
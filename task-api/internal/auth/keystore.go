@@ -0,0 +1,390 @@
+package auth
+
+import (
+    "bytes"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "task-api/internal/models"
+    "time"
+)
+
+const (
+    ScopeTasksRead     = "tasks:read"
+    ScopeTasksWrite    = "tasks:write"
+    ScopeExternalRead  = "external:read"
+    ScopeExternalWrite = "external:write"
+    ScopeExternalAll   = "external:*"
+    ScopeKeysAdmin     = "keys:admin"
+    ScopeWebhooks      = "webhooks:manage"
+    ScopeAll           = "*"
+)
+
+var knownScopes = map[string]bool{
+    ScopeTasksRead:     true,
+    ScopeTasksWrite:    true,
+    ScopeExternalRead:  true,
+    ScopeExternalWrite: true,
+    ScopeExternalAll:   true,
+    ScopeKeysAdmin:     true,
+    ScopeWebhooks:      true,
+    ScopeAll:           true,
+}
+
+func ValidScope(scope string) bool {
+    return knownScopes[scope]
+}
+
+var (
+    ErrKeyNotFound = errors.New("api key not found")
+    ErrKeyRevoked  = errors.New("api key revoked")
+    ErrKeyExpired  = errors.New("api key expired")
+    ErrKeyExists   = errors.New("api key already registered")
+)
+
+//APIKey - метаданные ключа. Сам ключ не хранится, только его SHA-256.
+type APIKey struct {
+    ID         string     `json:"id"`
+    Name       string     `json:"name"`
+    UserID     int        `json:"userId"`
+    Scopes     []string   `json:"scopes"`
+    Prefix     string     `json:"prefix"`
+    CreatedAt  time.Time  `json:"created_at"`
+    ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+    LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+    RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+    hash       []byte
+    //lineage - ID первого ключа в цепочке ротаций
+    lineage    string
+}
+
+//Lineage - ID первого ключа в цепочке ротаций: у замены он тот же, что у
+//отозванного ключа, поэтому по нему считаются лимиты и квоты
+func (k APIKey) Lineage() string {
+    if k.lineage == "" {
+        return k.ID
+    }
+    return k.lineage
+}
+
+func (k APIKey) Principal() models.Principal {
+    return models.Principal{
+        UserID: k.UserID,
+        Name:   k.Name,
+        KeyID:  k.ID,
+        Scopes: append([]string(nil), k.Scopes...),
+    }
+}
+
+type KeyStore struct {
+    mu   sync.Mutex
+    keys map[string]*APIKey
+    now  func() time.Time
+}
+
+func NewKeyStore() *KeyStore {
+    return &KeyStore{
+        keys: make(map[string]*APIKey),
+        now:  time.Now,
+    }
+}
+
+//Create выпускает новый ключ. Открытое значение возвращается только здесь.
+func (s *KeyStore) Create(name string, userID int, scopes []string, expiresAt *time.Time) (APIKey, string, error) {
+    plaintext, err := generateSecret()
+    if err != nil {
+        return APIKey{}, "", err
+    }
+
+    key, err := s.add(plaintext, name, userID, scopes, expiresAt)
+    if err != nil {
+        return APIKey{}, "", err
+    }
+    return key, plaintext, nil
+}
+
+//Import регистрирует заранее известный ключ, например из переменной окружения
+func (s *KeyStore) Import(plaintext, name string, userID int, scopes []string) (APIKey, error) {
+    if plaintext == "" {
+        return APIKey{}, errors.New("api key cannot be empty")
+    }
+    key, err := s.newKey(plaintext, name, userID, scopes, nil)
+    if err != nil {
+        return APIKey{}, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    //Authenticate вернул бы любой из двух ключей с одним значением
+    for _, existing := range s.keys {
+        if bytes.Equal(existing.hash, key.hash) {
+            return APIKey{}, ErrKeyExists
+        }
+    }
+    s.keys[key.ID] = key
+    return *key, nil
+}
+
+func (s *KeyStore) add(plaintext, name string, userID int, scopes []string, expiresAt *time.Time) (APIKey, error) {
+    key, err := s.newKey(plaintext, name, userID, scopes, expiresAt)
+    if err != nil {
+        return APIKey{}, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.keys[key.ID] = key
+    return *key, nil
+}
+
+func (s *KeyStore) newKey(plaintext, name string, userID int, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+    id, err := generateID()
+    if err != nil {
+        return nil, err
+    }
+
+    hash := sha256.Sum256([]byte(plaintext))
+    return &APIKey{
+        ID:        id,
+        Name:      name,
+        UserID:    userID,
+        Scopes:    append([]string(nil), scopes...),
+        Prefix:    keyPrefix(plaintext),
+        CreatedAt: s.now().UTC(),
+        ExpiresAt: expiresAt,
+        hash:      hash[:],
+    }, nil
+}
+
+//Authenticate ищет ключ по открытому значению и отмечает его использование
+func (s *KeyStore) Authenticate(plaintext string) (APIKey, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    found, err := s.lookupLocked(plaintext)
+    if err != nil {
+        return APIKey{}, err
+    }
+    s.markUsedLocked(found)
+    return *found, nil
+}
+
+//Lookup ищет ключ, как Authenticate, но LastUsedAt не трогает: запрос с этим
+//ключом еще может быть отклонен, например лимитером
+func (s *KeyStore) Lookup(plaintext string) (APIKey, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    found, err := s.lookupLocked(plaintext)
+    if err != nil {
+        return APIKey{}, err
+    }
+    return *found, nil
+}
+
+//MarkUsed отмечает использование ключа, найденного через Lookup
+func (s *KeyStore) MarkUsed(id string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if key, exists := s.keys[id]; exists {
+        s.markUsedLocked(key)
+    }
+}
+
+//lookupLocked сравнивает хэш с каждым ключом за постоянное время, чтобы по
+//времени ответа нельзя было подобрать ключ
+func (s *KeyStore) lookupLocked(plaintext string) (*APIKey, error) {
+    hash := sha256.Sum256([]byte(plaintext))
+
+    var found *APIKey
+    for _, key := range s.keys {
+        if subtle.ConstantTimeCompare(hash[:], key.hash) == 1 {
+            found = key
+        }
+    }
+
+    if found == nil {
+        return nil, ErrKeyNotFound
+    }
+    if found.RevokedAt != nil {
+        return nil, ErrKeyRevoked
+    }
+    if found.ExpiresAt != nil && !s.now().UTC().Before(*found.ExpiresAt) {
+        return nil, ErrKeyExpired
+    }
+    return found, nil
+}
+
+func (s *KeyStore) markUsedLocked(key *APIKey) {
+    now := s.now().UTC()
+    key.LastUsedAt = &now
+}
+
+func (s *KeyStore) List() []APIKey {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    keys := make([]APIKey, 0, len(s.keys))
+    for _, key := range s.keys {
+        keys = append(keys, *key)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        return keys[i].CreatedAt.Before(keys[j].CreatedAt) ||
+            keys[i].CreatedAt.Equal(keys[j].CreatedAt) && keys[i].ID < keys[j].ID
+    })
+    return keys
+}
+
+func (s *KeyStore) Get(id string) (APIKey, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    key, ok := s.keys[id]
+    if !ok {
+        return APIKey{}, ErrKeyNotFound
+    }
+    return *key, nil
+}
+
+func (s *KeyStore) Revoke(id string) (APIKey, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    key, ok := s.keys[id]
+    if !ok {
+        return APIKey{}, ErrKeyNotFound
+    }
+    if key.RevokedAt == nil {
+        now := s.now().UTC()
+        key.RevokedAt = &now
+    }
+    return *key, nil
+}
+
+//Rotate выпускает замену ключа с теми же владельцем, скоупами и сроком и отзывает старый.
+//Проверка, выпуск и отзыв идут под одной блокировкой: из параллельных
+//ротаций одного ключа проходит только первая, остальные получают ErrKeyRevoked.
+func (s *KeyStore) Rotate(id string) (APIKey, string, error) {
+    plaintext, err := generateSecret()
+    if err != nil {
+        return APIKey{}, "", err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    old, ok := s.keys[id]
+    if !ok {
+        return APIKey{}, "", ErrKeyNotFound
+    }
+    if old.RevokedAt != nil {
+        return APIKey{}, "", ErrKeyRevoked
+    }
+    now := s.now().UTC()
+    if old.ExpiresAt != nil && !now.Before(*old.ExpiresAt) {
+        return APIKey{}, "", ErrKeyExpired
+    }
+
+    key, err := s.newKey(plaintext, old.Name, old.UserID, old.Scopes, old.ExpiresAt)
+    if err != nil {
+        return APIKey{}, "", err
+    }
+    key.lineage = old.Lineage()
+    s.keys[key.ID] = key
+    old.RevokedAt = &now
+    return *key, plaintext, nil
+}
+
+//DefaultKeyScopes - скоупы ключа из LoadKeys, если они не указаны явно: все,
+//что было доступно ключам до скоупов. Управление ключами так не выдается:
+//демо-ключ общеизвестен.
+var DefaultKeyScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeExternalRead, ScopeExternalWrite}
+
+//scopeSeparator разделяет скоупы ключа в LoadKeys: запятая уже разделяет
+//ключи, а двоеточие входит в сами скоупы
+const scopeSeparator = "+"
+
+//LoadKeys разбирает строку вида "key1=1:alice,key2=2:ops:tasks:read+keys:admin"
+//и импортирует ключи. Без явного списка ключ получает DefaultKeyScopes.
+func LoadKeys(store *KeyStore, spec string) error {
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+
+        plaintext, owner, ok := strings.Cut(entry, "=")
+        if !ok || plaintext == "" {
+            return fmt.Errorf("invalid api key entry, expected key=userId:name[:scope+scope...]")
+        }
+
+        idStr, rest, _ := strings.Cut(owner, ":")
+        userID, err := strconv.Atoi(idStr)
+        if err != nil || userID <= 0 {
+            return fmt.Errorf("invalid user id %q in api key entry", idStr)
+        }
+
+        name, scopeSpec, hasScopes := strings.Cut(rest, ":")
+        scopes := DefaultKeyScopes
+        if hasScopes {
+            if scopes, err = parseKeyScopes(scopeSpec); err != nil {
+                return fmt.Errorf("api key %q: %w", name, err)
+            }
+        }
+
+        if _, err := store.Import(plaintext, name, userID, scopes); err != nil {
+            return fmt.Errorf("api key %q: %w", name, err)
+        }
+    }
+    return nil
+}
+
+func parseKeyScopes(spec string) ([]string, error) {
+    var scopes []string
+    for _, scope := range strings.Split(spec, scopeSeparator) {
+        scope = strings.TrimSpace(scope)
+        if !ValidScope(scope) {
+            return nil, fmt.Errorf("unknown scope %q", scope)
+        }
+        scopes = append(scopes, scope)
+    }
+    return scopes, nil
+}
+
+func generateSecret() (string, error) {
+    buf := make([]byte, 32)
+    if _, err := rand.Read(buf); err != nil {
+        return "", fmt.Errorf("failed to generate api key: %w", err)
+    }
+    return "tk_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func generateID() (string, error) {
+    buf := make([]byte, 8)
+    if _, err := rand.Read(buf); err != nil {
+        return "", fmt.Errorf("failed to generate key id: %w", err)
+    }
+    return hex.EncodeToString(buf), nil
+}
+
+//keyPrefix - первые символы ключа, по которым его можно узнать в списке
+func keyPrefix(plaintext string) string {
+    //у коротких импортированных ключей показываем меньше, чтобы не раскрыть их
+    visible := 6
+    if len(plaintext) < 20 {
+        visible = 2
+    }
+    if len(plaintext) <= visible {
+        return "..."
+    }
+    return plaintext[:visible] + "..."
+}
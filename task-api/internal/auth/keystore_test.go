@@ -0,0 +1,285 @@
+package auth
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/json"
+    "errors"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func testStore(now *time.Time) *KeyStore {
+    s := NewKeyStore()
+    s.now = func() time.Time { return *now }
+    return s
+}
+
+func TestKeyStore(t *testing.T) {
+    t.Run("Plaintext is returned only on create and stored as a hash", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        s := testStore(&now)
+
+        key, plaintext, err := s.Create("ci", 1, []string{ScopeTasksRead}, nil)
+        if err != nil {
+            t.Fatalf("expected no error on create, got %v", err)
+        }
+        if !strings.HasPrefix(plaintext, "tk_") || key.Prefix != plaintext[:6]+"..." {
+            t.Errorf("unexpected plaintext %q or prefix %q", plaintext, key.Prefix)
+        }
+        hash := sha256.Sum256([]byte(plaintext))
+        if !bytes.Equal(s.keys[key.ID].hash, hash[:]) {
+            t.Error("expected only the SHA-256 of the key to be stored")
+        }
+
+        //метаданные уходят клиенту в списке, секрета в них быть не должно
+        body, _ := json.Marshal(append(s.List(), mustGet(t, s, key.ID)))
+        if strings.Contains(string(body), plaintext) {
+            t.Errorf("expected listed keys not to expose plaintext, got %s", body)
+        }
+
+        _, other, _ := s.Create("ci", 1, []string{ScopeTasksRead}, nil)
+        if other == plaintext {
+            t.Error("expected every key to get its own secret")
+        }
+    })
+
+    t.Run("Authenticate", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        s := testStore(&now)
+
+        expiresAt := now.Add(time.Hour)
+        active, activeSecret, _ := s.Create("active", 1, []string{ScopeTasksRead}, nil)
+        _, expiringSecret, _ := s.Create("expiring", 1, nil, &expiresAt)
+        revoked, revokedSecret, _ := s.Create("revoked", 2, nil, nil)
+        s.Revoke(revoked.ID)
+
+        now = now.Add(2 * time.Hour)
+        tests := []struct {
+            name      string
+            plaintext string
+            wantErr   error
+            wantID    string
+        }{
+            {"valid key", activeSecret, nil, active.ID},
+            {"unknown key", "tk_unknown", ErrKeyNotFound, ""},
+            {"empty key", "", ErrKeyNotFound, ""},
+            {"prefix of a key", activeSecret[:10], ErrKeyNotFound, ""},
+            {"expired key", expiringSecret, ErrKeyExpired, ""},
+            {"revoked key", revokedSecret, ErrKeyRevoked, ""},
+        }
+        for _, tt := range tests {
+            t.Run(tt.name, func(t *testing.T) {
+                key, err := s.Authenticate(tt.plaintext)
+                if !errors.Is(err, tt.wantErr) || key.ID != tt.wantID {
+                    t.Errorf("expected %q, %v; got %q, %v", tt.wantID, tt.wantErr, key.ID, err)
+                }
+            })
+        }
+
+        if used := mustGet(t, s, active.ID).LastUsedAt; used == nil || !used.Equal(now) {
+            t.Errorf("expected last use to be recorded, got %v", used)
+        }
+    })
+
+    t.Run("Lookup leaves last use to MarkUsed", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        s := testStore(&now)
+
+        key, secret, _ := s.Create("ci", 1, nil, nil)
+        if found, err := s.Lookup(secret); err != nil || found.ID != key.ID {
+            t.Fatalf("expected lookup to find the key, got %+v, %v", found, err)
+        }
+        if used := mustGet(t, s, key.ID).LastUsedAt; used != nil {
+            t.Errorf("expected lookup not to record use, got %v", used)
+        }
+        s.MarkUsed(key.ID)
+        if used := mustGet(t, s, key.ID).LastUsedAt; used == nil || !used.Equal(now) {
+            t.Errorf("expected last use to be recorded, got %v", used)
+        }
+    })
+
+    t.Run("Expiry is exclusive of the deadline", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        s := testStore(&now)
+
+        expiresAt := now.Add(time.Minute)
+        _, secret, _ := s.Create("short", 1, nil, &expiresAt)
+
+        now = expiresAt.Add(-time.Nanosecond)
+        if _, err := s.Authenticate(secret); err != nil {
+            t.Errorf("expected key to work before expiry, got %v", err)
+        }
+        now = expiresAt
+        if _, err := s.Authenticate(secret); !errors.Is(err, ErrKeyExpired) {
+            t.Errorf("expected key to expire at the deadline, got %v", err)
+        }
+    })
+
+    t.Run("Revoke is idempotent", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        s := testStore(&now)
+
+        key, _, _ := s.Create("ci", 1, nil, nil)
+        first, _ := s.Revoke(key.ID)
+        now = now.Add(time.Hour)
+        second, err := s.Revoke(key.ID)
+        if err != nil || second.RevokedAt == nil || !second.RevokedAt.Equal(*first.RevokedAt) {
+            t.Errorf("expected first revocation time to be kept, got %v, %v", second.RevokedAt, err)
+        }
+        if _, err := s.Revoke("missing"); !errors.Is(err, ErrKeyNotFound) {
+            t.Errorf("expected ErrKeyNotFound, got %v", err)
+        }
+    })
+
+    t.Run("Rotate replaces the key", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        s := testStore(&now)
+
+        expiresAt := now.Add(24 * time.Hour)
+        old, oldSecret, _ := s.Create("ci", 3, []string{ScopeTasksRead, ScopeWebhooks}, &expiresAt)
+
+        key, secret, err := s.Rotate(old.ID)
+        if err != nil {
+            t.Fatalf("expected no error on rotate, got %v", err)
+        }
+        if key.ID == old.ID || secret == oldSecret || key.UserID != 3 || key.Name != "ci" ||
+            len(key.Scopes) != 2 || key.ExpiresAt == nil || !key.ExpiresAt.Equal(expiresAt) {
+            t.Errorf("expected replacement with the same owner, scopes and expiry, got %+v", key)
+        }
+        if key.Lineage() != old.ID || old.Lineage() != old.ID {
+            t.Errorf("expected replacement to keep lineage %s, got %s", old.ID, key.Lineage())
+        }
+        if _, err := s.Authenticate(oldSecret); !errors.Is(err, ErrKeyRevoked) {
+            t.Errorf("expected old key to be revoked, got %v", err)
+        }
+        if got, err := s.Authenticate(secret); err != nil || got.ID != key.ID {
+            t.Errorf("expected new key to authenticate, got %+v, %v", got, err)
+        }
+        if again, _, _ := s.Rotate(key.ID); again.Lineage() != old.ID {
+            t.Errorf("expected lineage to survive repeated rotations, got %s", again.Lineage())
+        }
+
+        if _, _, err := s.Rotate(old.ID); !errors.Is(err, ErrKeyRevoked) {
+            t.Errorf("expected revoked key not to rotate, got %v", err)
+        }
+        if _, _, err := s.Rotate("missing"); !errors.Is(err, ErrKeyNotFound) {
+            t.Errorf("expected ErrKeyNotFound, got %v", err)
+        }
+        now = expiresAt
+        latest, _, _ := s.Create("ci", 3, nil, &expiresAt)
+        if _, _, err := s.Rotate(latest.ID); !errors.Is(err, ErrKeyExpired) {
+            t.Errorf("expected expired key not to rotate, got %v", err)
+        }
+    })
+
+    t.Run("Concurrent rotations leave one live key", func(t *testing.T) {
+        s := NewKeyStore()
+        old, _, _ := s.Create("ci", 1, []string{ScopeTasksRead}, nil)
+
+        const workers = 8
+        var wg sync.WaitGroup
+        errs := make(chan error, workers)
+        start := make(chan struct{})
+        for i := 0; i < workers; i++ {
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                <-start
+                _, _, err := s.Rotate(old.ID)
+                errs <- err
+            }()
+        }
+        close(start)
+        wg.Wait()
+        close(errs)
+
+        succeeded := 0
+        for err := range errs {
+            if err == nil {
+                succeeded++
+            } else if !errors.Is(err, ErrKeyRevoked) {
+                t.Errorf("expected ErrKeyRevoked for losing rotations, got %v", err)
+            }
+        }
+
+        live := 0
+        for _, key := range s.List() {
+            if key.RevokedAt == nil {
+                live++
+            }
+        }
+        if succeeded != 1 || live != 1 {
+            t.Errorf("expected one successful rotation and one live key, got %d and %d", succeeded, live)
+        }
+    })
+}
+
+func TestPrincipalScopes(t *testing.T) {
+    tests := []struct {
+        scopes   []string
+        required string
+        want     bool
+    }{
+        {[]string{ScopeTasksRead}, ScopeTasksRead, true},
+        {[]string{ScopeTasksRead}, ScopeTasksWrite, false},
+        {[]string{ScopeExternalAll}, ScopeExternalWrite, true},
+        {[]string{ScopeExternalAll}, ScopeTasksRead, false},
+        {[]string{ScopeAll}, ScopeKeysAdmin, true},
+        {nil, ScopeTasksRead, false},
+    }
+    for _, tt := range tests {
+        key := APIKey{Scopes: tt.scopes}
+        if got := key.Principal().HasScope(tt.required); got != tt.want {
+            t.Errorf("scopes %v, required %s: expected %v, got %v", tt.scopes, tt.required, tt.want, got)
+        }
+    }
+}
+
+func mustGet(t *testing.T, s *KeyStore, id string) APIKey {
+    t.Helper()
+    key, err := s.Get(id)
+    if err != nil {
+        t.Fatalf("expected key %s, got %v", id, err)
+    }
+    return key
+}
+
+func TestLoadKeys(t *testing.T) {
+    s := NewKeyStore()
+    if err := LoadKeys(s, "secret12345=1:default, ops-key=2:ops:keys:admin+tasks:read"); err != nil {
+        t.Fatalf("expected no error, got %v", err)
+    }
+
+    demo, err := s.Authenticate("secret12345")
+    if err != nil || demo.UserID != 1 || demo.Name != "default" {
+        t.Fatalf("unexpected demo key %+v, %v", demo, err)
+    }
+    if p := demo.Principal(); p.HasScope(ScopeKeysAdmin) || !p.HasScope(ScopeTasksWrite) || !p.HasScope(ScopeExternalWrite) {
+        t.Errorf("expected env key without scopes to get task and external scopes, got %v", demo.Scopes)
+    }
+    ops, err := s.Authenticate("ops-key")
+    if err != nil || ops.Name != "ops" || !ops.Principal().HasScope(ScopeKeysAdmin) || len(ops.Scopes) != 2 {
+        t.Errorf("expected explicit scopes, got %+v, %v", ops, err)
+    }
+
+    for _, spec := range []string{
+        "nokey",
+        "=1:x",
+        "k=0:x",
+        "k=abc:x",
+        "k=1:x:keys:root",
+        "k=1:x:",
+        "k=1:x:tasks:read+",
+        "k=1:x, k=2:y",
+    } {
+        if err := LoadKeys(NewKeyStore(), spec); err == nil {
+            t.Errorf("expected LoadKeys(%q) to fail", spec)
+        }
+    }
+    if _, err := s.Import("ops-key", "again", 3, nil); !errors.Is(err, ErrKeyExists) {
+        t.Errorf("expected ErrKeyExists for a registered key, got %v", err)
+    }
+}
@@ -0,0 +1,400 @@
+package config
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "task-api/internal/audit"
+    "task-api/internal/auth"
+    "task-api/internal/events"
+    "task-api/internal/external"
+    "task-api/internal/ratelimit"
+    "task-api/internal/recurrence"
+    "task-api/internal/storage"
+    "task-api/internal/webhooks"
+    "time"
+)
+
+//DefaultAPIKeys - демо-ключ для локального запуска, в проде задается через API_KEYS
+const DefaultAPIKeys = "secret12345=1:default"
+
+//Config - итоговая конфигурация сервиса. Порядок источников: значения по
+//умолчанию, файл (YAML или JSON), переменные окружения, флаги командной строки.
+type Config struct {
+    Server    ServerConfig    `json:"server"`
+    Log       LogConfig       `json:"log"`
+    Store     StoreConfig     `json:"store"`
+    External  ExternalConfig  `json:"external"`
+    Health    HealthConfig    `json:"health"`
+    Events    EventsConfig    `json:"events"`
+    Webhooks  WebhooksConfig  `json:"webhooks"`
+    Audit     AuditConfig     `json:"audit"`
+    Schedule  ScheduleConfig  `json:"schedule"`
+    RateLimit RateLimitConfig `json:"rate_limit"`
+    Auth      AuthConfig      `json:"auth"`
+}
+
+type ServerConfig struct {
+    Port              int      `json:"port"`
+    ReadTimeout       Duration `json:"read_timeout"`
+    ReadHeaderTimeout Duration `json:"read_header_timeout"`
+    WriteTimeout      Duration `json:"write_timeout"`
+    IdleTimeout       Duration `json:"idle_timeout"`
+    MaxHeaderBytes    int      `json:"max_header_bytes"`
+    MaxBodyBytes      int64    `json:"max_body_bytes"`
+    ShutdownGrace     Duration `json:"shutdown_grace"`
+    DrainDelay        Duration `json:"drain_delay"`
+}
+
+type LogConfig struct {
+    Level  string `json:"level"`
+    Format string `json:"format"`
+}
+
+type StoreConfig struct {
+    Backend      string `json:"backend"`
+    Path         string `json:"path"`
+    CompactEvery int    `json:"compact_every"`
+}
+
+type ExternalConfig struct {
+    BaseURL          string   `json:"base_url"`
+    Timeout          Duration `json:"timeout"`
+    MaxRetries       int      `json:"max_retries"`
+    CacheTTL         Duration `json:"cache_ttl"`
+    CacheMaxStale    Duration `json:"cache_max_stale"`
+    BreakerThreshold int      `json:"breaker_threshold"`
+    BreakerCooldown  Duration `json:"breaker_cooldown"`
+    MaxResponseBytes int64    `json:"max_response_bytes"`
+}
+
+type HealthConfig struct {
+    CheckTimeout Duration `json:"check_timeout"`
+}
+
+type EventsConfig struct {
+    //BufferSize - сколько последних событий хранится для возобновления по Last-Event-ID
+    BufferSize int      `json:"buffer_size"`
+    Heartbeat  Duration `json:"heartbeat"`
+}
+
+type WebhooksConfig struct {
+    Workers     int      `json:"workers"`
+    QueueSize   int      `json:"queue_size"`
+    MaxAttempts int      `json:"max_attempts"`
+    Timeout     Duration `json:"timeout"`
+    BaseBackoff Duration `json:"base_backoff"`
+    MaxBackoff  Duration `json:"max_backoff"`
+    //AllowPrivateTargets разрешает доставку на внутренние адреса, нужен для локальной разработки
+    AllowPrivateTargets bool `json:"allow_private_targets"`
+}
+
+type AuditConfig struct {
+    //Path - JSONL-файл истории задач, пустой - история живет только в памяти
+    Path              string `json:"path"`
+    MaxEntriesPerTask int    `json:"max_entries_per_task"`
+    CompactEvery      int    `json:"compact_every"`
+}
+
+type ScheduleConfig struct {
+    //Interval - как часто планировщик создает наступившие вхождения повторяющихся задач
+    Interval Duration `json:"interval"`
+}
+
+type RateLimitConfig struct {
+    Enabled    bool   `json:"enabled"`
+    //Scopes - запросов в минуту на ключ по скоупу маршрута: tasks:read=600,...
+    Scopes     string `json:"scopes"`
+    //Default - для скоупов, которых нет в Scopes; Anonymous - по IP без ключа
+    Default    int    `json:"default"`
+    Anonymous  int    `json:"anonymous"`
+    //DailyQuota - запросов на ключ за сутки UTC, 0 - без квоты
+    DailyQuota int    `json:"daily_quota"`
+}
+
+type AuthConfig struct {
+    //APIKeys в формате key=userId:name[:scope+scope],... - секрет, в --print-config маскируется
+    APIKeys string `json:"api_keys"`
+}
+
+func Default() Config {
+    ext := external.DefaultConfig()
+    hooks := webhooks.DefaultConfig()
+    return Config{
+        Server: ServerConfig{
+            Port:              8080,
+            ReadTimeout:       Duration(15 * time.Second),
+            ReadHeaderTimeout: Duration(5 * time.Second),
+            WriteTimeout:      Duration(30 * time.Second),
+            IdleTimeout:       Duration(120 * time.Second),
+            MaxHeaderBytes:    64 << 10,
+            MaxBodyBytes:      1 << 20,
+            ShutdownGrace:     Duration(15 * time.Second),
+        },
+        Log: LogConfig{
+            Level:  "info",
+            Format: "text",
+        },
+        Store: StoreConfig{
+            Backend:      "memory",
+            Path:         "tasks.log",
+            CompactEvery: storage.DefaultCompactEvery,
+        },
+        External: ExternalConfig{
+            BaseURL:          ext.BaseURL,
+            Timeout:          Duration(ext.Timeout),
+            MaxRetries:       ext.MaxRetries,
+            CacheTTL:         Duration(ext.CacheTTL),
+            CacheMaxStale:    Duration(ext.CacheMaxStale),
+            BreakerThreshold: ext.BreakerThreshold,
+            BreakerCooldown:  Duration(ext.BreakerCooldown),
+            MaxResponseBytes: ext.MaxResponseBytes,
+        },
+        Health: HealthConfig{
+            CheckTimeout: Duration(2 * time.Second),
+        },
+        Events: EventsConfig{
+            BufferSize: events.DefaultBufferSize,
+            Heartbeat:  Duration(15 * time.Second),
+        },
+        Webhooks: WebhooksConfig{
+            Workers:     hooks.Workers,
+            QueueSize:   hooks.QueueSize,
+            MaxAttempts: hooks.MaxAttempts,
+            Timeout:     Duration(hooks.Timeout),
+            BaseBackoff: Duration(hooks.BaseBackoff),
+            MaxBackoff:  Duration(hooks.MaxBackoff),
+        },
+        Audit: AuditConfig{
+            MaxEntriesPerTask: audit.DefaultMaxEntriesPerTask,
+            CompactEvery:      audit.DefaultCompactEvery,
+        },
+        Schedule: ScheduleConfig{
+            Interval: Duration(recurrence.DefaultInterval),
+        },
+        RateLimit: RateLimitConfig{
+            Enabled:   true,
+            Scopes:    ratelimit.DefaultScopes,
+            Default:   ratelimit.DefaultPerMinute,
+            Anonymous: ratelimit.DefaultAnonymous,
+        },
+        Auth: AuthConfig{
+            APIKeys: DefaultAPIKeys,
+        },
+    }
+}
+
+//Addr - адрес для http.Server
+func (c Config) Addr() string {
+    return ":" + strconv.Itoa(c.Server.Port)
+}
+
+//Validate проверяет конфигурацию целиком и возвращает все найденные проблемы сразу
+func (c Config) Validate() error {
+    var problems []string
+    fail := func(key, format string, args ...interface{}) {
+        problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+    }
+
+    if c.Server.Port < 1 || c.Server.Port > 65535 {
+        fail("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+    }
+    for key, d := range map[string]Duration{
+        "server.read_timeout":        c.Server.ReadTimeout,
+        "server.read_header_timeout": c.Server.ReadHeaderTimeout,
+        "server.write_timeout":       c.Server.WriteTimeout,
+        "server.idle_timeout":        c.Server.IdleTimeout,
+        "server.drain_delay":         c.Server.DrainDelay,
+        "external.cache_ttl":         c.External.CacheTTL,
+        "external.cache_max_stale":   c.External.CacheMaxStale,
+    } {
+        if d < 0 {
+            fail(key, "must not be negative, got %s", d)
+        }
+    }
+    for key, d := range map[string]Duration{
+        "server.shutdown_grace":     c.Server.ShutdownGrace,
+        "external.timeout":          c.External.Timeout,
+        "external.breaker_cooldown": c.External.BreakerCooldown,
+        "health.check_timeout":      c.Health.CheckTimeout,
+        "events.heartbeat":          c.Events.Heartbeat,
+        "webhooks.timeout":          c.Webhooks.Timeout,
+        "webhooks.base_backoff":     c.Webhooks.BaseBackoff,
+        "webhooks.max_backoff":      c.Webhooks.MaxBackoff,
+        "schedule.interval":         c.Schedule.Interval,
+    } {
+        if d <= 0 {
+            fail(key, "must be positive, got %s", d)
+        }
+    }
+    if c.Server.MaxHeaderBytes <= 0 {
+        fail("server.max_header_bytes", "must be positive, got %d", c.Server.MaxHeaderBytes)
+    }
+    if c.Server.MaxBodyBytes < 0 {
+        fail("server.max_body_bytes", "must not be negative (0 disables the limit), got %d", c.Server.MaxBodyBytes)
+    }
+
+    switch strings.ToLower(c.Log.Level) {
+    case "debug", "info", "warn", "error":
+    default:
+        fail("log.level", "expected debug, info, warn or error, got %q", c.Log.Level)
+    }
+    switch strings.ToLower(c.Log.Format) {
+    case "text", "json":
+    default:
+        fail("log.format", "expected text or json, got %q", c.Log.Format)
+    }
+
+    switch c.Store.Backend {
+    case "memory":
+    case "file":
+        if strings.TrimSpace(c.Store.Path) == "" {
+            fail("store.path", "is required for the file backend")
+        }
+    default:
+        fail("store.backend", "expected memory or file, got %q", c.Store.Backend)
+    }
+    if c.Store.CompactEvery <= 0 {
+        fail("store.compact_every", "must be positive, got %d", c.Store.CompactEvery)
+    }
+
+    if u, err := url.Parse(c.External.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        fail("external.base_url", "expected absolute http(s) URL, got %q", c.External.BaseURL)
+    }
+    if c.External.MaxRetries < 0 {
+        fail("external.max_retries", "must not be negative, got %d", c.External.MaxRetries)
+    }
+    if c.External.BreakerThreshold <= 0 {
+        fail("external.breaker_threshold", "must be positive, got %d", c.External.BreakerThreshold)
+    }
+    if c.External.MaxResponseBytes <= 0 {
+        fail("external.max_response_bytes", "must be positive, got %d", c.External.MaxResponseBytes)
+    }
+
+    if c.Events.BufferSize <= 0 {
+        fail("events.buffer_size", "must be positive, got %d", c.Events.BufferSize)
+    }
+
+    //in-memory хранилище после рестарта раздает ID заново, и старая история
+    //приклеилась бы к чужим задачам
+    if c.Audit.Path != "" && c.Store.Backend != "file" {
+        fail("audit.path", "requires the file store backend")
+    }
+    if c.Audit.MaxEntriesPerTask <= 0 {
+        fail("audit.max_entries_per_task", "must be positive, got %d", c.Audit.MaxEntriesPerTask)
+    }
+    if c.Audit.CompactEvery <= 0 {
+        fail("audit.compact_every", "must be positive, got %d", c.Audit.CompactEvery)
+    }
+
+    for key, n := range map[string]int{
+        "webhooks.workers":      c.Webhooks.Workers,
+        "webhooks.queue_size":   c.Webhooks.QueueSize,
+        "webhooks.max_attempts": c.Webhooks.MaxAttempts,
+    } {
+        if n <= 0 {
+            fail(key, "must be positive, got %d", n)
+        }
+    }
+
+    if _, err := ratelimit.ParseScopes(c.RateLimit.Scopes); err != nil {
+        fail("rate_limit.scopes", "%v", err)
+    }
+    for key, n := range map[string]int{
+        "rate_limit.default":     c.RateLimit.Default,
+        "rate_limit.anonymous":   c.RateLimit.Anonymous,
+        "rate_limit.daily_quota": c.RateLimit.DailyQuota,
+    } {
+        if n < 0 {
+            fail(key, "must not be negative (0 disables the limit), got %d", n)
+        }
+    }
+
+    //без ключей API недоступен, а keys:admin для /admin/keys задается в записи явно
+    if strings.TrimSpace(c.Auth.APIKeys) == "" {
+        fail("auth.api_keys", "at least one key is required")
+    } else if err := auth.LoadKeys(auth.NewKeyStore(), c.Auth.APIKeys); err != nil {
+        fail("auth.api_keys", "%v", err)
+    }
+
+    if len(problems) == 0 {
+        return nil
+    }
+    //map выше обходится в случайном порядке, а сообщения должны быть стабильными
+    sort.Strings(problems)
+    return &Error{Problems: problems}
+}
+
+//Redacted возвращает копию, пригодную для вывода: секретная часть ключей заменена
+func (c Config) Redacted() Config {
+    entries := strings.Split(c.Auth.APIKeys, ",")
+    for i, entry := range entries {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if _, owner, ok := strings.Cut(entry, "="); ok {
+            entries[i] = "[redacted]=" + owner
+        } else {
+            entries[i] = "[redacted]"
+        }
+    }
+    c.Auth.APIKeys = strings.Join(entries, ",")
+    return c
+}
+
+//Error перечисляет все проблемы конфигурации, по одной на строку
+type Error struct {
+    Problems []string
+}
+
+func (e *Error) Error() string {
+    return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+//Duration в файле пишется строкой вида "15s" или "1m30s", голое число - секунды
+type Duration time.Duration
+
+func (d Duration) String() string {
+    return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+    var s string
+    if err := json.Unmarshal(data, &s); err == nil {
+        parsed, err := parseDuration(s, time.Second)
+        if err != nil {
+            return err
+        }
+        *d = parsed
+        return nil
+    }
+
+    var seconds float64
+    if err := json.Unmarshal(data, &seconds); err != nil {
+        return fmt.Errorf("expected duration like \"15s\", got %s", data)
+    }
+    *d = Duration(seconds * float64(time.Second))
+    return nil
+}
+
+//parseDuration понимает "15s" и голое целое число в единицах unit,
+//так старые переменные вроде SHUTDOWN_GRACE_SECONDS=15 продолжают работать
+func parseDuration(s string, unit time.Duration) (Duration, error) {
+    s = strings.TrimSpace(s)
+    if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+        return Duration(time.Duration(n) * unit), nil
+    }
+    d, err := time.ParseDuration(s)
+    if err != nil {
+        return 0, fmt.Errorf("expected duration like \"15s\", got %q", s)
+    }
+    return Duration(d), nil
+}
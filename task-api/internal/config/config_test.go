@@ -0,0 +1,163 @@
+package config
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+    return func(key string) (string, bool) {
+        value, ok := vars[key]
+        return value, ok
+    }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestLoad(t *testing.T) {
+    t.Run("Defaults are valid", func(t *testing.T) {
+        cfg, _, err := Load(nil, env(nil))
+        if err != nil {
+            t.Fatalf("expected no error, got %v", err)
+        }
+        if cfg.Addr() != ":8080" || cfg.Store.Backend != "memory" {
+            t.Errorf("unexpected defaults: %+v", cfg)
+        }
+    })
+
+    t.Run("Precedence is file, env, flags", func(t *testing.T) {
+        path := writeFile(t, "config.yaml", `
+# comment
+server:
+  port: 9000            # inline comment
+  write_timeout: 45s
+log:
+  level: debug
+  format: "json"
+external:
+  base_url: https://example.com/api
+`)
+
+        cfg, opts, err := Load(
+            []string{"--config", path, "--log.level", "warn"},
+            env(map[string]string{"SERVER_PORT": "9100", "HEALTH_CHECK_TIMEOUT_MS": "250"}),
+        )
+        if err != nil {
+            t.Fatalf("expected no error, got %v", err)
+        }
+        if opts.ConfigFile != path {
+            t.Errorf("expected config file %s, got %s", path, opts.ConfigFile)
+        }
+        if cfg.Server.Port != 9100 {
+            t.Errorf("expected env to override file port, got %d", cfg.Server.Port)
+        }
+        if cfg.Log.Level != "warn" || cfg.Log.Format != "json" {
+            t.Errorf("expected flag level and file format, got %+v", cfg.Log)
+        }
+        if time.Duration(cfg.Server.WriteTimeout) != 45*time.Second {
+            t.Errorf("expected write timeout from file, got %s", cfg.Server.WriteTimeout)
+        }
+        if time.Duration(cfg.Health.CheckTimeout) != 250*time.Millisecond {
+            t.Errorf("expected legacy millisecond env, got %s", cfg.Health.CheckTimeout)
+        }
+        if cfg.External.BaseURL != "https://example.com/api" {
+            t.Errorf("expected base url from file, got %q", cfg.External.BaseURL)
+        }
+    })
+
+    t.Run("JSON file and CONFIG_FILE env", func(t *testing.T) {
+        path := writeFile(t, "config.json", `{"store": {"backend": "file", "path": "/tmp/x.log"}, "server": {"drain_delay": 3}}`)
+
+        cfg, _, err := Load(nil, env(map[string]string{"CONFIG_FILE": path}))
+        if err != nil {
+            t.Fatalf("expected no error, got %v", err)
+        }
+        if cfg.Store.Backend != "file" || time.Duration(cfg.Server.DrainDelay) != 3*time.Second {
+            t.Errorf("unexpected config: %+v", cfg)
+        }
+    })
+
+    t.Run("Reports all problems at once", func(t *testing.T) {
+        path := writeFile(t, "config.yaml", "store:\n  backend: sqlite\n")
+
+        _, _, err := Load(
+            []string{"--config", path, "--server.port", "70000"},
+            env(map[string]string{
+                "LOG_LEVEL":                   "loud",
+                "SERVER_WRITE_TIMEOUT":        "soon",
+                "EXTERNAL_API_URL":            "ftp://example.com",
+                "API_KEYS":                    "broken",
+                "RATE_LIMIT_SCOPES":           "tasks:read=fast",
+                "EXTERNAL_MAX_RESPONSE_BYTES": "0",
+                "TASK_AUDIT_COMPACT_EVERY":    "-1",
+            }),
+        )
+
+        var cfgErr *Error
+        if !errors.As(err, &cfgErr) {
+            t.Fatalf("expected *Error, got %v", err)
+        }
+        for _, key := range []string{"server.port", "log.level", "server.write_timeout", "external.base_url", "store.backend", "auth.api_keys", "rate_limit.scopes", "external.max_response_bytes", "audit.compact_every"} {
+            if !strings.Contains(err.Error(), key) {
+                t.Errorf("expected problem for %s, got:\n%v", key, err)
+            }
+        }
+    })
+
+    t.Run("Rejects unknown keys in file", func(t *testing.T) {
+        path := writeFile(t, "config.yaml", "server:\n  prot: 9000\n")
+        if _, _, err := Load([]string{"--config", path}, env(nil)); err == nil || !strings.Contains(err.Error(), "prot") {
+            t.Errorf("expected unknown field error, got %v", err)
+        }
+    })
+
+    t.Run("API keys cannot be passed as flag", func(t *testing.T) {
+        if _, _, err := Load([]string{"--auth.api-keys", "k=1:x"}, env(nil)); err == nil {
+            t.Error("expected error for secret flag")
+        }
+    })
+}
+
+func TestRedacted(t *testing.T) {
+    cfg := Default()
+    cfg.Auth.APIKeys = "supersecret=1:alice, other=2:bob"
+
+    redacted := cfg.Redacted()
+    if strings.Contains(redacted.Auth.APIKeys, "secret") || strings.Contains(redacted.Auth.APIKeys, "other=") {
+        t.Errorf("expected keys to be redacted, got %q", redacted.Auth.APIKeys)
+    }
+    if !strings.Contains(redacted.Auth.APIKeys, "1:alice") {
+        t.Errorf("expected owners to stay visible, got %q", redacted.Auth.APIKeys)
+    }
+    if cfg.Auth.APIKeys != "supersecret=1:alice, other=2:bob" {
+        t.Error("expected original config to stay untouched")
+    }
+}
+
+func TestParseYAML(t *testing.T) {
+    doc, err := parseYAML([]byte("a:\n  b: 'it''s'\n  c: \"x # y\"\nd: 1.5\ne:\n"))
+    if err != nil {
+        t.Fatalf("expected no error, got %v", err)
+    }
+    nested := doc["a"].(map[string]interface{})
+    if nested["b"] != "it's" || nested["c"] != "x # y" || doc["d"] != 1.5 || doc["e"] != nil {
+        t.Errorf("unexpected document: %#v", doc)
+    }
+
+    for _, bad := range []string{"a:\n  - x\n", "a: 1\n   b: 2\n", "a: [1, 2]\n", "a: 1\na: 2\n", "\tb: 1\n"} {
+        if _, err := parseYAML([]byte(bad)); err == nil {
+            t.Errorf("expected error for %q", bad)
+        }
+    }
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+//Options - флаги, которые управляют самим запуском, а не попадают в Config
+type Options struct {
+    ConfigFile  string
+    PrintConfig bool
+}
+
+//setting связывает ключ файла с переменной окружения и флагом.
+//Флаг называется как ключ: server.port -> --server.port.
+type setting struct {
+    key    string
+    env    string
+    usage  string
+    secret bool
+    //unit - единица голого числа для длительностей, по умолчанию секунды
+    unit   time.Duration
+    target interface{}
+}
+
+func settings(c *Config) []setting {
+    return []setting{
+        {key: "server.port", env: "SERVER_PORT", usage: "HTTP listen port", target: &c.Server.Port},
+        {key: "server.read_timeout", env: "SERVER_READ_TIMEOUT", usage: "max time to read a request", target: &c.Server.ReadTimeout},
+        {key: "server.read_header_timeout", env: "SERVER_READ_HEADER_TIMEOUT", usage: "max time to read request headers", target: &c.Server.ReadHeaderTimeout},
+        {key: "server.write_timeout", env: "SERVER_WRITE_TIMEOUT", usage: "max time to write a response", target: &c.Server.WriteTimeout},
+        {key: "server.idle_timeout", env: "SERVER_IDLE_TIMEOUT", usage: "keep-alive idle timeout", target: &c.Server.IdleTimeout},
+        {key: "server.max_header_bytes", env: "SERVER_MAX_HEADER_BYTES", usage: "max size of request headers", target: &c.Server.MaxHeaderBytes},
+        {key: "server.max_body_bytes", env: "SERVER_MAX_BODY_BYTES", usage: "max size of request body, 0 disables", target: &c.Server.MaxBodyBytes},
+        {key: "server.shutdown_grace", env: "SHUTDOWN_GRACE_SECONDS", usage: "time to finish in-flight requests on shutdown", target: &c.Server.ShutdownGrace},
+        {key: "server.drain_delay", env: "SHUTDOWN_DRAIN_DELAY_SECONDS", usage: "time /readyz fails before the listener closes", target: &c.Server.DrainDelay},
+        {key: "log.level", env: "LOG_LEVEL", usage: "debug, info, warn or error", target: &c.Log.Level},
+        {key: "log.format", env: "LOG_FORMAT", usage: "text or json", target: &c.Log.Format},
+        {key: "store.backend", env: "TASK_STORE", usage: "memory or file", target: &c.Store.Backend},
+        {key: "store.path", env: "TASK_STORE_PATH", usage: "task log path for the file backend", target: &c.Store.Path},
+        {key: "store.compact_every", env: "TASK_STORE_COMPACT_EVERY", usage: "compact the task log after this many records", target: &c.Store.CompactEvery},
+        {key: "external.base_url", env: "EXTERNAL_API_URL", usage: "external API base URL", target: &c.External.BaseURL},
+        {key: "external.timeout", env: "EXTERNAL_API_TIMEOUT", usage: "timeout of one external API attempt", target: &c.External.Timeout},
+        {key: "external.max_retries", env: "EXTERNAL_API_MAX_RETRIES", usage: "retries of idempotent external calls", target: &c.External.MaxRetries},
+        {key: "external.cache_ttl", env: "EXTERNAL_CACHE_TTL_SECONDS", usage: "external response cache TTL, 0 disables", target: &c.External.CacheTTL},
+        {key: "external.cache_max_stale", env: "EXTERNAL_CACHE_MAX_STALE", usage: "how long a stale copy may be served", target: &c.External.CacheMaxStale},
+        {key: "external.breaker_threshold", env: "EXTERNAL_BREAKER_THRESHOLD", usage: "consecutive failures that open the circuit", target: &c.External.BreakerThreshold},
+        {key: "external.breaker_cooldown", env: "EXTERNAL_BREAKER_COOLDOWN", usage: "time before a half-open probe", target: &c.External.BreakerCooldown},
+        {key: "external.max_response_bytes", env: "EXTERNAL_MAX_RESPONSE_BYTES", usage: "max size of an external API response body", target: &c.External.MaxResponseBytes},
+        {key: "health.check_timeout", env: "HEALTH_CHECK_TIMEOUT_MS", usage: "timeout of each readiness check", unit: time.Millisecond, target: &c.Health.CheckTimeout},
+        {key: "events.buffer_size", env: "TASK_EVENTS_BUFFER_SIZE", usage: "task events kept for Last-Event-ID resumption", target: &c.Events.BufferSize},
+        {key: "events.heartbeat", env: "TASK_EVENTS_HEARTBEAT", usage: "keep-alive comment interval of /tasks/events", target: &c.Events.Heartbeat},
+        {key: "webhooks.workers", env: "WEBHOOK_WORKERS", usage: "concurrent webhook deliveries", target: &c.Webhooks.Workers},
+        {key: "webhooks.queue_size", env: "WEBHOOK_QUEUE_SIZE", usage: "pending deliveries before new ones are dead-lettered", target: &c.Webhooks.QueueSize},
+        {key: "webhooks.max_attempts", env: "WEBHOOK_MAX_ATTEMPTS", usage: "delivery attempts before dead-lettering", target: &c.Webhooks.MaxAttempts},
+        {key: "webhooks.timeout", env: "WEBHOOK_TIMEOUT", usage: "timeout of one delivery attempt", target: &c.Webhooks.Timeout},
+        {key: "webhooks.base_backoff", env: "WEBHOOK_BASE_BACKOFF", usage: "delay before the first retry, doubled each attempt", target: &c.Webhooks.BaseBackoff},
+        {key: "webhooks.max_backoff", env: "WEBHOOK_MAX_BACKOFF", usage: "upper bound of the retry delay", target: &c.Webhooks.MaxBackoff},
+        {key: "webhooks.allow_private_targets", env: "WEBHOOK_ALLOW_PRIVATE_TARGETS", usage: "allow deliveries to loopback and private networks", target: &c.Webhooks.AllowPrivateTargets},
+        {key: "audit.path", env: "TASK_AUDIT_PATH", usage: "task history file, empty keeps history in memory", target: &c.Audit.Path},
+        {key: "audit.max_entries_per_task", env: "TASK_AUDIT_MAX_ENTRIES", usage: "history entries kept per task, in memory and in the file", target: &c.Audit.MaxEntriesPerTask},
+        {key: "audit.compact_every", env: "TASK_AUDIT_COMPACT_EVERY", usage: "rewrite the history file after this many records", target: &c.Audit.CompactEvery},
+        {key: "schedule.interval", env: "TASK_SCHEDULE_INTERVAL", usage: "how often due occurrences of recurring tasks are created", target: &c.Schedule.Interval},
+        {key: "rate_limit.enabled", env: "RATE_LIMIT_ENABLED", usage: "limit request rate per API key and client IP", target: &c.RateLimit.Enabled},
+        {key: "rate_limit.scopes", env: "RATE_LIMIT_SCOPES", usage: "requests per minute per key by route scope, scope=N,...", target: &c.RateLimit.Scopes},
+        {key: "rate_limit.default", env: "RATE_LIMIT_DEFAULT", usage: "requests per minute per key for other scopes, 0 disables", target: &c.RateLimit.Default},
+        {key: "rate_limit.anonymous", env: "RATE_LIMIT_ANONYMOUS", usage: "requests per minute per client IP without a valid key, 0 disables", target: &c.RateLimit.Anonymous},
+        {key: "rate_limit.daily_quota", env: "RATE_LIMIT_DAILY_QUOTA", usage: "requests per key per UTC day, 0 disables", target: &c.RateLimit.DailyQuota},
+        //ключи не принимаются флагом, чтобы не светиться в списке процессов
+        {key: "auth.api_keys", env: "API_KEYS", usage: "bootstrap keys key=userId:name[:scope+scope],..., tasks and external scopes by default", secret: true, target: &c.Auth.APIKeys},
+    }
+}
+
+func (s setting) flagName() string {
+    return strings.ReplaceAll(s.key, "_", "-")
+}
+
+func (s setting) set(value string) error {
+    switch t := s.target.(type) {
+    case *string:
+        *t = value
+    case *int:
+        n, err := strconv.Atoi(strings.TrimSpace(value))
+        if err != nil {
+            return fmt.Errorf("expected integer, got %q", value)
+        }
+        *t = n
+    case *int64:
+        n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+        if err != nil {
+            return fmt.Errorf("expected integer, got %q", value)
+        }
+        *t = n
+    case *bool:
+        b, err := strconv.ParseBool(strings.TrimSpace(value))
+        if err != nil {
+            return fmt.Errorf("expected true or false, got %q", value)
+        }
+        *t = b
+    case *Duration:
+        unit := s.unit
+        if unit == 0 {
+            unit = time.Second
+        }
+        d, err := parseDuration(value, unit)
+        if err != nil {
+            return err
+        }
+        *t = d
+    default:
+        return fmt.Errorf("unsupported setting type %T", s.target)
+    }
+    return nil
+}
+
+//Load собирает конфигурацию из всех источников. Ошибки разбора и валидации
+//копятся и возвращаются одной *Error; Config при этом все равно заполнен,
+//чтобы --print-config мог показать, что получилось.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, Options, error) {
+    cfg := Default()
+    var opts Options
+    var problems []string
+
+    fs := flag.NewFlagSet("task-api", flag.ContinueOnError)
+    fs.SetOutput(io.Discard)
+    fs.StringVar(&opts.ConfigFile, "config", "", "path to YAML or JSON config file (env CONFIG_FILE)")
+    fs.BoolVar(&opts.PrintConfig, "print-config", false, "print effective config with secrets redacted and exit")
+
+    table := settings(&cfg)
+    flagValues := make(map[string]*string, len(table))
+    for _, s := range table {
+        if s.secret {
+            continue
+        }
+        flagValues[s.flagName()] = fs.String(s.flagName(), "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+    }
+
+    if err := fs.Parse(args); err != nil {
+        if errors.Is(err, flag.ErrHelp) {
+            return cfg, opts, err
+        }
+        return cfg, opts, &Error{Problems: []string{err.Error()}}
+    }
+    if fs.NArg() > 0 {
+        problems = append(problems, fmt.Sprintf("unexpected arguments: %s", strings.Join(fs.Args(), " ")))
+    }
+
+    if opts.ConfigFile == "" {
+        opts.ConfigFile, _ = lookupEnv("CONFIG_FILE")
+    }
+    if opts.ConfigFile != "" {
+        if err := loadFile(opts.ConfigFile, &cfg); err != nil {
+            problems = append(problems, err.Error())
+        }
+    }
+
+    for _, s := range table {
+        if value, ok := lookupEnv(s.env); ok {
+            if err := s.set(value); err != nil {
+                problems = append(problems, fmt.Sprintf("%s (env %s): %v", s.key, s.env, err))
+            }
+        }
+    }
+
+    //флаги применяются последними и только те, что явно заданы
+    fs.Visit(func(f *flag.Flag) {
+        value, ok := flagValues[f.Name]
+        if !ok {
+            return
+        }
+        for _, s := range table {
+            if s.flagName() == f.Name {
+                if err := s.set(*value); err != nil {
+                    problems = append(problems, fmt.Sprintf("%s (flag --%s): %v", s.key, f.Name, err))
+                }
+            }
+        }
+    })
+
+    if err := cfg.Validate(); err != nil {
+        var cfgErr *Error
+        if errors.As(err, &cfgErr) {
+            problems = append(problems, cfgErr.Problems...)
+        }
+    }
+    if len(problems) > 0 {
+        return cfg, opts, &Error{Problems: problems}
+    }
+    return cfg, opts, nil
+}
+
+//Usage печатает флаги вместе с переменными окружения, которые им соответствуют
+func Usage(w io.Writer) {
+    cfg := Default()
+    fmt.Fprintln(w, "Usage: task-api [flags]")
+    fmt.Fprintln(w, "\nPrecedence: defaults < config file < environment < flags")
+    fmt.Fprintln(w, "\n  --config string     path to YAML or JSON config file (env CONFIG_FILE)")
+    fmt.Fprintln(w, "  --print-config      print effective config with secrets redacted and exit")
+
+    table := settings(&cfg)
+    sort.SliceStable(table, func(i, j int) bool { return table[i].key < table[j].key })
+    for _, s := range table {
+        if s.secret {
+            fmt.Fprintf(w, "  (env %s only)  %s\n", s.env, s.usage)
+            continue
+        }
+        fmt.Fprintf(w, "  --%s  %s (env %s)\n", s.flagName(), s.usage, s.env)
+    }
+}
+
+//loadFile читает файл конфигурации. Формат выбирается по расширению,
+//неизвестные ключи считаются ошибкой, чтобы опечатки не терялись молча.
+func loadFile(path string, cfg *Config) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("config file: %w", err)
+    }
+
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".json":
+    case ".yaml", ".yml":
+        doc, err := parseYAML(data)
+        if err != nil {
+            return fmt.Errorf("config file %s: %w", path, err)
+        }
+        if data, err = json.Marshal(doc); err != nil {
+            return fmt.Errorf("config file %s: %w", path, err)
+        }
+    default:
+        return fmt.Errorf("config file %s: unsupported extension, expected .yaml, .yml or .json", path)
+    }
+
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(cfg); err != nil {
+        return fmt.Errorf("config file %s: %w", path, err)
+    }
+    return nil
+}
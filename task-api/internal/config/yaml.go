@@ -0,0 +1,155 @@
+package config
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+//parseYAML разбирает подмножество YAML, которого хватает для файла конфигурации:
+//вложенные отображения через отступы, скаляры, кавычки и комментарии.
+//Списки, якоря и многострочные значения не поддерживаются.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+    var lines []yamlLine
+    for i, raw := range strings.Split(string(data), "\n") {
+        raw = strings.TrimRight(raw, " \r")
+        body := strings.TrimLeft(raw, " ")
+        if body == "" || strings.HasPrefix(body, "#") || body == "---" {
+            continue
+        }
+        if strings.HasPrefix(body, "\t") {
+            return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+        }
+        if strings.HasPrefix(body, "- ") || body == "-" {
+            return nil, fmt.Errorf("line %d: sequences are not supported", i+1)
+        }
+        lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(body), text: body})
+    }
+
+    p := &yamlParser{lines: lines}
+    doc, err := p.parseMap(0)
+    if err != nil {
+        return nil, err
+    }
+    if p.pos < len(p.lines) {
+        return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+    }
+    return doc, nil
+}
+
+type yamlLine struct {
+    num    int
+    indent int
+    text   string
+}
+
+type yamlParser struct {
+    lines []yamlLine
+    pos   int
+}
+
+func (p *yamlParser) parseMap(indent int) (map[string]interface{}, error) {
+    out := make(map[string]interface{})
+    for p.pos < len(p.lines) {
+        line := p.lines[p.pos]
+        if line.indent < indent {
+            break
+        }
+        if line.indent > indent {
+            return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+        }
+
+        key, rest, ok := strings.Cut(line.text, ":")
+        if !ok || (rest != "" && rest[0] != ' ') {
+            return nil, fmt.Errorf("line %d: expected \"key: value\"", line.num)
+        }
+        key = strings.TrimSpace(key)
+        if unquoted, err := unquoteYAML(key); err == nil {
+            key = unquoted
+        }
+        if _, dup := out[key]; dup {
+            return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+        }
+        p.pos++
+
+        value := stripComment(strings.TrimSpace(rest))
+        if value != "" {
+            scalar, err := parseScalar(value)
+            if err != nil {
+                return nil, fmt.Errorf("line %d: %w", line.num, err)
+            }
+            out[key] = scalar
+            continue
+        }
+
+        //пустое значение - либо вложенное отображение, либо null
+        if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+            nested, err := p.parseMap(p.lines[p.pos].indent)
+            if err != nil {
+                return nil, err
+            }
+            out[key] = nested
+        } else {
+            out[key] = nil
+        }
+    }
+    return out, nil
+}
+
+//stripComment отрезает " # ..." вне кавычек
+func stripComment(s string) string {
+    var quote byte
+    for i := 0; i < len(s); i++ {
+        switch c := s[i]; {
+        case quote != 0:
+            if c == '\\' && quote == '"' {
+                i++
+            } else if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == '#' && (i == 0 || s[i-1] == ' '):
+            return strings.TrimSpace(s[:i])
+        }
+    }
+    return s
+}
+
+func parseScalar(s string) (interface{}, error) {
+    if s[0] == '"' || s[0] == '\'' {
+        return unquoteYAML(s)
+    }
+    if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") || strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">") {
+        return nil, fmt.Errorf("flow collections and block scalars are not supported")
+    }
+
+    switch s {
+    case "true", "True", "TRUE":
+        return true, nil
+    case "false", "False", "FALSE":
+        return false, nil
+    case "null", "Null", "NULL", "~":
+        return nil, nil
+    }
+    if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+        return n, nil
+    }
+    if f, err := strconv.ParseFloat(s, 64); err == nil {
+        return f, nil
+    }
+    return s, nil
+}
+
+func unquoteYAML(s string) (string, error) {
+    if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+        return strconv.Unquote(s)
+    }
+    if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+        return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+    }
+    if s != "" && (s[0] == '"' || s[0] == '\'') {
+        return "", fmt.Errorf("unterminated quoted string %s", s)
+    }
+    return s, nil
+}
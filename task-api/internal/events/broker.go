@@ -0,0 +1,160 @@
+package events
+
+import (
+    "sync"
+    "task-api/internal/models"
+    "time"
+)
+
+const (
+    DefaultBufferSize = 1024
+    //subscriberBuffer - сколько событий может отстать один клиент, прежде чем его отключат
+    subscriberBuffer = 64
+)
+
+//Broker раздает события задач подписчикам и держит последние события в
+//кольцевом буфере, чтобы переподключившийся клиент мог дочитать пропущенное.
+type Broker struct {
+    mu     sync.Mutex
+    ring   []models.TaskEvent
+    start  int
+    count  int
+    nextID uint64
+    subs   map[*Subscription]struct{}
+    closed bool
+    now    func() time.Time
+}
+
+//Subscription - поток событий одного владельца. Events закрывается, если
+//подписчик не успевает читать или брокер остановлен; клиенту стоит
+//переподключиться с Last-Event-ID.
+type Subscription struct {
+    Events <-chan models.TaskEvent
+    //Backlog - события из буфера после запрошенного ID
+    Backlog []models.TaskEvent
+    //Gap означает, что часть событий после запрошенного ID уже вытеснена из буфера
+    Gap bool
+
+    ownerID int
+    ch      chan models.TaskEvent
+    broker  *Broker
+}
+
+func NewBroker(size int) *Broker {
+    if size <= 0 {
+        size = DefaultBufferSize
+    }
+    return &Broker{
+        ring: make([]models.TaskEvent, size),
+        //ID начинаются с текущего времени в микросекундах, поэтому после
+        //рестарта они не пересекаются со старыми и Last-Event-ID не путается
+        nextID: uint64(time.Now().UnixMicro()),
+        subs:   make(map[*Subscription]struct{}),
+        now:    time.Now,
+    }
+}
+
+//Publish подходит как storage.ChangeListener: не блокируется на медленных подписчиках
+func (b *Broker) Publish(change models.TaskChange) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if b.closed {
+        return
+    }
+
+    b.nextID++
+    event := models.TaskEvent{
+        ID:         b.nextID,
+        Type:       change.Type,
+        Task:       change.Task,
+        OccurredAt: b.now().UTC(),
+    }
+
+    if b.count < len(b.ring) {
+        b.ring[(b.start+b.count)%len(b.ring)] = event
+        b.count++
+    } else {
+        b.ring[b.start] = event
+        b.start = (b.start + 1) % len(b.ring)
+    }
+
+    for sub := range b.subs {
+        if sub.ownerID != change.Task.UserID {
+            continue
+        }
+        select {
+        case sub.ch <- event:
+        default:
+            //отстающий клиент отключается и дочитает события из буфера при переподключении
+            b.dropLocked(sub)
+        }
+    }
+}
+
+//Subscribe подписывает владельца на события. Если resume=true, в Backlog
+//попадают его события с ID больше lastID.
+func (b *Broker) Subscribe(ownerID int, lastID uint64, resume bool) (*Subscription, bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if b.closed {
+        return nil, false
+    }
+
+    ch := make(chan models.TaskEvent, subscriberBuffer)
+    sub := &Subscription{Events: ch, ownerID: ownerID, ch: ch, broker: b}
+
+    if resume {
+        oldest := b.nextID + 1
+        if b.count > 0 {
+            oldest = b.ring[b.start].ID
+        }
+        //ID из будущего - клиент помнит прошлый запуск с другим отсчетом
+        sub.Gap = lastID+1 < oldest || lastID > b.nextID
+
+        if !sub.Gap {
+            for i := 0; i < b.count; i++ {
+                event := b.ring[(b.start+i)%len(b.ring)]
+                if event.ID > lastID && event.Task.UserID == ownerID {
+                    sub.Backlog = append(sub.Backlog, event)
+                }
+            }
+        }
+    }
+
+    b.subs[sub] = struct{}{}
+    return sub, true
+}
+
+//Close отписывает подписчика, повторный вызов безопасен
+func (s *Subscription) Close() {
+    s.broker.mu.Lock()
+    defer s.broker.mu.Unlock()
+    s.broker.dropLocked(s)
+}
+
+func (b *Broker) dropLocked(sub *Subscription) {
+    if _, ok := b.subs[sub]; ok {
+        delete(b.subs, sub)
+        close(sub.ch)
+    }
+}
+
+//Subscribers - число открытых потоков, для метрик
+func (b *Broker) Subscribers() int {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return len(b.subs)
+}
+
+//Close завершает все потоки, чтобы остановка сервера не ждала их до таймаута
+func (b *Broker) Close() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.closed = true
+    for sub := range b.subs {
+        b.dropLocked(sub)
+    }
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+    "testing"
+
+    "task-api/internal/models"
+)
+
+func TestBroker(t *testing.T) {
+    t.Run("Delivers only the owner's events", func(t *testing.T) {
+        b := NewBroker(10)
+        sub, _ := b.Subscribe(1, 0, false)
+        defer sub.Close()
+
+        b.Publish(models.TaskChange{Type: models.TaskCreated, Task: models.Task{ID: 1, UserID: 2}})
+        b.Publish(models.TaskChange{Type: models.TaskCreated, Task: models.Task{ID: 2, UserID: 1}})
+
+        event := <-sub.Events
+        if event.Task.ID != 2 || event.Type != models.TaskCreated {
+            t.Errorf("expected event for own task 2, got %+v", event)
+        }
+        if len(sub.Events) != 0 {
+            t.Errorf("expected no foreign events, got %d queued", len(sub.Events))
+        }
+    })
+
+    t.Run("Resumes after Last-Event-ID", func(t *testing.T) {
+        b := NewBroker(10)
+        b.Publish(models.TaskChange{Type: models.TaskCreated, Task: models.Task{ID: 1, UserID: 1}})
+        first := b.nextID
+        b.Publish(models.TaskChange{Type: models.TaskUpdated, Task: models.Task{ID: 1, UserID: 1}})
+        b.Publish(models.TaskChange{Type: models.TaskCreated, Task: models.Task{ID: 2, UserID: 2}})
+        b.Publish(models.TaskChange{Type: models.TaskDeleted, Task: models.Task{ID: 1, UserID: 1}})
+
+        sub, _ := b.Subscribe(1, first, true)
+        defer sub.Close()
+
+        if sub.Gap {
+            t.Error("expected no gap")
+        }
+        if len(sub.Backlog) != 2 || sub.Backlog[0].Type != models.TaskUpdated || sub.Backlog[1].Type != models.TaskDeleted {
+            t.Errorf("expected updated and deleted in backlog, got %+v", sub.Backlog)
+        }
+    })
+
+    t.Run("Reports gap when ring overflowed", func(t *testing.T) {
+        b := NewBroker(2)
+        b.Publish(models.TaskChange{Type: models.TaskCreated, Task: models.Task{ID: 1, UserID: 1}})
+        first := b.nextID
+        for i := 0; i < 3; i++ {
+            b.Publish(models.TaskChange{Type: models.TaskUpdated, Task: models.Task{ID: 1, UserID: 1}})
+        }
+
+        sub, _ := b.Subscribe(1, first, true)
+        defer sub.Close()
+        if !sub.Gap || len(sub.Backlog) != 0 {
+            t.Errorf("expected gap without backlog, got gap=%v backlog=%d", sub.Gap, len(sub.Backlog))
+        }
+
+        future, _ := b.Subscribe(1, b.nextID+100, true)
+        defer future.Close()
+        if !future.Gap {
+            t.Error("expected gap for id from another run")
+        }
+    })
+
+    t.Run("Drops slow subscribers", func(t *testing.T) {
+        b := NewBroker(10)
+        sub, _ := b.Subscribe(1, 0, false)
+
+        for i := 0; i < subscriberBuffer+1; i++ {
+            b.Publish(models.TaskChange{Type: models.TaskUpdated, Task: models.Task{ID: 1, UserID: 1}})
+        }
+
+        received := 0
+        for range sub.Events {
+            received++
+        }
+        if received != subscriberBuffer || b.Subscribers() != 0 {
+            t.Errorf("expected %d buffered events and closed stream, got %d, subscribers=%d", subscriberBuffer, received, b.Subscribers())
+        }
+        sub.Close()
+    })
+
+    t.Run("Close ends streams and refuses new ones", func(t *testing.T) {
+        b := NewBroker(10)
+        sub, _ := b.Subscribe(1, 0, false)
+        b.Close()
+
+        if _, open := <-sub.Events; open {
+            t.Error("expected stream to be closed")
+        }
+        if _, ok := b.Subscribe(1, 0, false); ok {
+            t.Error("expected subscribe to fail after close")
+        }
+    })
+}
@@ -2,77 +2,385 @@ package external
 
 import (
     "bytes"
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
+    "math/rand"
     "net/http"
+    "strconv"
+    "strings"
     "task-api/internal/models"
+    "task-api/internal/tracing"
     "time"
 )
 
+const DefaultBaseURL = "https://jsonplaceholder.typicode.com"
+
+//DefaultMaxResponseBytes с запасом вмещает /todos: 200 записей занимают около 25 КБ
+const DefaultMaxResponseBytes = 4 << 20
+
+//ErrResponseTooLarge - апстрим прислал тело больше Config.MaxResponseBytes.
+//Такой ответ не повторяется: следующий будет таким же.
+var ErrResponseTooLarge = errors.New("upstream response too large")
+
+type Config struct {
+    BaseURL          string
+    Timeout          time.Duration
+    MaxRetries       int
+    BaseBackoff      time.Duration
+    MaxBackoff       time.Duration
+    BreakerThreshold int
+    BreakerCooldown  time.Duration
+    CacheTTL         time.Duration
+    CacheMaxStale    time.Duration
+    //MaxResponseBytes ограничивает тело ответа апстрима, больший ответ - ErrResponseTooLarge
+    MaxResponseBytes int64
+    //Observer, если задан, получает исход каждой попытки, например для метрик
+    Observer CallObserver
+}
+
+//CallObserver получает операцию вида "GET /todos", исход попытки и ее длительность
+type CallObserver func(operation, outcome string, duration time.Duration)
+
+const (
+    OutcomeSuccess       = "success"
+    OutcomeNotModified   = "not_modified"
+    OutcomeClientError   = "client_error"
+    OutcomeUpstreamError = "upstream_error"
+    OutcomeNetworkError  = "network_error"
+    OutcomeCircuitOpen   = "circuit_open"
+    OutcomeCanceled      = "canceled"
+)
+
+func DefaultConfig() Config {
+    return Config{
+        BaseURL:          DefaultBaseURL,
+        Timeout:          10 * time.Second,
+        MaxRetries:       3,
+        BaseBackoff:      200 * time.Millisecond,
+        MaxBackoff:       5 * time.Second,
+        BreakerThreshold: 5,
+        BreakerCooldown:  30 * time.Second,
+        CacheTTL:         30 * time.Second,
+        CacheMaxStale:    10 * time.Minute,
+        MaxResponseBytes: DefaultMaxResponseBytes,
+    }
+}
+
+//UpstreamStatusError - апстрим ответил неожиданным статусом
+type UpstreamStatusError struct {
+    StatusCode int
+}
+
+func (e *UpstreamStatusError) Error() string {
+    return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
 type APIClient struct {
-    client *http.Client
+    client  *http.Client
+    cfg     Config
+    breaker *circuitBreaker
+    cache   *responseCache
+}
+
+type upstreamResponse struct {
+    status int
+    body   []byte
+    header http.Header
 }
 
-func NewAPIClient() *APIClient {
-    return &APIClient{
+func NewAPIClient(cfg Config) *APIClient {
+    cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+    if cfg.BaseURL == "" {
+        cfg.BaseURL = DefaultBaseURL
+    }
+    if cfg.MaxResponseBytes <= 0 {
+        cfg.MaxResponseBytes = DefaultMaxResponseBytes
+    }
+
+    c := &APIClient{
         client: &http.Client{
-            Timeout: 10 * time.Second,
+            Timeout: cfg.Timeout,
         },
+        cfg:     cfg,
+        breaker: newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
     }
+    //CacheTTL <= 0 отключает кэш
+    if cfg.CacheTTL > 0 {
+        c.cache = newResponseCache(cfg.CacheTTL, cfg.CacheMaxStale)
+    }
+    return c
 }
 
-//получает задачи с внешнего апи
-func (c *APIClient) GetExternalTodos() ([]models.ExternalTodo, error) {
-    resp, err := c.client.Get("https://jsonplaceholder.typicode.com/todos")
+//CacheStats отдает счетчики кэша, при выключенном кэше - нули
+func (c *APIClient) CacheStats() CacheStats {
+    if c.cache == nil {
+        return CacheStats{}
+    }
+    return c.cache.stats()
+}
+
+func (c *APIClient) BaseURL() string {
+    return c.cfg.BaseURL
+}
+
+//BreakerState отдает состояние брейкера: closed, open или half-open
+func (c *APIClient) BreakerState() string {
+    return c.breaker.State()
+}
+
+//Ping проверяет, что апстрим отвечает. Идет мимо брейкера и ретраев, чтобы
+//пробы не влияли на реальный трафик; любой ответ ниже 500 считается доступностью.
+func (c *APIClient) Ping(ctx context.Context) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.cfg.BaseURL+"/", nil)
     if err != nil {
-        return nil, fmt.Errorf("failed to fetch todos: %w", err)
+        return err
     }
-    defer resp.Body.Close()
-    
-    if resp.StatusCode != http.StatusOK {
-        return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+    tracing.Inject(ctx, req.Header)
+
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return err
     }
-    
-    body, err := io.ReadAll(resp.Body)
+    resp.Body.Close()
+
+    if resp.StatusCode >= 500 {
+        return &UpstreamStatusError{StatusCode: resp.StatusCode}
+    }
+    return nil
+}
+
+//получает задачи с внешнего апи
+func (c *APIClient) GetExternalTodos(ctx context.Context) ([]models.ExternalTodo, error) {
+    body, err := c.get(ctx, "/todos")
     if err != nil {
-        return nil, fmt.Errorf("failed to read response: %w", err)
+        return nil, fmt.Errorf("failed to fetch todos: %w", err)
     }
-    
+
     var todos []models.ExternalTodo
     if err := json.Unmarshal(body, &todos); err != nil {
         return nil, fmt.Errorf("failed to parse JSON: %w", err)
     }
-    
+
     return todos, nil
 }
 
 // пост на внешнем апи
-func (c *APIClient) CreateExternalPost(post models.CreatePostRequest) (*models.CreatePostResponse, error) {
+func (c *APIClient) CreateExternalPost(ctx context.Context, post models.CreatePostRequest) (*models.CreatePostResponse, error) {
     jsonData, err := json.Marshal(post)
     if err != nil {
         return nil, fmt.Errorf("failed to marshal post: %w", err)
     }
-    
-    resp, err := c.client.Post(
-        "https://jsonplaceholder.typicode.com/posts",
-        "application/json",
-        bytes.NewReader(jsonData),
-    )
+
+    //POST не идемпотентен, поэтому не ретраим, чтобы не создать пост дважды
+    resp, err := c.do(ctx, http.MethodPost, "/posts", jsonData, false, nil)
     if err != nil {
         return nil, fmt.Errorf("failed to create post: %w", err)
     }
-    defer resp.Body.Close()
-    
-    body, err := io.ReadAll(resp.Body)
-    if err != nil {
-        return nil, fmt.Errorf("failed to read response: %w", err)
-    }
-    
+
     var createdPost models.CreatePostResponse
-    if err := json.Unmarshal(body, &createdPost); err != nil {
+    if err := json.Unmarshal(resp.body, &createdPost); err != nil {
         return nil, fmt.Errorf("failed to parse response: %w", err)
     }
-    
+
     return &createdPost, nil
-}
\ No newline at end of file
+}
+
+//get отдает тело GET-ответа, по возможности из кэша с условной ревалидацией
+func (c *APIClient) get(ctx context.Context, path string) ([]byte, error) {
+    if c.cache == nil {
+        resp, err := c.do(ctx, http.MethodGet, path, nil, true, nil)
+        if err != nil {
+            return nil, err
+        }
+        return resp.body, nil
+    }
+
+    return c.cache.get(ctx, path, func(ctx context.Context, etag, lastModified string) ([]byte, string, string, bool, error) {
+        header := http.Header{}
+        if etag != "" {
+            header.Set("If-None-Match", etag)
+        }
+        if lastModified != "" {
+            header.Set("If-Modified-Since", lastModified)
+        }
+
+        resp, err := c.do(ctx, http.MethodGet, path, nil, true, header)
+        if err != nil {
+            return nil, "", "", false, err
+        }
+        return resp.body, resp.header.Get("ETag"), resp.header.Get("Last-Modified"),
+            resp.status == http.StatusNotModified, nil
+    })
+}
+
+//do выполняет запрос через брейкер. Идемпотентные запросы повторяются
+//с джиттером при сетевых ошибках, 429 и 5xx.
+func (c *APIClient) do(ctx context.Context, method, path string, payload []byte, idempotent bool, header http.Header) (*upstreamResponse, error) {
+    attempts := 1
+    if idempotent && c.cfg.MaxRetries > 0 {
+        attempts += c.cfg.MaxRetries
+    }
+
+    operation := method + " " + path
+
+    var lastErr error
+    for attempt := 0; attempt < attempts; attempt++ {
+        if err := c.breaker.allow(); err != nil {
+            c.observe(operation, OutcomeCircuitOpen, 0)
+            if lastErr != nil {
+                return nil, errors.Join(err, lastErr)
+            }
+            return nil, err
+        }
+
+        start := time.Now()
+        resp, retryAfter, err := c.send(ctx, method, path, payload, header)
+        elapsed := time.Since(start)
+        if err == nil {
+            c.breaker.success()
+            if resp.status == http.StatusNotModified {
+                c.observe(operation, OutcomeNotModified, elapsed)
+            } else {
+                c.observe(operation, OutcomeSuccess, elapsed)
+            }
+            return resp, nil
+        }
+
+        //отмена со стороны клиента - не вина апстрима
+        if ctx.Err() != nil {
+            c.breaker.release()
+            c.observe(operation, OutcomeCanceled, elapsed)
+            return nil, ctx.Err()
+        }
+
+        if !isRetryable(err) {
+            c.breaker.success()
+            outcome := OutcomeClientError
+            if errors.Is(err, ErrResponseTooLarge) {
+                outcome = OutcomeUpstreamError
+            }
+            c.observe(operation, outcome, elapsed)
+            return nil, err
+        }
+
+        c.breaker.failure()
+        var statusErr *UpstreamStatusError
+        if errors.As(err, &statusErr) {
+            c.observe(operation, OutcomeUpstreamError, elapsed)
+        } else {
+            c.observe(operation, OutcomeNetworkError, elapsed)
+        }
+        lastErr = err
+
+        if attempt == attempts-1 {
+            break
+        }
+
+        wait := c.backoff(attempt)
+        if retryAfter > wait {
+            wait = min(retryAfter, c.cfg.MaxBackoff)
+        }
+
+        timer := time.NewTimer(wait)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return nil, ctx.Err()
+        case <-timer.C:
+        }
+    }
+
+    return nil, lastErr
+}
+
+func (c *APIClient) send(ctx context.Context, method, path string, payload []byte, header http.Header) (*upstreamResponse, time.Duration, error) {
+    var reqBody io.Reader
+    if payload != nil {
+        reqBody = bytes.NewReader(payload)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, c.cfg.BaseURL+path, reqBody)
+    if err != nil {
+        return nil, 0, err
+    }
+    for key, values := range header {
+        req.Header[key] = values
+    }
+    tracing.Inject(ctx, req.Header)
+    if payload != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    req.Header.Set("Accept", "application/json")
+
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer resp.Body.Close()
+
+    //лишний байт показывает, что тело не уместилось в предел
+    body, err := io.ReadAll(io.LimitReader(resp.Body, c.cfg.MaxResponseBytes+1))
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to read response: %w", err)
+    }
+    if int64(len(body)) > c.cfg.MaxResponseBytes {
+        return nil, 0, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, c.cfg.MaxResponseBytes)
+    }
+
+    //304 - штатный ответ на условный запрос из кэша
+    if resp.StatusCode == http.StatusNotModified && header.Get("If-None-Match")+header.Get("If-Modified-Since") != "" {
+        return &upstreamResponse{status: resp.StatusCode, header: resp.Header}, 0, nil
+    }
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return nil, parseRetryAfter(resp.Header.Get("Retry-After")), &UpstreamStatusError{StatusCode: resp.StatusCode}
+    }
+
+    return &upstreamResponse{status: resp.StatusCode, body: body, header: resp.Header}, 0, nil
+}
+
+func (c *APIClient) observe(operation, outcome string, duration time.Duration) {
+    if c.cfg.Observer != nil {
+        c.cfg.Observer(operation, outcome, duration)
+    }
+}
+
+//backoff - экспоненциальная задержка с полным джиттером
+func (c *APIClient) backoff(attempt int) time.Duration {
+    delay := c.cfg.BaseBackoff << attempt
+    if delay <= 0 || delay > c.cfg.MaxBackoff {
+        delay = c.cfg.MaxBackoff
+    }
+    if delay <= 0 {
+        return 0
+    }
+    return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+func isRetryable(err error) bool {
+    if errors.Is(err, ErrResponseTooLarge) {
+        return false
+    }
+    var statusErr *UpstreamStatusError
+    if errors.As(err, &statusErr) {
+        return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+    }
+    //остальное - сетевые ошибки и таймауты
+    return true
+}
+
+func parseRetryAfter(value string) time.Duration {
+    if value == "" {
+        return 0
+    }
+    if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+        return time.Duration(seconds) * time.Second
+    }
+    if t, err := http.ParseTime(value); err == nil {
+        return time.Until(t)
+    }
+    return 0
+}
@@ -0,0 +1,239 @@
+package external
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "task-api/internal/models"
+)
+
+func testConfig(baseURL string) Config {
+    return Config{
+        BaseURL:          baseURL,
+        Timeout:          2 * time.Second,
+        MaxRetries:       3,
+        BaseBackoff:      time.Millisecond,
+        MaxBackoff:       5 * time.Millisecond,
+        BreakerThreshold: 3,
+        BreakerCooldown:  time.Minute,
+    }
+}
+
+func TestGetExternalTodos(t *testing.T) {
+    t.Run("Successful scenario", func(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.URL.Path != "/todos" {
+                t.Errorf("expected path /todos, got %s", r.URL.Path)
+            }
+            json.NewEncoder(w).Encode([]models.ExternalTodo{{ID: 1, UserID: 1, Title: "a"}})
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(testConfig(server.URL))
+        todos, err := client.GetExternalTodos(context.Background())
+
+        if err != nil {
+            t.Fatalf("expected no error, got %v", err)
+        }
+        if len(todos) != 1 || todos[0].Title != "a" {
+            t.Errorf("unexpected todos: %+v", todos)
+        }
+    })
+
+    t.Run("Retries transient failures", func(t *testing.T) {
+        var calls int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if atomic.AddInt32(&calls, 1) < 3 {
+                w.WriteHeader(http.StatusServiceUnavailable)
+                return
+            }
+            json.NewEncoder(w).Encode([]models.ExternalTodo{})
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(testConfig(server.URL))
+        if _, err := client.GetExternalTodos(context.Background()); err != nil {
+            t.Fatalf("expected success after retries, got %v", err)
+        }
+        if calls != 3 {
+            t.Errorf("expected 3 calls, got %d", calls)
+        }
+    })
+
+    t.Run("Does not retry client errors", func(t *testing.T) {
+        var calls int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            atomic.AddInt32(&calls, 1)
+            w.WriteHeader(http.StatusNotFound)
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(testConfig(server.URL))
+        _, err := client.GetExternalTodos(context.Background())
+
+        var statusErr *UpstreamStatusError
+        if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+            t.Fatalf("expected 404 status error, got %v", err)
+        }
+        if calls != 1 {
+            t.Errorf("expected 1 call, got %d", calls)
+        }
+        if client.BreakerState() != "closed" {
+            t.Errorf("expected breaker to stay closed, got %s", client.BreakerState())
+        }
+    })
+
+    t.Run("Circuit opens and short-circuits", func(t *testing.T) {
+        var calls int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            atomic.AddInt32(&calls, 1)
+            w.WriteHeader(http.StatusInternalServerError)
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(testConfig(server.URL))
+        if _, err := client.GetExternalTodos(context.Background()); err == nil {
+            t.Fatal("expected error, got nil")
+        }
+        if client.BreakerState() != "open" {
+            t.Fatalf("expected breaker open, got %s", client.BreakerState())
+        }
+
+        before := atomic.LoadInt32(&calls)
+        _, err := client.GetExternalTodos(context.Background())
+
+        var openErr *CircuitOpenError
+        if !errors.As(err, &openErr) {
+            t.Fatalf("expected CircuitOpenError, got %v", err)
+        }
+        if openErr.RetryAfter <= 0 {
+            t.Errorf("expected positive RetryAfter, got %v", openErr.RetryAfter)
+        }
+        if atomic.LoadInt32(&calls) != before {
+            t.Error("expected no upstream call while circuit is open")
+        }
+    })
+
+    t.Run("Half-open probe closes the circuit", func(t *testing.T) {
+        var healthy atomic.Bool
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if !healthy.Load() {
+                w.WriteHeader(http.StatusBadGateway)
+                return
+            }
+            json.NewEncoder(w).Encode([]models.ExternalTodo{})
+        }))
+        defer server.Close()
+
+        now := time.Now()
+        client := NewAPIClient(testConfig(server.URL))
+        client.breaker.now = func() time.Time { return now }
+
+        client.GetExternalTodos(context.Background())
+        if client.BreakerState() != "open" {
+            t.Fatalf("expected breaker open, got %s", client.BreakerState())
+        }
+
+        healthy.Store(true)
+        now = now.Add(2 * time.Minute)
+
+        if _, err := client.GetExternalTodos(context.Background()); err != nil {
+            t.Fatalf("expected probe to succeed, got %v", err)
+        }
+        if client.BreakerState() != "closed" {
+            t.Errorf("expected breaker closed, got %s", client.BreakerState())
+        }
+    })
+
+    t.Run("Respects caller context", func(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            <-r.Context().Done()
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(testConfig(server.URL))
+        ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+        defer cancel()
+
+        _, err := client.GetExternalTodos(ctx)
+        if !errors.Is(err, context.DeadlineExceeded) {
+            t.Fatalf("expected deadline exceeded, got %v", err)
+        }
+        if client.BreakerState() != "closed" {
+            t.Errorf("expected caller cancellation not to trip breaker, got %s", client.BreakerState())
+        }
+    })
+
+    t.Run("Rejects oversized responses without retrying", func(t *testing.T) {
+        var calls int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            atomic.AddInt32(&calls, 1)
+            json.NewEncoder(w).Encode([]models.ExternalTodo{{ID: 1, UserID: 1, Title: strings.Repeat("a", 1024)}})
+        }))
+        defer server.Close()
+
+        cfg := testConfig(server.URL)
+        cfg.MaxResponseBytes = 512
+        client := NewAPIClient(cfg)
+
+        if _, err := client.GetExternalTodos(context.Background()); !errors.Is(err, ErrResponseTooLarge) {
+            t.Fatalf("expected ErrResponseTooLarge, got %v", err)
+        }
+        if calls != 1 {
+            t.Errorf("expected oversized response not to be retried, got %d calls", calls)
+        }
+
+        cfg.MaxResponseBytes = 4096
+        if todos, err := NewAPIClient(cfg).GetExternalTodos(context.Background()); err != nil || len(todos) != 1 {
+            t.Errorf("expected response within the limit to pass, got %v", err)
+        }
+    })
+}
+
+func TestCreateExternalPost(t *testing.T) {
+    t.Run("Is not retried", func(t *testing.T) {
+        var calls int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            atomic.AddInt32(&calls, 1)
+            w.WriteHeader(http.StatusServiceUnavailable)
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(testConfig(server.URL))
+        _, err := client.CreateExternalPost(context.Background(), models.CreatePostRequest{Title: "t", Body: "b", UserID: 1})
+
+        if err == nil {
+            t.Fatal("expected error, got nil")
+        }
+        if calls != 1 {
+            t.Errorf("expected exactly 1 call for POST, got %d", calls)
+        }
+    })
+
+    t.Run("Successful scenario", func(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            var req models.CreatePostRequest
+            json.NewDecoder(r.Body).Decode(&req)
+            w.WriteHeader(http.StatusCreated)
+            json.NewEncoder(w).Encode(models.CreatePostResponse{ID: 101, Title: req.Title, Body: req.Body, UserID: req.UserID})
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(testConfig(server.URL))
+        post, err := client.CreateExternalPost(context.Background(), models.CreatePostRequest{Title: "t", Body: "b", UserID: 1})
+
+        if err != nil {
+            t.Fatalf("expected no error, got %v", err)
+        }
+        if post.ID != 101 || post.Title != "t" {
+            t.Errorf("unexpected post: %+v", post)
+        }
+    })
+}
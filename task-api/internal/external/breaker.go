@@ -0,0 +1,126 @@
+package external
+
+import (
+    "fmt"
+    "sync"
+    "time"
+)
+
+type breakerState int
+
+const (
+    stateClosed breakerState = iota
+    stateOpen
+    stateHalfOpen
+)
+
+func (s breakerState) String() string {
+    switch s {
+    case stateOpen:
+        return "open"
+    case stateHalfOpen:
+        return "half-open"
+    }
+    return "closed"
+}
+
+//CircuitOpenError возвращается без обращения к апстриму, пока брейкер открыт
+type CircuitOpenError struct {
+    RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+    return fmt.Sprintf("external API unavailable, circuit open for another %v", e.RetryAfter.Round(time.Second))
+}
+
+//circuitBreaker размыкается после threshold неудач подряд и через cooldown
+//пропускает один пробный запрос
+type circuitBreaker struct {
+    mu        sync.Mutex
+    state     breakerState
+    failures  int
+    threshold int
+    cooldown  time.Duration
+    openedAt  time.Time
+    probing   bool
+    now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+    return &circuitBreaker{
+        threshold: threshold,
+        cooldown:  cooldown,
+        now:       time.Now,
+    }
+}
+
+//allow решает, можно ли идти в апстрим, и возвращает ошибку, если нельзя
+func (b *circuitBreaker) allow() error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    switch b.state {
+    case stateOpen:
+        elapsed := b.now().Sub(b.openedAt)
+        if elapsed < b.cooldown {
+            return &CircuitOpenError{RetryAfter: b.cooldown - elapsed}
+        }
+        b.state = stateHalfOpen
+        b.probing = true
+        return nil
+    case stateHalfOpen:
+        if b.probing {
+            return &CircuitOpenError{RetryAfter: b.cooldown}
+        }
+        b.probing = true
+    }
+    return nil
+}
+
+func (b *circuitBreaker) success() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.state = stateClosed
+    b.failures = 0
+    b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.probing = false
+    if b.state == stateHalfOpen {
+        b.trip()
+        return
+    }
+
+    b.failures++
+    if b.threshold > 0 && b.failures >= b.threshold {
+        b.trip()
+    }
+}
+
+//release снимает пробный запрос, не засчитывая результат
+func (b *circuitBreaker) release() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.probing = false
+    if b.state == stateHalfOpen {
+        b.state = stateOpen
+    }
+}
+
+func (b *circuitBreaker) trip() {
+    b.state = stateOpen
+    b.openedAt = b.now()
+    b.failures = 0
+}
+
+func (b *circuitBreaker) State() string {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.state.String()
+}
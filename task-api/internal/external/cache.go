@@ -0,0 +1,157 @@
+package external
+
+import (
+    "context"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+//CacheStats - счетчики кэша ответов, отдаются на /health
+type CacheStats struct {
+    Hits        int64 `json:"hits"`
+    Misses      int64 `json:"misses"`
+    Revalidated int64 `json:"revalidated"`
+    StaleServed int64 `json:"stale_served"`
+    Entries     int   `json:"entries"`
+}
+
+type cacheEntry struct {
+    body         []byte
+    etag         string
+    lastModified string
+    fetchedAt    time.Time
+}
+
+//inflight - общий запрос в апстрим, которого ждут все конкурентные промахи по ключу
+type inflight struct {
+    done chan struct{}
+    body []byte
+    err  error
+}
+
+//responseCache - TTL-кэш GET-ответов с ревалидацией по ETag/Last-Modified.
+//Если апстрим недоступен, в пределах maxStale отдается устаревшая копия.
+type responseCache struct {
+    mu       sync.Mutex
+    entries  map[string]*cacheEntry
+    calls    map[string]*inflight
+    ttl      time.Duration
+    maxStale time.Duration
+    now      func() time.Time
+
+    hits        atomic.Int64
+    misses      atomic.Int64
+    revalidated atomic.Int64
+    staleServed atomic.Int64
+}
+
+func newResponseCache(ttl, maxStale time.Duration) *responseCache {
+    return &responseCache{
+        entries:  make(map[string]*cacheEntry),
+        calls:    make(map[string]*inflight),
+        ttl:      ttl,
+        maxStale: maxStale,
+        now:      time.Now,
+    }
+}
+
+//fetchFunc делает условный запрос. notModified=true означает 304 и пустое тело.
+type fetchFunc func(ctx context.Context, etag, lastModified string) (body []byte, etag2, lastModified2 string, notModified bool, err error)
+
+func (c *responseCache) get(ctx context.Context, key string, fetch fetchFunc) ([]byte, error) {
+    c.mu.Lock()
+    entry := c.entries[key]
+    if entry != nil && c.now().Sub(entry.fetchedAt) < c.ttl {
+        c.mu.Unlock()
+        c.hits.Add(1)
+        return entry.body, nil
+    }
+    c.misses.Add(1)
+
+    call, leader := c.calls[key], false
+    if call == nil {
+        call = &inflight{done: make(chan struct{})}
+        c.calls[key] = call
+        leader = true
+    }
+    c.mu.Unlock()
+
+    if leader {
+        //отмена запроса лидера не должна ронять остальных ожидающих
+        go c.refresh(context.WithoutCancel(ctx), key, entry, call, fetch)
+    }
+
+    select {
+    case <-call.done:
+        return call.body, call.err
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+func (c *responseCache) refresh(ctx context.Context, key string, entry *cacheEntry, call *inflight, fetch fetchFunc) {
+    var etag, lastModified string
+    if entry != nil {
+        etag, lastModified = entry.etag, entry.lastModified
+    }
+
+    body, newETag, newLastModified, notModified, err := fetch(ctx, etag, lastModified)
+
+    c.mu.Lock()
+    now := c.now()
+    switch {
+    case err == nil && notModified && entry != nil:
+        c.revalidated.Add(1)
+        c.entries[key] = &cacheEntry{
+            body:         entry.body,
+            etag:         firstNonEmpty(newETag, entry.etag),
+            lastModified: firstNonEmpty(newLastModified, entry.lastModified),
+            fetchedAt:    now,
+        }
+        call.body = entry.body
+    case err == nil && !notModified:
+        c.entries[key] = &cacheEntry{
+            body:         body,
+            etag:         newETag,
+            lastModified: newLastModified,
+            fetchedAt:    now,
+        }
+        call.body = body
+    case err == nil:
+        //304 без копии в кэше - апстрим повел себя странно
+        call.err = &UpstreamStatusError{StatusCode: 304}
+    case entry != nil && now.Sub(entry.fetchedAt) < c.ttl+c.maxStale:
+        c.staleServed.Add(1)
+        call.body = entry.body
+    default:
+        call.err = err
+    }
+    delete(c.calls, key)
+    c.mu.Unlock()
+
+    close(call.done)
+}
+
+func (c *responseCache) stats() CacheStats {
+    c.mu.Lock()
+    entries := len(c.entries)
+    c.mu.Unlock()
+
+    return CacheStats{
+        Hits:        c.hits.Load(),
+        Misses:      c.misses.Load(),
+        Revalidated: c.revalidated.Load(),
+        StaleServed: c.staleServed.Load(),
+        Entries:     entries,
+    }
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
@@ -0,0 +1,145 @@
+package external
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "task-api/internal/models"
+)
+
+func cachedConfig(baseURL string) Config {
+    cfg := testConfig(baseURL)
+    cfg.MaxRetries = 0
+    cfg.BreakerThreshold = 100
+    cfg.CacheTTL = time.Minute
+    cfg.CacheMaxStale = time.Hour
+    return cfg
+}
+
+func TestResponseCache(t *testing.T) {
+    t.Run("Serves fresh entries without upstream call", func(t *testing.T) {
+        var calls int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            atomic.AddInt32(&calls, 1)
+            json.NewEncoder(w).Encode([]models.ExternalTodo{{ID: 1}})
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(cachedConfig(server.URL))
+        for i := 0; i < 3; i++ {
+            if _, err := client.GetExternalTodos(context.Background()); err != nil {
+                t.Fatalf("expected no error, got %v", err)
+            }
+        }
+
+        if calls != 1 {
+            t.Errorf("expected 1 upstream call, got %d", calls)
+        }
+        stats := client.CacheStats()
+        if stats.Hits != 2 || stats.Misses != 1 {
+            t.Errorf("expected 2 hits and 1 miss, got %+v", stats)
+        }
+    })
+
+    t.Run("Revalidates with ETag", func(t *testing.T) {
+        var conditional int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if r.Header.Get("If-None-Match") == `"v1"` {
+                atomic.AddInt32(&conditional, 1)
+                w.WriteHeader(http.StatusNotModified)
+                return
+            }
+            w.Header().Set("ETag", `"v1"`)
+            json.NewEncoder(w).Encode([]models.ExternalTodo{{ID: 7, Title: "cached"}})
+        }))
+        defer server.Close()
+
+        now := time.Now()
+        client := NewAPIClient(cachedConfig(server.URL))
+        client.cache.now = func() time.Time { return now }
+
+        client.GetExternalTodos(context.Background())
+        now = now.Add(2 * time.Minute)
+
+        todos, err := client.GetExternalTodos(context.Background())
+        if err != nil {
+            t.Fatalf("expected no error, got %v", err)
+        }
+        if len(todos) != 1 || todos[0].Title != "cached" {
+            t.Errorf("expected cached body after 304, got %+v", todos)
+        }
+        if conditional != 1 || client.CacheStats().Revalidated != 1 {
+            t.Errorf("expected one conditional revalidation, got %d", conditional)
+        }
+    })
+
+    t.Run("Serves stale copy when upstream fails", func(t *testing.T) {
+        var failing atomic.Bool
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if failing.Load() {
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+            }
+            json.NewEncoder(w).Encode([]models.ExternalTodo{{ID: 1}})
+        }))
+        defer server.Close()
+
+        now := time.Now()
+        client := NewAPIClient(cachedConfig(server.URL))
+        client.cache.now = func() time.Time { return now }
+
+        client.GetExternalTodos(context.Background())
+        failing.Store(true)
+        now = now.Add(2 * time.Minute)
+
+        if _, err := client.GetExternalTodos(context.Background()); err != nil {
+            t.Fatalf("expected stale copy, got %v", err)
+        }
+        if client.CacheStats().StaleServed != 1 {
+            t.Errorf("expected stale_served=1, got %+v", client.CacheStats())
+        }
+
+        now = now.Add(2 * time.Hour)
+        if _, err := client.GetExternalTodos(context.Background()); err == nil {
+            t.Error("expected error once copy is older than max stale")
+        }
+    })
+
+    t.Run("Collapses concurrent misses", func(t *testing.T) {
+        var calls int32
+        release := make(chan struct{})
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            atomic.AddInt32(&calls, 1)
+            <-release
+            json.NewEncoder(w).Encode([]models.ExternalTodo{{ID: 1}})
+        }))
+        defer server.Close()
+
+        client := NewAPIClient(cachedConfig(server.URL))
+
+        var wg sync.WaitGroup
+        for i := 0; i < 10; i++ {
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                if _, err := client.GetExternalTodos(context.Background()); err != nil {
+                    t.Errorf("expected no error, got %v", err)
+                }
+            }()
+        }
+
+        time.Sleep(50 * time.Millisecond)
+        close(release)
+        wg.Wait()
+
+        if calls != 1 {
+            t.Errorf("expected 1 upstream call, got %d", calls)
+        }
+    })
+}
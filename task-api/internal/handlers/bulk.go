@@ -0,0 +1,203 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "task-api/internal/models"
+)
+
+//maxBulkOperations ограничивает время, на которое пакет держит блокировку хранилища
+const maxBulkOperations = 100
+
+type bulkRequest struct {
+    Mode       models.BulkMode `json:"mode"`
+    Operations []struct {
+        Op        models.BulkOp              `json:"op"`
+        ID        int                        `json:"id"`
+        IfVersion int                        `json:"if_version"`
+        Task      map[string]json.RawMessage `json:"task"`
+    } `json:"operations"`
+}
+
+//BulkTasks выполняет пакет create/update/delete за один запрос. В atomic режиме
+//(по умолчанию) любая ошибка отменяет весь пакет, в best_effort применяются
+//все корректные операции. Ошибки адресуются индексом операции в запросе.
+//if_version у операции работает как If-Match у одиночных запросов.
+func (h *TaskHandler) BulkTasks(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    var req bulkRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        sendDecodeError(w, r, err, "expected JSON with mode and operations fields")
+        return
+    }
+
+    if req.Mode == "" {
+        req.Mode = models.BulkAtomic
+    }
+    if req.Mode != models.BulkAtomic && req.Mode != models.BulkBestEffort {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "validation failed", "mode must be one of: atomic, best_effort", nil)
+        return
+    }
+    if len(req.Operations) == 0 || len(req.Operations) > maxBulkOperations {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "validation failed",
+            fmt.Sprintf("operations must contain 1-%d items", maxBulkOperations), nil)
+        return
+    }
+
+    response := models.BulkResponse{
+        Mode:    req.Mode,
+        Results: make([]models.BulkResult, len(req.Operations)),
+    }
+    ops := make([]models.BulkOperation, 0, len(req.Operations))
+    //indexes[i] - позиция в запросе операции ops[i]
+    indexes := make([]int, 0, len(req.Operations))
+    allErrors := []models.ValidationError{}
+
+    for i, raw := range req.Operations {
+        op := models.BulkOperation{Op: raw.Op, ID: raw.ID, IfVersion: raw.IfVersion}
+        validationErrors := validateBulkOperation(raw.Op, raw.ID, raw.Task, &op)
+        if raw.IfVersion < 0 || raw.IfVersion > 0 && raw.Op == models.BulkCreate {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "if_version",
+                Message: "if_version must be a positive task version for update or delete",
+            })
+        }
+
+        if len(validationErrors) > 0 {
+            for j := range validationErrors {
+                validationErrors[j].Field = fmt.Sprintf("operations[%d].%s", i, validationErrors[j].Field)
+            }
+            allErrors = append(allErrors, validationErrors...)
+            response.Results[i] = models.BulkResult{
+                Index:  i,
+                Op:     raw.Op,
+                Status: models.BulkStatusFailed,
+                ID:     raw.ID,
+                Error:  "validation failed",
+                Errors: validationErrors,
+            }
+            continue
+        }
+
+        ops = append(ops, op)
+        indexes = append(indexes, i)
+    }
+
+    atomic := req.Mode == models.BulkAtomic
+    if atomic && len(allErrors) > 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "validation failed",
+            fmt.Sprintf("found %d validation error(s), no operations were applied", len(allErrors)),
+            allErrors)
+        return
+    }
+
+    results, applied := h.store.ApplyBulk(r.Context(), principal.UserID, ops, atomic)
+    for i, result := range results {
+        result.Index = indexes[i]
+        response.Results[indexes[i]] = result
+    }
+
+    response.Applied = applied
+    for _, result := range response.Results {
+        switch result.Status {
+        case models.BulkStatusCreated, models.BulkStatusUpdated, models.BulkStatusDeleted:
+            response.Succeeded++
+        case models.BulkStatusFailed:
+            response.Failed++
+        }
+    }
+
+    //откатившийся atomic-пакет - конфликт с текущим состоянием хранилища
+    if atomic && !applied {
+        w.WriteHeader(http.StatusConflict)
+    }
+    json.NewEncoder(w).Encode(response)
+}
+
+//validateBulkOperation проверяет операцию пакета и заполняет op. Поля ошибок
+//относительные, индекс операции добавляет вызывающий.
+func validateBulkOperation(kind models.BulkOp, id int, task map[string]json.RawMessage, op *models.BulkOperation) []models.ValidationError {
+    validationErrors := []models.ValidationError{}
+
+    switch kind {
+    case models.BulkCreate:
+        if id != 0 {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "id",
+                Message: "id is assigned by the server for create",
+            })
+        }
+        if task == nil {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "task",
+                Message: "task object with 'title' field is required",
+            })
+            return validationErrors
+        }
+        patch, taskErrors := decodeTaskPatch(task)
+        if _, ok := task["title"]; !ok {
+            taskErrors = append(taskErrors, models.ValidationError{
+                Field:   "title",
+                Message: "title is required",
+            })
+        }
+        op.Patch = patch
+        return append(validationErrors, prefixTaskErrors(taskErrors)...)
+
+    case models.BulkUpdate:
+        if id <= 0 {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "id",
+                Message: "id must be a positive integer",
+            })
+        }
+        patch, taskErrors := decodeTaskPatch(task)
+        if len(taskErrors) == 0 && patch.IsEmpty() {
+            taskErrors = append(taskErrors, models.ValidationError{
+                Field:   "task",
+                Message: "at least one field must be provided",
+            })
+            return append(validationErrors, taskErrors...)
+        }
+        op.Patch = patch
+        return append(validationErrors, prefixTaskErrors(taskErrors)...)
+
+    case models.BulkDelete:
+        if id <= 0 {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "id",
+                Message: "id must be a positive integer",
+            })
+        }
+        if task != nil {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "task",
+                Message: "delete does not accept task fields",
+            })
+        }
+        return validationErrors
+
+    default:
+        return append(validationErrors, models.ValidationError{
+            Field:   "op",
+            Message: "op must be one of: create, update, delete",
+        })
+    }
+}
+
+func prefixTaskErrors(taskErrors []models.ValidationError) []models.ValidationError {
+    for i := range taskErrors {
+        taskErrors[i].Field = "task." + taskErrors[i].Field
+    }
+    return taskErrors
+}
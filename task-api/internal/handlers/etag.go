@@ -0,0 +1,88 @@
+package handlers
+
+import (
+    "errors"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "task-api/internal/models"
+)
+
+var errInvalidIfMatch = errors.New("If-Match must be \"*\" or a list of entity tags from the task's ETag header")
+
+//taskETag - сильный ETag из версии задачи
+func taskETag(task models.Task) string {
+    return `"` + strconv.Itoa(task.Version) + `"`
+}
+
+//ifMatchVersions разбирает If-Match в версии из сильных тегов списка. wildcard -
+//условия нет или "*"; слабые теги по RFC 9110 никогда не совпадают и
+//пропускаются, так что пустой список versions означает, что совпадения не будет.
+func ifMatchVersions(r *http.Request) (versions []int, wildcard bool, err error) {
+    header := strings.TrimSpace(r.Header.Get("If-Match"))
+    if header == "" || header == "*" {
+        return nil, true, nil
+    }
+
+    tags := 0
+    for _, tag := range strings.Split(header, ",") {
+        tag = strings.TrimSpace(tag)
+        if tag == "" {
+            continue
+        }
+        tags++
+        if strings.HasPrefix(tag, "W/") {
+            continue
+        }
+
+        version, err := strconv.Atoi(strings.Trim(tag, `"`))
+        if err != nil || version <= 0 || len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+            return nil, false, errInvalidIfMatch
+        }
+        versions = append(versions, version)
+    }
+    if tags == 0 {
+        return nil, false, errInvalidIfMatch
+    }
+    return versions, false, nil
+}
+
+//notModified проверяет If-None-Match слабым сравнением, как требует RFC 9110 для GET
+func notModified(r *http.Request, etag string) bool {
+    header := r.Header.Get("If-None-Match")
+    if header == "" {
+        return false
+    }
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+        if candidate == "*" || candidate == etag {
+            return true
+        }
+    }
+    return false
+}
+
+//preconditionFromRequest переводит If-Match в версию для хранилища: 0 - условия
+//нет, -1 - ни один тег не совпадет. Из нескольких тегов берется текущая версия
+//задачи, если она есть в списке; хранилище все равно сверит ее под блокировкой.
+//При ошибке разбора сам отвечает 400.
+func (h *TaskHandler) preconditionFromRequest(w http.ResponseWriter, r *http.Request, ownerID, id int) (int, bool) {
+    versions, wildcard, err := ifMatchVersions(r)
+    if err != nil {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid precondition", err.Error(), nil)
+        return 0, false
+    }
+
+    switch {
+    case wildcard:
+        return 0, true
+    case len(versions) == 1:
+        return versions[0], true
+    }
+    if current, exists := h.store.GetByID(ownerID, id); exists && slices.Contains(versions, current.Version) {
+        return current.Version, true
+    }
+    return -1, true
+}
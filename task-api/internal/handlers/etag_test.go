@@ -0,0 +1,103 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "task-api/internal/models"
+    "task-api/internal/storage"
+)
+
+func TestTaskETags(t *testing.T) {
+    store := storage.NewTaskStore()
+    task := mustCreate(t, store, models.Task{Title: "draft", UserID: 1})
+    mux := taskMux(NewTaskHandler(store, nil, 0))
+    target := fmt.Sprintf("/tasks/%d", task.ID)
+
+    send := func(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+        t.Helper()
+        r := asOwner(1, method, target, body)
+        for name, values := range header {
+            r.Header[name] = values
+        }
+        w := httptest.NewRecorder()
+        mux.ServeHTTP(w, r)
+        return w
+    }
+
+    t.Run("GET returns the version as ETag", func(t *testing.T) {
+        w := send(http.MethodGet, target, "", nil)
+        if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` {
+            t.Errorf("expected 200 with ETag \"1\", got %d %q", w.Code, w.Header().Get("ETag"))
+        }
+    })
+
+    t.Run("If-None-Match", func(t *testing.T) {
+        tests := []struct {
+            header string
+            want   int
+        }{
+            {`"1"`, http.StatusNotModified},
+            {`W/"1"`, http.StatusNotModified},
+            {`"7", "1"`, http.StatusNotModified},
+            {`*`, http.StatusNotModified},
+            {`"2"`, http.StatusOK},
+        }
+        for _, tt := range tests {
+            w := send(http.MethodGet, target, "", http.Header{"If-None-Match": {tt.header}})
+            if w.Code != tt.want {
+                t.Errorf("If-None-Match %s: expected %d, got %d", tt.header, tt.want, w.Code)
+            }
+            if tt.want == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") != `"1"`) {
+                t.Errorf("If-None-Match %s: expected empty 304 with ETag, got %q %s", tt.header, w.Header().Get("ETag"), w.Body)
+            }
+        }
+    })
+
+    t.Run("Stale If-Match fails with the current ETag", func(t *testing.T) {
+        for _, tt := range []struct {
+            method, body string
+        }{
+            {http.MethodPatch, `{"title":"stale"}`},
+            {http.MethodPut, `{"title":"stale"}`},
+            {http.MethodDelete, ""},
+        } {
+            for _, header := range []string{`"2"`, `W/"1"`, `"2", "3"`} {
+                w := send(tt.method, target, tt.body, http.Header{"If-Match": {header}})
+                if w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != `"1"` {
+                    t.Errorf("%s with If-Match %s: expected 412 with ETag \"1\", got %d %q", tt.method, header, w.Code, w.Header().Get("ETag"))
+                }
+            }
+        }
+        if current, _ := store.GetByID(1, task.ID); current.Version != 1 || current.Title != "draft" {
+            t.Errorf("expected task to stay untouched, got %+v", current)
+        }
+    })
+
+    t.Run("Invalid If-Match is rejected", func(t *testing.T) {
+        for _, header := range []string{`1`, `"abc"`, `"0"`, `*, "1"`, `,`} {
+            w := send(http.MethodPatch, target, `{"title":"x"}`, http.Header{"If-Match": {header}})
+            if w.Code != http.StatusBadRequest {
+                t.Errorf("If-Match %s: expected 400, got %d", header, w.Code)
+            }
+        }
+    })
+
+    t.Run("Matching If-Match applies the change", func(t *testing.T) {
+        w := send(http.MethodPatch, target, `{"title":"patched"}`, http.Header{"If-Match": {`"1"`}})
+        if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+            t.Fatalf("expected 200 with ETag \"2\", got %d %q: %s", w.Code, w.Header().Get("ETag"), w.Body)
+        }
+        //список тегов совпадает, если совпал любой сильный
+        w = send(http.MethodPut, target, `{"title":"replaced"}`, http.Header{"If-Match": {`W/"2", "9", "2"`}})
+        if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+            t.Fatalf("expected 200 with ETag \"3\", got %d %q: %s", w.Code, w.Header().Get("ETag"), w.Body)
+        }
+        w = send(http.MethodDelete, target, "", http.Header{"If-Match": {`"3", "4"`}})
+        if w.Code != http.StatusOK {
+            t.Errorf("expected delete with matching tag list, got %d: %s", w.Code, w.Body)
+        }
+    })
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "task-api/internal/events"
+    "task-api/internal/models"
+    "time"
+)
+
+//EventHandler отдает поток изменений задач в формате Server-Sent Events
+type EventHandler struct {
+    broker    *events.Broker
+    heartbeat time.Duration
+}
+
+func NewEventHandler(broker *events.Broker, heartbeat time.Duration) *EventHandler {
+    if heartbeat <= 0 {
+        heartbeat = 15 * time.Second
+    }
+    return &EventHandler{broker: broker, heartbeat: heartbeat}
+}
+
+//StreamTaskEvents - GET /tasks/events. Клиент получает только события своих задач.
+//Продолжить с места обрыва можно заголовком Last-Event-ID или параметром
+//last_event_id (EventSource не умеет ставить заголовки при первом подключении).
+func (h *EventHandler) StreamTaskEvents(w http.ResponseWriter, r *http.Request) {
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    lastID, resume, err := lastEventID(r)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid Last-Event-ID", err.Error(), nil)
+        return
+    }
+
+    sub, ok := h.broker.Subscribe(principal.UserID, lastID, resume)
+    if !ok {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusServiceUnavailable)
+        sendError(w, r, "server is shutting down", "reconnect to another instance", nil)
+        return
+    }
+    defer sub.Close()
+
+    //поток живет дольше WriteTimeout сервера, поэтому дедлайн снимается
+    rc := http.NewResponseController(w)
+    rc.SetWriteDeadline(time.Time{})
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("X-Accel-Buffering", "no")
+    w.WriteHeader(http.StatusOK)
+
+    fmt.Fprint(w, "retry: 3000\n\n")
+    if sub.Gap {
+        //часть событий потеряна, клиенту нужно перечитать список задач
+        fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+    }
+    for _, event := range sub.Backlog {
+        writeEvent(w, event)
+    }
+    if err := rc.Flush(); err != nil {
+        return
+    }
+
+    ticker := time.NewTicker(h.heartbeat)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case event, open := <-sub.Events:
+            if !open {
+                return
+            }
+            writeEvent(w, event)
+        case <-ticker.C:
+            fmt.Fprint(w, ": ping\n\n")
+        }
+        if err := rc.Flush(); err != nil {
+            return
+        }
+    }
+}
+
+func writeEvent(w http.ResponseWriter, event models.TaskEvent) {
+    data, err := json.Marshal(event)
+    if err != nil {
+        return
+    }
+    fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+func lastEventID(r *http.Request) (uint64, bool, error) {
+    value := r.Header.Get("Last-Event-ID")
+    if value == "" {
+        value = r.URL.Query().Get("last_event_id")
+    }
+    if value == "" {
+        return 0, false, nil
+    }
+
+    id, err := strconv.ParseUint(value, 10, 64)
+    if err != nil {
+        return 0, false, fmt.Errorf("expected numeric event id, got %q", value)
+    }
+    return id, true, nil
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "task-api/internal/audit"
+)
+
+type HistoryHandler struct {
+    log *audit.Log
+}
+
+func NewHistoryHandler(log *audit.Log) *HistoryHandler {
+    return &HistoryHandler{log: log}
+}
+
+//GetTaskHistory отдает журнал изменений задачи от старых записей к новым.
+//История удаленной задачи остается доступной ее владельцу.
+func (h *HistoryHandler) GetTaskHistory(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    id, ok := taskIDFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    history, exists := h.log.History(principal.UserID, id)
+    if !exists {
+        w.WriteHeader(http.StatusNotFound)
+        sendError(w, r, "task not found", fmt.Sprintf("task with id %d has no history", id), nil)
+        return
+    }
+
+    json.NewEncoder(w).Encode(history)
+}
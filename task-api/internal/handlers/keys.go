@@ -0,0 +1,160 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "task-api/internal/auth"
+    "task-api/internal/models"
+    "time"
+)
+
+type KeyHandler struct {
+    keys *auth.KeyStore
+}
+
+func NewKeyHandler(keys *auth.KeyStore) *KeyHandler {
+    return &KeyHandler{keys: keys}
+}
+
+//createdKeyResponse - единственный ответ, в котором виден открытый ключ
+type createdKeyResponse struct {
+    Key    auth.APIKey `json:"key"`
+    APIKey string      `json:"api_key"`
+    Notice string      `json:"notice"`
+}
+
+func (h *KeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(h.keys.List())
+}
+
+func (h *KeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    var req struct {
+        Name      string     `json:"name"`
+        UserID    int        `json:"userId"`
+        Scopes    []string   `json:"scopes"`
+        ExpiresAt *time.Time `json:"expires_at"`
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        sendDecodeError(w, r, err, "expected JSON with name, userId, scopes and optional expires_at")
+        return
+    }
+
+    req.Name = strings.TrimSpace(req.Name)
+    validationErrors := []models.ValidationError{}
+
+    if req.Name == "" {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "name",
+            Message: "name cannot be empty",
+        })
+    }
+
+    if req.UserID <= 0 {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "userId",
+            Message: "userId must be a positive integer",
+        })
+    }
+
+    if len(req.Scopes) == 0 {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "scopes",
+            Message: "at least one scope is required",
+        })
+    }
+    for _, scope := range req.Scopes {
+        if !auth.ValidScope(scope) {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "scopes",
+                Message: fmt.Sprintf("unknown scope %q", scope),
+            })
+        }
+    }
+
+    if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "expires_at",
+            Message: "expires_at must be in the future",
+        })
+    }
+
+    if len(validationErrors) > 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "validation failed",
+            fmt.Sprintf("found %d validation error(s)", len(validationErrors)),
+            validationErrors)
+        return
+    }
+
+    if req.ExpiresAt != nil {
+        expiresAt := req.ExpiresAt.UTC()
+        req.ExpiresAt = &expiresAt
+    }
+
+    key, plaintext, err := h.keys.Create(req.Name, req.UserID, req.Scopes, req.ExpiresAt)
+    if err != nil {
+        w.WriteHeader(http.StatusInternalServerError)
+        sendError(w, r, "failed to create api key", err.Error(), nil)
+        return
+    }
+
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(createdKeyResponse{
+        Key:    key,
+        APIKey: plaintext,
+        Notice: "store this key now, it will not be shown again",
+    })
+}
+
+func (h *KeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    key, err := h.keys.Revoke(r.PathValue("id"))
+    if err != nil {
+        h.writeKeyError(w, r, err)
+        return
+    }
+
+    json.NewEncoder(w).Encode(key)
+}
+
+func (h *KeyHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    key, plaintext, err := h.keys.Rotate(r.PathValue("id"))
+    if err != nil {
+        h.writeKeyError(w, r, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(createdKeyResponse{
+        Key:    key,
+        APIKey: plaintext,
+        Notice: "the previous key has been revoked; store this key now, it will not be shown again",
+    })
+}
+
+func (h *KeyHandler) writeKeyError(w http.ResponseWriter, r *http.Request, err error) {
+    switch {
+    case errors.Is(err, auth.ErrKeyNotFound):
+        w.WriteHeader(http.StatusNotFound)
+        sendError(w, r, "api key not found", fmt.Sprintf("api key %q does not exist", r.PathValue("id")), nil)
+    case errors.Is(err, auth.ErrKeyRevoked):
+        w.WriteHeader(http.StatusConflict)
+        sendError(w, r, "api key revoked", "revoked keys cannot be rotated", nil)
+    case errors.Is(err, auth.ErrKeyExpired):
+        w.WriteHeader(http.StatusConflict)
+        sendError(w, r, "api key expired", "expired keys cannot be rotated", nil)
+    default:
+        w.WriteHeader(http.StatusInternalServerError)
+        sendError(w, r, "api key operation failed", err.Error(), nil)
+    }
+}
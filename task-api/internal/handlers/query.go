@@ -0,0 +1,78 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "task-api/internal/models"
+    "task-api/internal/storage"
+    "time"
+)
+
+//parseTaskQuery собирает фильтры, сортировку и пагинацию из query string GET /tasks
+func parseTaskQuery(r *http.Request) (models.TaskQuery, []models.ValidationError) {
+    params := r.URL.Query()
+    var query models.TaskQuery
+    validationErrors := []models.ValidationError{}
+    
+    addError := func(field, message string) {
+        validationErrors = append(validationErrors, models.ValidationError{Field: field, Message: message})
+    }
+    
+    if doneStr := params.Get("done"); doneStr != "" {
+        done, err := strconv.ParseBool(doneStr)
+        if err != nil {
+            addError("done", "done parameter must be 'true' or 'false'")
+        } else {
+            query.Filter.Done = &done
+        }
+    }
+    
+    query.Filter.TitleContains = strings.TrimSpace(params.Get("title"))
+    query.Filter.Tag = strings.ToLower(strings.TrimSpace(params.Get("tag")))
+    
+    parseTime := func(field string) *time.Time {
+        value := params.Get(field)
+        if value == "" {
+            return nil
+        }
+        t, err := time.Parse(time.RFC3339, value)
+        if err != nil {
+            addError(field, fmt.Sprintf("%s must be an RFC 3339 timestamp", field))
+            return nil
+        }
+        return &t
+    }
+    query.Filter.DueAfter = parseTime("due_after")
+    query.Filter.DueBefore = parseTime("due_before")
+    
+    if query.Filter.DueAfter != nil && query.Filter.DueBefore != nil &&
+        query.Filter.DueAfter.After(*query.Filter.DueBefore) {
+        addError("due_after", "due_after must not be later than due_before")
+    }
+    
+    if sortStr := params.Get("sort"); sortStr != "" {
+        if strings.HasPrefix(sortStr, "-") {
+            query.Desc = true
+            sortStr = sortStr[1:]
+        }
+        query.Sort = models.TaskSortField(sortStr)
+        if !query.Sort.Valid() {
+            addError("sort", "sort must be one of: id, title, created_at, priority (prefix with - for descending)")
+        }
+    }
+    
+    if limitStr := params.Get("limit"); limitStr != "" {
+        limit, err := strconv.Atoi(limitStr)
+        if err != nil || limit <= 0 || limit > storage.MaxPageLimit {
+            addError("limit", fmt.Sprintf("limit must be an integer between 1 and %d", storage.MaxPageLimit))
+        } else {
+            query.Limit = limit
+        }
+    }
+    
+    query.Cursor = params.Get("cursor")
+    
+    return query, validationErrors
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "task-api/internal/models"
+    "task-api/internal/search"
+    "task-api/internal/storage"
+)
+
+//SearchTasks ищет по названию, описанию и тегам: GET /tasks/search?q=...
+//Поддерживаются префиксы (молок*), фразы в кавычках, AND/OR/NOT и скобки.
+func (h *TaskHandler) SearchTasks(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    query, validationErrors := parseSearchQuery(r)
+    if len(validationErrors) > 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid query parameters",
+            fmt.Sprintf("found %d validation error(s)", len(validationErrors)),
+            validationErrors)
+        return
+    }
+
+    result, err := h.store.Search(principal.UserID, query)
+    var queryErr *search.QueryError
+    if errors.As(err, &queryErr) {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid query parameters", "found 1 validation error(s)", []models.ValidationError{{
+            Field:   "q",
+            Message: queryErr.Message,
+        }})
+        return
+    }
+    if err != nil {
+        w.WriteHeader(http.StatusInternalServerError)
+        sendError(w, r, "failed to search tasks", err.Error(), nil)
+        return
+    }
+
+    json.NewEncoder(w).Encode(result)
+}
+
+func parseSearchQuery(r *http.Request) (models.SearchQuery, []models.ValidationError) {
+    params := r.URL.Query()
+    query := models.SearchQuery{Query: strings.TrimSpace(params.Get("q"))}
+    validationErrors := []models.ValidationError{}
+
+    addError := func(field, message string) {
+        validationErrors = append(validationErrors, models.ValidationError{Field: field, Message: message})
+    }
+
+    if query.Query == "" {
+        addError("q", "q is required")
+    }
+
+    if doneStr := params.Get("done"); doneStr != "" {
+        done, err := strconv.ParseBool(doneStr)
+        if err != nil {
+            addError("done", "done parameter must be 'true' or 'false'")
+        } else {
+            query.Done = &done
+        }
+    }
+
+    if limitStr := params.Get("limit"); limitStr != "" {
+        limit, err := strconv.Atoi(limitStr)
+        if err != nil || limit <= 0 || limit > storage.MaxSearchLimit {
+            addError("limit", fmt.Sprintf("limit must be an integer between 1 and %d", storage.MaxSearchLimit))
+        } else {
+            query.Limit = limit
+        }
+    }
+
+    if offsetStr := params.Get("offset"); offsetStr != "" {
+        offset, err := strconv.Atoi(offsetStr)
+        if err != nil || offset < 0 {
+            addError("offset", "offset must be a non-negative integer")
+        } else {
+            query.Offset = offset
+        }
+    }
+
+    return query, validationErrors
+}
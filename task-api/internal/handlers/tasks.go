@@ -1,97 +1,206 @@
 package handlers
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
+    "io"
+    "math"
     "net/http"
+    "net/url"
     "strconv"
     "strings"
     "task-api/internal/external"
     "task-api/internal/middleware"
     "task-api/internal/models"
     "task-api/internal/storage"
+    "task-api/internal/tracing"
+    "time"
 )
 
 type TaskHandler struct {
-    store     *storage.TaskStore
-    apiClient *external.APIClient
+    store        storage.TaskRepository
+    apiClient    *external.APIClient
+    //writeTimeout - WriteTimeout сервера, потоковый экспорт продлевает его на
+    //каждую страницу; 0 - без таймаута, как и у сервера
+    writeTimeout time.Duration
 }
 
-func NewTaskHandler(store *storage.TaskStore, apiClient *external.APIClient) *TaskHandler {
+func NewTaskHandler(store storage.TaskRepository, apiClient *external.APIClient, writeTimeout time.Duration) *TaskHandler {
     return &TaskHandler{
-        store:     store,
-        apiClient: apiClient,
+        store:        store,
+        apiClient:    apiClient,
+        writeTimeout: writeTimeout,
     }
 }
 
-func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
+//ListTasks отдает список задач. Старая форма GET /tasks?id=1 оставлена как алиас GET /tasks/{id}.
+func (h *TaskHandler) ListTasks(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Query().Get("id") != "" {
+        h.GetTaskByID(w, r)
+        return
+    }
+    
     w.Header().Set("Content-Type", "application/json")
     
-    idStr := r.URL.Query().Get("id")
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
     
-    if idStr != "" {
-        id, err := strconv.Atoi(idStr)
-        if err != nil || id <= 0 {
-            w.WriteHeader(http.StatusBadRequest)
-            sendError(w, r, "invalid id", "id must be a positive integer", nil)
-            return
-        }
-        
-        task, exists := h.store.GetByID(id)
-        if !exists {
-            w.WriteHeader(http.StatusNotFound)
-            sendError(w, r, "task not found", fmt.Sprintf("task with id %d does not exist", id), nil)
-            return
-        }
-        
-        json.NewEncoder(w).Encode(task)
+    query, validationErrors := parseTaskQuery(r)
+    if len(validationErrors) > 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid query parameters", 
+            fmt.Sprintf("found %d validation error(s)", len(validationErrors)), 
+            validationErrors)
         return
     }
     
-    doneFilter := r.URL.Query().Get("done")
-    var filterDone *bool
+    page, err := h.store.GetAllFiltered(principal.UserID, query)
+    if errors.Is(err, storage.ErrInvalidCursor) {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid cursor", "cursor is malformed or was issued for a different sort order", nil)
+        return
+    }
+    if err != nil {
+        w.WriteHeader(http.StatusInternalServerError)
+        sendError(w, r, "failed to list tasks", err.Error(), nil)
+        return
+    }
     
-    if doneFilter != "" {
-        parsedDone, err := strconv.ParseBool(doneFilter)
-        if err != nil {
-            w.WriteHeader(http.StatusBadRequest)
-            sendError(w, r, "invalid filter parameter", "done parameter must be 'true' or 'false'", nil)
-            return
-        }
-        filterDone = &parsedDone
+    json.NewEncoder(w).Encode(page)
+}
+
+func (h *TaskHandler) GetTaskByID(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+    
+    id, ok := taskIDFromRequest(w, r)
+    if !ok {
+        return
     }
     
-    tasks := h.store.GetAllFiltered(filterDone)
-    json.NewEncoder(w).Encode(tasks)
+    task, exists := h.store.GetByID(principal.UserID, id)
+    if !exists {
+        w.WriteHeader(http.StatusNotFound)
+        sendError(w, r, "task not found", fmt.Sprintf("task with id %d does not exist", id), nil)
+        return
+    }
+    
+    etag := taskETag(task)
+    w.Header().Set("ETag", etag)
+    if notModified(r, etag) {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+    
+    json.NewEncoder(w).Encode(task)
 }
 
-func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+//GetTaskTree отдает задачу со всеми подзадачами, открытыми блокерами и прогрессом
+func (h *TaskHandler) GetTaskTree(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     
-    var req struct {
-        Title string `json:"title"`
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
     }
     
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        w.WriteHeader(http.StatusBadRequest)
-        sendError(w, r, "invalid request body", "expected JSON with 'title' field", nil)
+    id, ok := taskIDFromRequest(w, r)
+    if !ok {
+        return
+    }
+    
+    tree, exists := h.store.Tree(principal.UserID, id)
+    if !exists {
+        w.WriteHeader(http.StatusNotFound)
+        sendError(w, r, "task not found", fmt.Sprintf("task with id %d does not exist", id), nil)
+        return
+    }
+    
+    json.NewEncoder(w).Encode(tree)
+}
+
+func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
         return
     }
     
-    req.Title = strings.TrimSpace(req.Title)
-    validationErrors := []models.ValidationError{}
+    var req map[string]json.RawMessage
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req == nil {
+        sendDecodeError(w, r, err, "expected JSON object with 'title' field")
+        return
+    }
     
-    if req.Title == "" {
+    patch, validationErrors := decodeTaskPatch(req)
+    if _, ok := req["title"]; !ok {
         validationErrors = append(validationErrors, models.ValidationError{
             Field:   "title",
-            Message: "title cannot be empty",
+            Message: "title is required",
         })
     }
     
-    if len(req.Title) > 100 {
+    if len(validationErrors) > 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "validation failed", 
+            fmt.Sprintf("found %d validation error(s)", len(validationErrors)), 
+            validationErrors)
+        return
+    }
+    
+    task := models.Task{UserID: principal.UserID}
+    patch.Apply(&task)
+    
+    createdTask, err := h.store.Create(r.Context(), task)
+    if err != nil {
+        sendTaskWriteError(w, r, 0, createdTask, err)
+        return
+    }
+    
+    w.Header().Set("ETag", taskETag(createdTask))
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(createdTask)
+}
+
+//ReplaceTask полностью заменяет задачу, непереданные поля сбрасываются в значения по умолчанию
+func (h *TaskHandler) ReplaceTask(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+    
+    id, ok := taskIDFromRequest(w, r)
+    if !ok {
+        return
+    }
+    
+    ifVersion, ok := h.preconditionFromRequest(w, r, principal.UserID, id)
+    if !ok {
+        return
+    }
+    
+    var req map[string]json.RawMessage
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req == nil {
+        sendDecodeError(w, r, err, "expected JSON object with 'title' field")
+        return
+    }
+    
+    patch, validationErrors := decodeTaskPatch(req)
+    if _, ok := req["title"]; !ok {
         validationErrors = append(validationErrors, models.ValidationError{
             Field:   "title",
-            Message: "title too long, maximum 100 characters",
+            Message: "title is required",
         })
     }
     
@@ -103,74 +212,87 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
         return
     }
     
-    task := models.Task{
-        Title: req.Title,
-        Done:  false,
+    updatedTask, err := h.store.Update(r.Context(), principal.UserID, id, fillReplacementDefaults(patch), ifVersion)
+    if err != nil {
+        sendTaskWriteError(w, r, id, updatedTask, err)
+        return
     }
     
-    createdTask := h.store.Create(task)
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(createdTask)
+    w.Header().Set("ETag", taskETag(updatedTask))
+    json.NewEncoder(w).Encode(updatedTask)
 }
 
 func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     
-    idStr := r.URL.Query().Get("id")
-    if idStr == "" {
-        w.WriteHeader(http.StatusBadRequest)
-        sendError(w, r, "missing parameter", "id query parameter is required", nil)
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
         return
     }
     
-    id, err := strconv.Atoi(idStr)
-    if err != nil || id <= 0 {
-        w.WriteHeader(http.StatusBadRequest)
-        sendError(w, r, "invalid id", "id must be a positive integer", nil)
+    id, ok := taskIDFromRequest(w, r)
+    if !ok {
         return
     }
     
-    var req struct {
-        Done bool `json:"done"`
+    ifVersion, ok := h.preconditionFromRequest(w, r, principal.UserID, id)
+    if !ok {
+        return
     }
     
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    var req map[string]json.RawMessage
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req == nil {
+        sendDecodeError(w, r, err, "expected JSON object with task fields to update")
+        return
+    }
+    
+    patch, validationErrors := decodeTaskPatch(req)
+    if len(validationErrors) == 0 && patch.IsEmpty() {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "body",
+            Message: "at least one field must be provided",
+        })
+    }
+    
+    if len(validationErrors) > 0 {
         w.WriteHeader(http.StatusBadRequest)
-        sendError(w, r, "invalid request body", "expected JSON with 'done' field (boolean)", nil)
+        sendError(w, r, "validation failed", 
+            fmt.Sprintf("found %d validation error(s)", len(validationErrors)), 
+            validationErrors)
         return
     }
     
-    updatedTask, exists := h.store.Update(id, req.Done)
-    if !exists {
-        w.WriteHeader(http.StatusNotFound)
-        sendError(w, r, "task not found", fmt.Sprintf("task with id %d does not exist", id), nil)
+    updatedTask, err := h.store.Update(r.Context(), principal.UserID, id, patch, ifVersion)
+    if err != nil {
+        sendTaskWriteError(w, r, id, updatedTask, err)
         return
     }
     
+    w.Header().Set("ETag", taskETag(updatedTask))
     json.NewEncoder(w).Encode(updatedTask)
 }
 
 func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     
-    idStr := r.URL.Query().Get("id")
-    if idStr == "" {
-        w.WriteHeader(http.StatusBadRequest)
-        sendError(w, r, "missing parameter", "id query parameter is required", nil)
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
         return
     }
     
-    id, err := strconv.Atoi(idStr)
-    if err != nil || id <= 0 {
-        w.WriteHeader(http.StatusBadRequest)
-        sendError(w, r, "invalid id", "id must be a positive integer", nil)
+    id, ok := taskIDFromRequest(w, r)
+    if !ok {
         return
     }
     
-    deleted := h.store.Delete(id)
-    if !deleted {
-        w.WriteHeader(http.StatusNotFound)
-        sendError(w, r, "task not found", fmt.Sprintf("task with id %d does not exist", id), nil)
+    ifVersion, ok := h.preconditionFromRequest(w, r, principal.UserID, id)
+    if !ok {
+        return
+    }
+    
+    current, err := h.store.Delete(r.Context(), principal.UserID, id, ifVersion)
+    if err != nil {
+        sendTaskWriteError(w, r, id, current, err)
         return
     }
     
@@ -184,10 +306,9 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 func (h *TaskHandler) GetExternalTodos(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     
-    todos, err := h.apiClient.GetExternalTodos()
+    todos, err := h.apiClient.GetExternalTodos(r.Context())
     if err != nil {
-        w.WriteHeader(http.StatusInternalServerError)
-        sendError(w, r, "failed to fetch external todos", err.Error(), nil)
+        sendUpstreamError(w, r, "failed to fetch external todos", err)
         return
     }
     
@@ -198,13 +319,88 @@ func (h *TaskHandler) GetExternalTodos(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(todos)
 }
 
+//ImportExternalTodos переносит todo из внешнего API в задачи вызывающего.
+//Повторный импорт обновляет ранее импортированные задачи по external_ref, а не дублирует их.
+func (h *TaskHandler) ImportExternalTodos(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+    
+    var req models.ImportTodosRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+        sendDecodeError(w, r, err, "expected optional JSON with userId and limit fields")
+        return
+    }
+    
+    if req.UserID < 0 || req.Limit < 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "validation failed", "userId and limit must not be negative", nil)
+        return
+    }
+    
+    todos, err := h.apiClient.GetExternalTodos(r.Context())
+    if err != nil {
+        sendUpstreamError(w, r, "failed to fetch external todos", err)
+        return
+    }
+    
+    summary := models.ImportSummary{}
+    for i, todo := range todos {
+        if req.UserID != 0 && todo.UserID != req.UserID {
+            continue
+        }
+        if req.Limit != 0 && summary.Total >= req.Limit {
+            break
+        }
+        summary.Total++
+        
+        title := strings.TrimSpace(todo.Title)
+        if title == "" || len(title) > maxTitleLength {
+            summary.Skipped++
+            summary.Errors = append(summary.Errors, models.ValidationError{
+                Field:   fmt.Sprintf("todos[%d].title", i),
+                Message: fmt.Sprintf("todo %d: title must be 1-%d characters", todo.ID, maxTitleLength),
+            })
+            continue
+        }
+        
+        _, result, err := h.store.UpsertByExternalRef(r.Context(), models.Task{
+            Title:       title,
+            Done:        todo.Completed,
+            UserID:      principal.UserID,
+            ExternalRef: fmt.Sprintf("todos/%d", todo.ID),
+        })
+        if err != nil {
+            summary.Failed++
+            summary.Errors = append(summary.Errors, models.ValidationError{
+                Field:   fmt.Sprintf("todos[%d]", i),
+                Message: fmt.Sprintf("todo %d: %v", todo.ID, err),
+            })
+            continue
+        }
+        
+        switch result {
+        case models.UpsertCreated:
+            summary.Created++
+        case models.UpsertUpdated:
+            summary.Updated++
+        default:
+            summary.Skipped++
+        }
+    }
+    
+    json.NewEncoder(w).Encode(summary)
+}
+
 func (h *TaskHandler) CreateExternalPost(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     
     var req models.CreatePostRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        w.WriteHeader(http.StatusBadRequest)
-        sendError(w, r, "invalid request body", "expected JSON with title, body, and userId fields", nil)
+        sendDecodeError(w, r, err, "expected JSON with title, body, and userId fields")
         return
     }
     
@@ -214,10 +410,9 @@ func (h *TaskHandler) CreateExternalPost(w http.ResponseWriter, r *http.Request)
         return
     }
     
-    post, err := h.apiClient.CreateExternalPost(req)
+    post, err := h.apiClient.CreateExternalPost(r.Context(), req)
     if err != nil {
-        w.WriteHeader(http.StatusInternalServerError)
-        sendError(w, r, "failed to create external post", err.Error(), nil)
+        sendUpstreamError(w, r, "failed to create external post", err)
         return
     }
     
@@ -232,9 +427,150 @@ func sendError(w http.ResponseWriter, r *http.Request, errorMsg, details string,
         Errors:  validationErrors,
     }
     
-    if requestID, ok := r.Context().Value(middleware.RequestIDKey).(string); ok {
+    if requestID, ok := tracing.RequestIDFromContext(r.Context()); ok {
         errorResponse.RequestID = requestID
     }
     
     json.NewEncoder(w).Encode(errorResponse)
+}
+
+//sendTaskWriteError отвечает 404 на чужую или несуществующую задачу, 412 с
+//актуальным ETag, если не совпала версия из If-Match, 400 на неверные связи
+//и 409 на попытку закрыть задачу с открытыми блокерами
+func sendTaskWriteError(w http.ResponseWriter, r *http.Request, id int, current models.Task, err error) {
+    var linkErr *storage.LinkError
+    if errors.As(err, &linkErr) {
+        if errors.Is(err, storage.ErrTaskBlocked) {
+            w.WriteHeader(http.StatusConflict)
+            sendError(w, r, "task is blocked", linkErr.Message, nil)
+            return
+        }
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "validation failed", "found 1 validation error(s)", []models.ValidationError{{
+            Field:   linkErr.Field,
+            Message: linkErr.Message,
+        }})
+        return
+    }
+    
+    if errors.Is(err, storage.ErrVersionMismatch) {
+        w.Header().Set("ETag", taskETag(current))
+        w.WriteHeader(http.StatusPreconditionFailed)
+        sendError(w, r, "precondition failed",
+            fmt.Sprintf("task %d has been modified, current version is %d", id, current.Version), nil)
+        return
+    }
+    
+    w.WriteHeader(http.StatusNotFound)
+    sendError(w, r, "task not found", fmt.Sprintf("task with id %d does not exist", id), nil)
+}
+
+//sendDecodeError отвечает 413, если тело обрезано MaxBodyMiddleware, иначе 400
+func sendDecodeError(w http.ResponseWriter, r *http.Request, err error, details string) {
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) {
+        w.WriteHeader(http.StatusRequestEntityTooLarge)
+        sendError(w, r, "request body too large", fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit), nil)
+        return
+    }
+    
+    w.WriteHeader(http.StatusBadRequest)
+    sendError(w, r, "invalid request body", details, nil)
+}
+
+//sendUpstreamError отвечает 503 с Retry-After, пока брейкер открыт, и 502 на прочие сбои апстрима
+func sendUpstreamError(w http.ResponseWriter, r *http.Request, errorMsg string, err error) {
+    middleware.LoggerFromContext(r.Context()).Warn("external API call failed", "error", err)
+    
+    var openErr *external.CircuitOpenError
+    if errors.As(err, &openErr) {
+        seconds := int(math.Ceil(openErr.RetryAfter.Seconds()))
+        if seconds < 1 {
+            seconds = 1
+        }
+        w.Header().Set("Retry-After", strconv.Itoa(seconds))
+        w.WriteHeader(http.StatusServiceUnavailable)
+        sendError(w, r, errorMsg, err.Error(), nil)
+        return
+    }
+    
+    if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+        w.WriteHeader(http.StatusGatewayTimeout)
+        sendError(w, r, errorMsg, err.Error(), nil)
+        return
+    }
+    
+    w.WriteHeader(http.StatusBadGateway)
+    sendError(w, r, errorMsg, err.Error(), nil)
+}
+
+//taskIDFromRequest берет ID из пути /tasks/{id}, а для устаревших маршрутов - из ?id=.
+//При ошибке сам пишет ответ и возвращает false.
+func taskIDFromRequest(w http.ResponseWriter, r *http.Request) (int, bool) {
+    idStr := r.PathValue("id")
+    if idStr == "" {
+        idStr = r.URL.Query().Get("id")
+        if idStr == "" {
+            w.WriteHeader(http.StatusBadRequest)
+            sendError(w, r, "missing parameter", "task id is required, use /tasks/{id}", nil)
+            return 0, false
+        }
+        
+        w.Header().Set("Deprecation", "true")
+        w.Header().Set("Link", fmt.Sprintf("</tasks/%s>; rel=\"successor-version\"", url.PathEscape(idStr)))
+    }
+    
+    id, err := strconv.Atoi(idStr)
+    if err != nil || id <= 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid id", "id must be a positive integer", nil)
+        return 0, false
+    }
+    
+    return id, true
+}
+
+//fillReplacementDefaults дополняет патч для PUT, чтобы он переписал все поля задачи
+func fillReplacementDefaults(patch models.TaskPatch) models.TaskPatch {
+    if patch.ParentID == nil {
+        patch.ClearParent = true
+    }
+    if patch.BlockedBy == nil {
+        blockedBy := []int{}
+        patch.BlockedBy = &blockedBy
+    }
+    if patch.Recurrence == nil {
+        patch.ClearRecurrence = true
+    }
+    if patch.Description == nil {
+        description := ""
+        patch.Description = &description
+    }
+    if patch.Done == nil {
+        done := false
+        patch.Done = &done
+    }
+    if patch.DueAt == nil {
+        patch.ClearDueAt = true
+    }
+    if patch.Priority == nil {
+        priority := models.PriorityNormal
+        patch.Priority = &priority
+    }
+    if patch.Tags == nil {
+        tags := []string{}
+        patch.Tags = &tags
+    }
+    return patch
+}
+
+//principalFromRequest достает владельца запроса из контекста, без него работать с задачами нельзя
+func principalFromRequest(w http.ResponseWriter, r *http.Request) (models.Principal, bool) {
+    principal, ok := middleware.PrincipalFromContext(r.Context())
+    if !ok {
+        w.WriteHeader(http.StatusUnauthorized)
+        sendError(w, r, "unauthorized", "request is not associated with an API key owner", nil)
+        return models.Principal{}, false
+    }
+    return principal, true
 }
\ No newline at end of file
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "task-api/internal/models"
+    "task-api/internal/storage"
+)
+
+//taskMux - маршруты задач, как в main, без проверки ключа
+func taskMux(h *TaskHandler) *http.ServeMux {
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /tasks", h.ListTasks)
+    mux.HandleFunc("POST /tasks/bulk", h.BulkTasks)
+    mux.HandleFunc("GET /tasks/search", h.SearchTasks)
+    mux.HandleFunc("GET /tasks/export", h.ExportTasks)
+    mux.HandleFunc("GET /tasks/{id}", h.GetTaskByID)
+    mux.HandleFunc("GET /tasks/{id}/tree", h.GetTaskTree)
+    mux.HandleFunc("PUT /tasks/{id}", h.ReplaceTask)
+    mux.HandleFunc("PATCH /tasks/{id}", h.UpdateTask)
+    mux.HandleFunc("DELETE /tasks/{id}", h.DeleteTask)
+    mux.HandleFunc("PATCH /tasks", h.UpdateTask)
+    mux.HandleFunc("DELETE /tasks", h.DeleteTask)
+    return mux
+}
+
+func TestOwnerIsolation(t *testing.T) {
+    store := storage.NewTaskStore()
+    mine := mustCreate(t, store, models.Task{Title: "my groceries", UserID: 1})
+    foreign := mustCreate(t, store, models.Task{Title: "secret groceries", Description: "not yours", UserID: 2})
+    mux := taskMux(NewTaskHandler(store, nil, 0))
+
+    t.Run("Foreign task looks missing", func(t *testing.T) {
+        tests := []struct {
+            method, target, body string
+        }{
+            {http.MethodGet, "/tasks/%d", ""},
+            {http.MethodGet, "/tasks?id=%d", ""},
+            {http.MethodGet, "/tasks/%d/tree", ""},
+            {http.MethodPut, "/tasks/%d", `{"title":"stolen","done":true}`},
+            {http.MethodPatch, "/tasks/%d", `{"title":"stolen"}`},
+            {http.MethodPatch, "/tasks?id=%d", `{"title":"stolen"}`},
+            {http.MethodDelete, "/tasks/%d", ""},
+            {http.MethodDelete, "/tasks?id=%d", ""},
+        }
+        for _, tt := range tests {
+            target := fmt.Sprintf(tt.target, foreign.ID)
+            t.Run(tt.method+" "+target, func(t *testing.T) {
+                w := httptest.NewRecorder()
+                mux.ServeHTTP(w, asOwner(1, tt.method, target, tt.body))
+                if w.Code != http.StatusNotFound {
+                    t.Errorf("expected 404, got %d: %s", w.Code, w.Body)
+                }
+                //ответ не должен отличаться от ответа на несуществующую задачу
+                if strings.Contains(w.Body.String(), "secret") {
+                    t.Errorf("expected foreign task not to leak, got %s", w.Body)
+                }
+            })
+        }
+
+        task, _ := store.GetByID(2, foreign.ID)
+        if task.Title != "secret groceries" || task.Version != 1 {
+            t.Errorf("expected foreign task to stay untouched, got %+v", task)
+        }
+    })
+
+    t.Run("Bulk cannot touch foreign tasks", func(t *testing.T) {
+        body := fmt.Sprintf(`{"mode":"best_effort","operations":[{"op":"update","id":%d,"task":{"title":"stolen"}},{"op":"delete","id":%d}]}`, foreign.ID, foreign.ID)
+        w := httptest.NewRecorder()
+        mux.ServeHTTP(w, asOwner(1, http.MethodPost, "/tasks/bulk", body))
+        var resp struct {
+            Succeeded int `json:"succeeded"`
+            Failed    int `json:"failed"`
+        }
+        json.Unmarshal(w.Body.Bytes(), &resp)
+        if resp.Succeeded != 0 || resp.Failed != 2 || strings.Contains(w.Body.String(), "secret") {
+            t.Errorf("expected both operations to fail as not found, got %d: %s", w.Code, w.Body)
+        }
+        if task, exists := store.GetByID(2, foreign.ID); !exists || task.Version != 1 {
+            t.Errorf("expected foreign task to survive bulk, got %+v", task)
+        }
+    })
+
+    t.Run("Foreign tasks are not listed, searched or exported", func(t *testing.T) {
+        for _, target := range []string{"/tasks", "/tasks?title=groceries", "/tasks/search?q=groceries", "/tasks/export"} {
+            w := httptest.NewRecorder()
+            mux.ServeHTTP(w, asOwner(1, http.MethodGet, target, ""))
+            if w.Code != http.StatusOK {
+                t.Fatalf("%s: expected 200, got %d: %s", target, w.Code, w.Body)
+            }
+            body := w.Body.String()
+            if strings.Contains(body, "secret") || !strings.Contains(body, "my groceries") {
+                t.Errorf("%s: expected only the caller's tasks, got %s", target, body)
+            }
+        }
+    })
+
+    t.Run("Links to foreign tasks are rejected", func(t *testing.T) {
+        body := fmt.Sprintf(`{"parent_id":%d,"blocked_by":[%d]}`, foreign.ID, foreign.ID)
+        w := httptest.NewRecorder()
+        mux.ServeHTTP(w, asOwner(1, http.MethodPatch, fmt.Sprintf("/tasks/%d", mine.ID), body))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("expected 400, got %d: %s", w.Code, w.Body)
+        }
+    })
+
+    t.Run("Owner sees own task", func(t *testing.T) {
+        w := httptest.NewRecorder()
+        mux.ServeHTTP(w, asOwner(2, http.MethodGet, fmt.Sprintf("/tasks/%d", foreign.ID), ""))
+        var task models.Task
+        json.Unmarshal(w.Body.Bytes(), &task)
+        if w.Code != http.StatusOK || task.ID != foreign.ID {
+            t.Errorf("expected owner to read the task, got %d: %s", w.Code, w.Body)
+        }
+    })
+}
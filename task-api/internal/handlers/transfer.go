@@ -0,0 +1,798 @@
+package handlers
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "task-api/internal/middleware"
+    "task-api/internal/models"
+    "task-api/internal/recurrence"
+    "task-api/internal/storage"
+    "time"
+)
+
+const (
+    //maxImportRows ограничивает время, которое импорт занимает одним запросом
+    maxImportRows = 10000
+    //maxImportLineBytes - предел строки JSON Lines, задача с полным описанием намного меньше
+    maxImportLineBytes = 64 << 10
+    //MaxImportBytes - предел тела POST /tasks/import вместо общего server.max_body_bytes
+    MaxImportBytes = maxImportRows * maxImportLineBytes
+    //listSeparator разделяет теги и блокеры в ячейке CSV
+    listSeparator = ";"
+)
+
+//csvColumns - колонки экспорта в CSV. Импорт принимает их в любом порядке,
+//обязательна только title.
+var csvColumns = []string{
+    "id", "title", "description", "done", "due_at", "priority", "tags",
+    "parent_id", "blocked_by",
+    "recurrence_rule", "recurrence_timezone", "recurrence_start", "recurrence_next_at", "recurrence_series_id",
+    "external_ref", "version", "created_at", "updated_at",
+}
+
+//importIgnoredFields назначает сервер: в файле экспорта они есть, но при
+//импорте пропускаются, а не считаются ошибкой, как в POST /tasks
+var importIgnoredFields = []string{"userId", "external_ref", "version", "created_at", "updated_at"}
+
+var transferContentTypes = map[models.TransferFormat]string{
+    models.FormatJSONL: "application/x-ndjson",
+    models.FormatCSV:   "text/csv; charset=utf-8",
+}
+
+//ExportTasks выгружает все задачи вызывающего: GET /tasks/export?format=jsonl|csv.
+//Задачи читаются страницами по ID и сразу уходят клиенту, весь набор в
+//памяти не собирается.
+func (h *TaskHandler) ExportTasks(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    format, ok := parseTransferFormat(r.URL.Query().Get("format"), models.FormatJSONL)
+    if !ok {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid query parameters", "found 1 validation error(s)", []models.ValidationError{{
+            Field:   "format",
+            Message: "format must be one of: jsonl, csv",
+        }})
+        return
+    }
+
+    //первая страница читается до заголовков, пока ошибку еще можно отдать как JSON
+    query := models.TaskQuery{Sort: models.SortByID, Limit: storage.MaxPageLimit}
+    page, err := h.store.GetAllFiltered(principal.UserID, query)
+    if err != nil {
+        w.WriteHeader(http.StatusInternalServerError)
+        sendError(w, r, "failed to export tasks", err.Error(), nil)
+        return
+    }
+
+    //большая выгрузка идет дольше WriteTimeout сервера, поэтому дедлайн
+    //продлевается перед каждой страницей: зависший клиент все равно отвалится
+    rc := http.NewResponseController(w)
+    extendDeadline := func() error {
+        if h.writeTimeout <= 0 {
+            return nil
+        }
+        return rc.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+    }
+    if err := extendDeadline(); err != nil {
+        w.WriteHeader(http.StatusInternalServerError)
+        sendError(w, r, "failed to export tasks", err.Error(), nil)
+        return
+    }
+
+    w.Header().Set("Content-Type", transferContentTypes[format])
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"tasks.%s\"", format))
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(http.StatusOK)
+
+    out := newTaskWriter(w, format)
+    for {
+        for _, task := range page.Items {
+            if err := out.Write(task); err != nil {
+                return
+            }
+        }
+        if err := out.Flush(); err != nil {
+            return
+        }
+        if err := rc.Flush(); err != nil {
+            return
+        }
+        if page.NextCursor == "" {
+            return
+        }
+
+        query.Cursor = page.NextCursor
+        page, err = h.store.GetAllFiltered(principal.UserID, query)
+        if err != nil {
+            //заголовки уже ушли, клиент получит оборванный файл
+            middleware.LoggerFromContext(r.Context()).Error("task export aborted", "error", err)
+            return
+        }
+        if err := extendDeadline(); err != nil {
+            middleware.LoggerFromContext(r.Context()).Error("task export aborted", "error", err)
+            return
+        }
+    }
+}
+
+type taskWriter interface {
+    Write(task models.Task) error
+    Flush() error
+}
+
+func newTaskWriter(w io.Writer, format models.TransferFormat) taskWriter {
+    if format == models.FormatCSV {
+        cw := csv.NewWriter(w)
+        cw.Write(csvColumns)
+        return csvTaskWriter{cw}
+    }
+    return jsonlTaskWriter{json.NewEncoder(w)}
+}
+
+type jsonlTaskWriter struct {
+    enc *json.Encoder
+}
+
+func (jw jsonlTaskWriter) Write(task models.Task) error {
+    return jw.enc.Encode(task)
+}
+
+func (jw jsonlTaskWriter) Flush() error {
+    return nil
+}
+
+type csvTaskWriter struct {
+    w *csv.Writer
+}
+
+func (cw csvTaskWriter) Write(task models.Task) error {
+    return cw.w.Write(csvRecord(task))
+}
+
+func (cw csvTaskWriter) Flush() error {
+    cw.w.Flush()
+    return cw.w.Error()
+}
+
+//csvRecord раскладывает задачу по csvColumns
+func csvRecord(task models.Task) []string {
+    record := []string{
+        strconv.Itoa(task.ID),
+        task.Title,
+        task.Description,
+        strconv.FormatBool(task.Done),
+        formatTime(task.DueAt),
+        string(task.Priority),
+        strings.Join(task.Tags, listSeparator),
+        "",
+        joinInts(task.BlockedBy),
+        "", "", "", "", "",
+        task.ExternalRef,
+        strconv.Itoa(task.Version),
+        formatTime(&task.CreatedAt),
+        formatTime(&task.UpdatedAt),
+    }
+    if task.ParentID != nil {
+        record[7] = strconv.Itoa(*task.ParentID)
+    }
+    if rec := task.Recurrence; rec != nil {
+        record[9] = rec.Rule
+        record[10] = rec.Timezone
+        record[11] = formatTime(&rec.Start)
+        record[12] = formatTime(rec.NextAt)
+        record[13] = strconv.Itoa(rec.SeriesID)
+    }
+    return record
+}
+
+func formatTime(t *time.Time) string {
+    if t == nil || t.IsZero() {
+        return ""
+    }
+    return t.UTC().Format(time.RFC3339Nano)
+}
+
+func joinInts(ids []int) string {
+    parts := make([]string, len(ids))
+    for i, id := range ids {
+        parts[i] = strconv.Itoa(id)
+    }
+    return strings.Join(parts, listSeparator)
+}
+
+//importRow - строка файла импорта после проверки. id - ID задачи в файле,
+//по нему перепривязываются parent_id, blocked_by и серии повторений.
+//Связи ставятся отдельным шагом, когда созданы все задачи.
+type importRow struct {
+    line      int
+    id        int
+    patch     models.TaskPatch
+    rec       *models.Recurrence
+    parentID  *int
+    blockedBy []int
+    errors    []models.ValidationError
+    //taskID - созданная задача, 0 если строка не импортирована
+    taskID    int
+}
+
+//ImportTasks загружает задачи из файла экспорта: POST /tasks/import?format=jsonl|csv&dry_run=true.
+//Каждая строка проверяется по тем же правилам, что и POST /tasks, серверные
+//поля (userId, version, даты) пропускаются. parent_id и blocked_by,
+//указывающие на id из файла, переводятся на новые ID, остальные должны
+//ссылаться на существующие задачи. Строки с ошибками пропускаются, остальные
+//создаются; dry_run только проверяет файл. Отчет приходит со статусом 200.
+func (h *TaskHandler) ImportTasks(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    format, dryRun, validationErrors := parseImportParams(r)
+    if len(validationErrors) > 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "invalid query parameters",
+            fmt.Sprintf("found %d validation error(s)", len(validationErrors)),
+            validationErrors)
+        return
+    }
+
+    body := skipBOM(r.Body)
+    var raws []rawImportRow
+    var err error
+    if format == models.FormatCSV {
+        raws, err = readCSVRows(body)
+    } else {
+        raws, err = readJSONLRows(body)
+    }
+    if err == nil && len(raws) == 0 {
+        err = errors.New("import file contains no tasks")
+    }
+    if err != nil {
+        sendDecodeError(w, r, err, err.Error())
+        return
+    }
+
+    rows := make([]importRow, len(raws))
+    for i, raw := range raws {
+        rows[i] = decodeImportRow(raw)
+    }
+    h.checkImportLinks(principal.UserID, rows)
+
+    report := models.ImportReport{Format: format, DryRun: dryRun, Total: len(rows)}
+    if !dryRun {
+        report.IDs = h.applyImport(r.Context(), principal.UserID, rows)
+    }
+
+    for _, row := range rows {
+        if row.taskID != 0 || dryRun && len(row.errors) == 0 {
+            report.Created++
+        }
+        if len(row.errors) > 0 {
+            report.Errors = append(report.Errors, models.ImportLineError{
+                Line:   row.line,
+                TaskID: row.taskID,
+                Errors: row.errors,
+            })
+        }
+    }
+    report.Failed = report.Total - report.Created
+
+    json.NewEncoder(w).Encode(report)
+}
+
+func parseTransferFormat(value string, fallback models.TransferFormat) (models.TransferFormat, bool) {
+    format := models.TransferFormat(strings.ToLower(strings.TrimSpace(value)))
+    switch format {
+    case "":
+        return fallback, true
+    case models.FormatJSONL, models.FormatCSV:
+        return format, true
+    }
+    return "", false
+}
+
+//parseImportParams берет формат из ?format=, а без него - из Content-Type
+func parseImportParams(r *http.Request) (models.TransferFormat, bool, []models.ValidationError) {
+    params := r.URL.Query()
+    validationErrors := []models.ValidationError{}
+
+    fallback := models.FormatJSONL
+    if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediaType == "text/csv" {
+        fallback = models.FormatCSV
+    }
+    format, ok := parseTransferFormat(params.Get("format"), fallback)
+    if !ok {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "format",
+            Message: "format must be one of: jsonl, csv",
+        })
+    }
+
+    dryRun := false
+    if value := params.Get("dry_run"); value != "" {
+        parsed, err := strconv.ParseBool(value)
+        if err != nil {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "dry_run",
+                Message: "dry_run must be true or false",
+            })
+        }
+        dryRun = parsed
+    }
+    return format, dryRun, validationErrors
+}
+
+//rawImportRow - строка файла в виде полей задачи. CSV приводится к тому же
+//JSON, что и JSON Lines, чтобы проверка шла через decodeTaskPatch.
+type rawImportRow struct {
+    line   int
+    fields map[string]json.RawMessage
+    err    string
+}
+
+//skipBOM убирает метку порядка байтов, которую ставят табличные редакторы
+func skipBOM(body io.Reader) io.Reader {
+    br := bufio.NewReader(body)
+    if prefix, err := br.Peek(3); err == nil && string(prefix) == "\xef\xbb\xbf" {
+        br.Discard(3)
+    }
+    return br
+}
+
+func readJSONLRows(body io.Reader) ([]rawImportRow, error) {
+    scanner := bufio.NewScanner(body)
+    scanner.Buffer(make([]byte, 0, 4096), maxImportLineBytes)
+
+    var rows []rawImportRow
+    line := 0
+    for scanner.Scan() {
+        line++
+        text := bytes.TrimSpace(scanner.Bytes())
+        if len(text) == 0 {
+            continue
+        }
+        if len(rows) == maxImportRows {
+            return nil, fmt.Errorf("import is limited to %d tasks per request", maxImportRows)
+        }
+
+        row := rawImportRow{line: line}
+        if err := json.Unmarshal(text, &row.fields); err != nil || row.fields == nil {
+            row.err = "line must be a JSON object with task fields"
+        }
+        rows = append(rows, row)
+    }
+
+    if err := scanner.Err(); err != nil {
+        if errors.Is(err, bufio.ErrTooLong) {
+            return nil, fmt.Errorf("line %d is longer than %d bytes", line+1, maxImportLineBytes)
+        }
+        return nil, err
+    }
+    return rows, nil
+}
+
+func readCSVRows(body io.Reader) ([]rawImportRow, error) {
+    reader := csv.NewReader(body)
+    header, err := reader.Read()
+    if errors.Is(err, io.EOF) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    seen := map[string]bool{}
+    for i, name := range header {
+        name = strings.ToLower(strings.TrimSpace(name))
+        if !slices.Contains(csvColumns, name) {
+            return nil, fmt.Errorf("unknown CSV column %q, expected: %s", name, strings.Join(csvColumns, ", "))
+        }
+        if seen[name] {
+            return nil, fmt.Errorf("duplicate CSV column %q", name)
+        }
+        seen[name] = true
+        header[i] = name
+    }
+    if !seen["title"] {
+        return nil, errors.New("CSV header must contain a title column")
+    }
+
+    var rows []rawImportRow
+    for {
+        record, err := reader.Read()
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if len(rows) == maxImportRows {
+            return nil, fmt.Errorf("import is limited to %d tasks per request", maxImportRows)
+        }
+
+        var parseErr *csv.ParseError
+        if errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrFieldCount) {
+            rows = append(rows, rawImportRow{
+                line: parseErr.StartLine,
+                err:  fmt.Sprintf("row has %d fields, header has %d", len(record), len(header)),
+            })
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        line, _ := reader.FieldPos(0)
+        rows = append(rows, rawImportRow{line: line, fields: csvFields(header, record)})
+    }
+    return rows, nil
+}
+
+//csvFields переводит ячейки в поля задачи. Пустая ячейка означает "не
+//передано", значение не того типа уходит строкой, и decodeTaskPatch
+//сообщит о нем так же, как для JSON.
+func csvFields(header, record []string) map[string]json.RawMessage {
+    fields := map[string]json.RawMessage{}
+    rec := map[string]json.RawMessage{}
+
+    for i, name := range header {
+        value := strings.TrimSpace(record[i])
+        switch name {
+        case "title", "description":
+            fields[name] = jsonString(record[i])
+        case "id", "parent_id":
+            if value != "" {
+                fields[name] = csvInt(value)
+            }
+        case "done":
+            if done, err := strconv.ParseBool(value); err == nil {
+                fields[name], _ = json.Marshal(done)
+            } else if value != "" {
+                fields[name] = jsonString(value)
+            }
+        case "due_at", "priority":
+            if value != "" {
+                fields[name] = jsonString(value)
+            }
+        case "tags":
+            if value != "" {
+                fields[name], _ = json.Marshal(strings.Split(value, listSeparator))
+            }
+        case "blocked_by":
+            if value != "" {
+                fields[name] = csvIntList(value)
+            }
+        case "recurrence_series_id":
+            if value != "" {
+                rec["series_id"] = csvInt(value)
+            }
+        case "recurrence_rule", "recurrence_timezone", "recurrence_start", "recurrence_next_at":
+            if value != "" {
+                rec[strings.TrimPrefix(name, "recurrence_")] = jsonString(value)
+            }
+        }
+        //остальные колонки назначает сервер
+    }
+
+    if len(rec) > 0 {
+        fields["recurrence"], _ = json.Marshal(rec)
+    }
+    return fields
+}
+
+func jsonString(value string) json.RawMessage {
+    data, _ := json.Marshal(value)
+    return data
+}
+
+func csvInt(value string) json.RawMessage {
+    n, err := strconv.Atoi(value)
+    if err != nil {
+        return jsonString(value)
+    }
+    return json.RawMessage(strconv.Itoa(n))
+}
+
+func csvIntList(value string) json.RawMessage {
+    parts := strings.Split(value, listSeparator)
+    ids := make([]int, len(parts))
+    for i, part := range parts {
+        id, err := strconv.Atoi(strings.TrimSpace(part))
+        if err != nil {
+            return jsonString(value)
+        }
+        ids[i] = id
+    }
+    data, _ := json.Marshal(ids)
+    return data
+}
+
+//decodeImportRow проверяет строку как тело POST /tasks. Повторение
+//разбирается отдельно: в файле оно хранит состояние серии, которое
+//восстанавливается вместе с задачей.
+func decodeImportRow(raw rawImportRow) importRow {
+    row := importRow{line: raw.line}
+    if raw.err != "" {
+        row.errors = []models.ValidationError{{Field: "task", Message: raw.err}}
+        return row
+    }
+
+    addError := func(field, message string) {
+        row.errors = append(row.errors, models.ValidationError{Field: field, Message: message})
+    }
+
+    fields := raw.fields
+    if value, ok := fields["id"]; ok {
+        delete(fields, "id")
+        if err := json.Unmarshal(value, &row.id); err != nil || row.id <= 0 {
+            row.id = 0
+            addError("id", "id must be a positive integer")
+        }
+    }
+    for _, field := range importIgnoredFields {
+        delete(fields, field)
+    }
+    if value, ok := fields["recurrence"]; ok {
+        delete(fields, "recurrence")
+        if string(value) != "null" {
+            rec, message := decodeImportedRecurrence(value)
+            if message != "" {
+                addError("recurrence", message)
+            }
+            row.rec = rec
+        }
+    }
+
+    patch, taskErrors := decodeTaskPatch(fields)
+    if _, ok := fields["title"]; !ok {
+        taskErrors = append(taskErrors, models.ValidationError{
+            Field:   "title",
+            Message: "title is required",
+        })
+    }
+    row.errors = append(row.errors, taskErrors...)
+
+    row.parentID = patch.ParentID
+    if patch.BlockedBy != nil {
+        row.blockedBy = *patch.BlockedBy
+    }
+    patch.ParentID, patch.ClearParent, patch.BlockedBy = nil, false, nil
+    row.patch = patch
+    return row
+}
+
+//decodeImportedRecurrence принимает повторение в том виде, в каком его
+//отдает API. Без start состояние серии не восстановить, и она начнется
+//заново, как у новой задачи.
+func decodeImportedRecurrence(value json.RawMessage) (*models.Recurrence, string) {
+    var rec models.Recurrence
+    dec := json.NewDecoder(bytes.NewReader(value))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&rec); err != nil {
+        return nil, "recurrence must be an object with 'rule', optional 'timezone', 'start', 'next_at' and 'series_id', or null"
+    }
+
+    rec.Rule = strings.TrimSpace(rec.Rule)
+    rec.Timezone = strings.TrimSpace(rec.Timezone)
+    if _, err := recurrence.Parse(rec.Rule, rec.Timezone); err != nil {
+        return nil, "invalid recurrence: " + err.Error()
+    }
+    if rec.SeriesID < 0 {
+        return nil, "recurrence series_id must be a positive task id"
+    }
+
+    rec.Start = rec.Start.UTC()
+    if rec.Start.IsZero() || rec.NextAt == nil {
+        rec.NextAt = nil
+    } else {
+        nextAt := rec.NextAt.UTC()
+        rec.NextAt = &nextAt
+    }
+    return &rec, ""
+}
+
+//checkImportLinks проверяет id и ссылки строк. Ссылка сначала ищется среди
+//id файла, потом среди задач владельца. Строка, ссылающаяся на строку с
+//ошибками, тоже не импортируется, поэтому проверка повторяется, пока
+//находятся новые ошибки.
+func (h *TaskHandler) checkImportLinks(ownerID int, rows []importRow) {
+    byID := map[int]int{}
+    for i, row := range rows {
+        if row.id == 0 {
+            continue
+        }
+        if first, duplicate := byID[row.id]; duplicate {
+            rows[i].errors = append(rows[i].errors, models.ValidationError{
+                Field:   "id",
+                Message: fmt.Sprintf("id %d is already used on line %d", row.id, rows[first].line),
+            })
+            continue
+        }
+        byID[row.id] = i
+    }
+
+    resolve := func(row importRow, ref int, kind string) string {
+        if ref == row.id {
+            return fmt.Sprintf("task cannot reference itself as %s", kind)
+        }
+        if i, inFile := byID[ref]; inFile {
+            if len(rows[i].errors) > 0 {
+                return fmt.Sprintf("%s task %d on line %d is not imported", kind, ref, rows[i].line)
+            }
+            return ""
+        }
+        if _, exists := h.store.GetByID(ownerID, ref); !exists {
+            return fmt.Sprintf("%s task %d is neither in the file nor an existing task", kind, ref)
+        }
+        return ""
+    }
+
+    for changed := true; changed; {
+        changed = false
+        for i := range rows {
+            row := &rows[i]
+            if len(row.errors) > 0 {
+                continue
+            }
+            if row.parentID != nil {
+                if message := resolve(*row, *row.parentID, "parent"); message != "" {
+                    row.errors = append(row.errors, models.ValidationError{Field: "parent_id", Message: message})
+                }
+            }
+            for _, blockerID := range row.blockedBy {
+                if message := resolve(*row, blockerID, "blocker"); message != "" {
+                    row.errors = append(row.errors, models.ValidationError{Field: "blocked_by", Message: message})
+                    break
+                }
+            }
+            changed = changed || len(row.errors) > 0
+        }
+    }
+}
+
+//applyImport создает задачи без связей, затем проставляет связи с новыми ID,
+//так что порядок строк в файле не важен. Возвращает соответствие id из
+//файла новым ID.
+func (h *TaskHandler) applyImport(ctx context.Context, ownerID int, rows []importRow) map[int]int {
+    ids := map[int]int{}
+    //seriesIDs - серии из файла и ID их первой созданной задачи
+    seriesIDs := map[int]int{}
+
+    for _, i := range importOrder(rows) {
+        row := &rows[i]
+        if len(row.errors) > 0 {
+            continue
+        }
+
+        task := models.Task{UserID: ownerID}
+        row.patch.Apply(&task)
+        if row.rec != nil {
+            rec := *row.rec
+            //неизвестная серия начнется с этой задачи
+            rec.SeriesID = seriesIDs[row.rec.SeriesID]
+            task.Recurrence = &rec
+        }
+
+        created, err := h.store.Create(ctx, task)
+        if err != nil {
+            row.errors = append(row.errors, importWriteError(err))
+            continue
+        }
+        row.taskID = created.ID
+        if row.id != 0 {
+            ids[row.id] = created.ID
+        }
+        if row.rec != nil && row.rec.SeriesID != 0 && created.Recurrence != nil {
+            if _, known := seriesIDs[row.rec.SeriesID]; !known {
+                seriesIDs[row.rec.SeriesID] = created.Recurrence.SeriesID
+            }
+        }
+    }
+
+    fileIDs := map[int]bool{}
+    for _, row := range rows {
+        fileIDs[row.id] = true
+    }
+    //ссылка на строку файла, которую не удалось создать, не должна попасть
+    //на чужую задачу с тем же ID
+    remap := func(ref int) (int, bool) {
+        if id, created := ids[ref]; created {
+            return id, true
+        }
+        return ref, !fileIDs[ref]
+    }
+    for i := range rows {
+        row := &rows[i]
+        if row.taskID == 0 || row.parentID == nil && row.blockedBy == nil {
+            continue
+        }
+
+        var patch models.TaskPatch
+        resolved := true
+        if row.parentID != nil {
+            parentID, ok := remap(*row.parentID)
+            patch.ParentID = &parentID
+            resolved = resolved && ok
+        }
+        if row.blockedBy != nil {
+            blockedBy := make([]int, len(row.blockedBy))
+            for j, blockerID := range row.blockedBy {
+                id, ok := remap(blockerID)
+                blockedBy[j] = id
+                resolved = resolved && ok
+            }
+            //id из файла и существующий ID могут совпасть после перевода
+            blockedBy, _ = normalizeBlockers(blockedBy)
+            patch.BlockedBy = &blockedBy
+        }
+        if !resolved {
+            row.errors = append(row.errors, models.ValidationError{
+                Field:   "task",
+                Message: "links were not restored, a referenced task from the file was not imported",
+            })
+            continue
+        }
+
+        if _, err := h.store.Update(ctx, ownerID, row.taskID, patch, 0); err != nil {
+            row.errors = append(row.errors, importWriteError(err))
+        }
+    }
+    return ids
+}
+
+//importOrder - порядок создания строк: как в файле, но прошлые вхождения
+//серий идут после ее последнего вхождения. Так хранилище видит, что они
+//уже передали серию, и не планирует их заново.
+func importOrder(rows []importRow) []int {
+    //head - строка с самым поздним сроком в каждой серии файла
+    head := map[int]int{}
+    for i, row := range rows {
+        if len(row.errors) > 0 || row.rec == nil || row.rec.SeriesID == 0 || row.patch.DueAt == nil {
+            continue
+        }
+        if j, ok := head[row.rec.SeriesID]; !ok || !row.patch.DueAt.Before(*rows[j].patch.DueAt) {
+            head[row.rec.SeriesID] = i
+        }
+    }
+
+    order := make([]int, 0, len(rows))
+    var past []int
+    for i, row := range rows {
+        if j, ok := head[seriesOf(row)]; ok && j != i && row.rec.NextAt == nil {
+            past = append(past, i)
+            continue
+        }
+        order = append(order, i)
+    }
+    return append(order, past...)
+}
+
+func seriesOf(row importRow) int {
+    if row.rec == nil {
+        return 0
+    }
+    return row.rec.SeriesID
+}
+
+func importWriteError(err error) models.ValidationError {
+    var linkErr *storage.LinkError
+    if errors.As(err, &linkErr) {
+        return models.ValidationError{Field: linkErr.Field, Message: linkErr.Message}
+    }
+    return models.ValidationError{Field: "task", Message: err.Error()}
+}
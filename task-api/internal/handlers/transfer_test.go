@@ -0,0 +1,280 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "task-api/internal/middleware"
+    "task-api/internal/models"
+    "task-api/internal/storage"
+)
+
+//asOwner - запрос от имени владельца, как после APIKeyMiddleware
+func asOwner(userID int, method, target string, body string) *http.Request {
+    r := httptest.NewRequest(method, target, strings.NewReader(body))
+    principal := models.Principal{UserID: userID, Name: "test", KeyID: "test"}
+    return r.WithContext(context.WithValue(r.Context(), middleware.PrincipalKey, principal))
+}
+
+func mustCreate(t *testing.T, store storage.TaskRepository, task models.Task) models.Task {
+    t.Helper()
+    created, err := store.Create(context.Background(), task)
+    if err != nil {
+        t.Fatalf("expected no error on create, got %v", err)
+    }
+    return created
+}
+
+func ownerTasks(t *testing.T, store storage.TaskRepository, userID int) map[string]models.Task {
+    t.Helper()
+    page, err := store.GetAllFiltered(userID, models.TaskQuery{Sort: models.SortByID, Limit: storage.MaxPageLimit})
+    if err != nil {
+        t.Fatal(err)
+    }
+    byTitle := map[string]models.Task{}
+    for _, task := range page.Items {
+        byTitle[task.Title] = task
+    }
+    return byTitle
+}
+
+func importFile(t *testing.T, h *TaskHandler, userID int, query, body string) models.ImportReport {
+    t.Helper()
+    w := httptest.NewRecorder()
+    h.ImportTasks(w, asOwner(userID, http.MethodPost, "/tasks/import"+query, body))
+    if w.Code != http.StatusOK {
+        t.Fatalf("expected 200 from import, got %d: %s", w.Code, w.Body)
+    }
+    var report models.ImportReport
+    if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+        t.Fatal(err)
+    }
+    return report
+}
+
+//seedExport заполняет хранилище задачами со всеми видами связей
+func seedExport(t *testing.T, store storage.TaskRepository) {
+    t.Helper()
+    due := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+    release := mustCreate(t, store, models.Task{Title: "release", UserID: 1, Priority: models.PriorityHigh, Tags: []string{"q4", "launch"}})
+    mustCreate(t, store, models.Task{Title: "other owner", UserID: 2})
+    notes := mustCreate(t, store, models.Task{Title: "write notes", Description: "with \"quotes\", commas\nand lines", UserID: 1, ParentID: &release.ID})
+    mustCreate(t, store, models.Task{Title: "publish", UserID: 1, ParentID: &release.ID, BlockedBy: []int{notes.ID}})
+
+    //закрытое вхождение передает серию следующему
+    report := mustCreate(t, store, models.Task{Title: "report", UserID: 1, DueAt: &due, Recurrence: &models.Recurrence{Rule: "FREQ=DAILY"}})
+    if _, err := store.Update(context.Background(), 1, report.ID, models.TaskPatch{Done: boolPtr(true)}, 0); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func boolPtr(b bool) *bool {
+    return &b
+}
+
+func TestExportImport(t *testing.T) {
+    for _, format := range []models.TransferFormat{models.FormatJSONL, models.FormatCSV} {
+        t.Run("Round trip in "+string(format), func(t *testing.T) {
+            source := storage.NewTaskStore()
+            seedExport(t, source)
+
+            w := httptest.NewRecorder()
+            NewTaskHandler(source, nil, 0).ExportTasks(w, asOwner(1, http.MethodGet, "/tasks/export?format="+string(format), ""))
+            if w.Code != http.StatusOK || w.Header().Get("Content-Type") != transferContentTypes[format] {
+                t.Fatalf("unexpected export response %d %q", w.Code, w.Header().Get("Content-Type"))
+            }
+            if strings.Contains(w.Body.String(), "other owner") {
+                t.Fatal("expected export to contain only the caller's tasks")
+            }
+
+            //у цели уже есть задачи, так что ID из файла заняты
+            target := storage.NewTaskStore()
+            for i := 0; i < 3; i++ {
+                mustCreate(t, target, models.Task{Title: "existing", UserID: 1})
+            }
+            report := importFile(t, NewTaskHandler(target, nil, 0), 1, "?format="+string(format), w.Body.String())
+            if report.Total != 5 || report.Created != 5 || report.Failed != 0 || len(report.IDs) != 5 {
+                t.Fatalf("unexpected report %+v", report)
+            }
+
+            before, after := ownerTasks(t, source, 1), ownerTasks(t, target, 1)
+            release, notes, publish := after["release"], after["write notes"], after["publish"]
+            if release.ID != report.IDs[before["release"].ID] || release.Priority != models.PriorityHigh || strings.Join(release.Tags, ",") != "q4,launch" {
+                t.Errorf("unexpected release %+v", release)
+            }
+            if notes.Description != before["write notes"].Description {
+                t.Errorf("expected description to survive, got %q", notes.Description)
+            }
+            if notes.ParentID == nil || *notes.ParentID != release.ID || publish.ParentID == nil || *publish.ParentID != release.ID {
+                t.Errorf("expected parent_id to be remapped to %d, got %v and %v", release.ID, notes.ParentID, publish.ParentID)
+            }
+            if len(publish.BlockedBy) != 1 || publish.BlockedBy[0] != notes.ID {
+                t.Errorf("expected blocked_by to be remapped to %d, got %v", notes.ID, publish.BlockedBy)
+            }
+            if target.Count() != 8 {
+                t.Errorf("expected imported series not to spawn occurrences, got %d tasks", target.Count())
+            }
+
+            //у серии одно живое вхождение, как и до экспорта
+            live := 0
+            page, _ := target.GetAllFiltered(1, models.TaskQuery{Filter: models.TaskFilter{TitleContains: "report"}, Limit: storage.MaxPageLimit})
+            for _, task := range page.Items {
+                if task.Recurrence != nil && task.Recurrence.NextAt != nil {
+                    live++
+                    if !task.Recurrence.NextAt.Equal(*before["report"].Recurrence.NextAt) {
+                        t.Errorf("expected next_at to be kept, got %+v", task.Recurrence)
+                    }
+                }
+            }
+            if len(page.Items) != 2 || live != 1 {
+                t.Errorf("expected one live occurrence of the series, got %d", live)
+            }
+        })
+    }
+
+    t.Run("Dry run only validates", func(t *testing.T) {
+        store := storage.NewTaskStore()
+        body := "{\"id\":1,\"title\":\"a\"}\n{\"id\":2,\"title\":\"b\",\"parent_id\":1}\n{\"title\":\"\"}\n"
+
+        report := importFile(t, NewTaskHandler(store, nil, 0), 1, "?dry_run=true", body)
+        if !report.DryRun || report.Total != 3 || report.Created != 2 || report.Failed != 1 || report.IDs != nil {
+            t.Errorf("unexpected dry run report %+v", report)
+        }
+        if store.Count() != 0 {
+            t.Errorf("expected dry run not to create tasks, got %d", store.Count())
+        }
+    })
+
+    t.Run("Malformed lines are reported and skipped", func(t *testing.T) {
+        store := storage.NewTaskStore()
+        body := strings.Join([]string{
+            `{"id":1,"title":"ok"}`,
+            `{"id":2,"title":`,
+            `{"id":3,"description":"no title"}`,
+            `{"id":4,"title":"bad priority","priority":"critical"}`,
+            `{"id":5,"title":"child of broken","parent_id":3}`,
+            ``,
+            `{"id":6,"title":"blocked by ok","blocked_by":[1]}`,
+            `{"id":1,"title":"duplicate"}`,
+        }, "\n")
+
+        report := importFile(t, NewTaskHandler(store, nil, 0), 1, "", body)
+        if report.Total != 7 || report.Created != 2 || report.Failed != 5 {
+            t.Fatalf("unexpected report %+v", report)
+        }
+        failed := map[int]string{}
+        for _, lineErr := range report.Errors {
+            failed[lineErr.Line] = lineErr.Errors[0].Field
+        }
+        for line, field := range map[int]string{2: "", 3: "title", 4: "priority", 5: "parent_id", 8: "id"} {
+            if got, ok := failed[line]; !ok || field != "" && got != field {
+                t.Errorf("expected error on line %d for %q, got %v", line, field, report.Errors)
+            }
+        }
+
+        tasks := ownerTasks(t, store, 1)
+        if blocked := tasks["blocked by ok"]; len(blocked.BlockedBy) != 1 || blocked.BlockedBy[0] != tasks["ok"].ID {
+            t.Errorf("expected valid rows to be created with links, got %+v", tasks)
+        }
+    })
+
+    t.Run("CSV columns in any order with references to existing tasks", func(t *testing.T) {
+        store := storage.NewTaskStore()
+        existing := mustCreate(t, store, models.Task{Title: "existing", UserID: 1})
+
+        var body bytes.Buffer
+        body.WriteString("\xef\xbb\xbftags,title,id,blocked_by,parent_id,done\n")
+        body.WriteString("a;b,parent,10,,,false\n")
+        body.WriteString(",child,11,1,10,true\n")
+
+        report := importFile(t, NewTaskHandler(store, nil, 0), 1, "?format=csv", body.String())
+        if report.Created != 2 || report.Failed != 0 {
+            t.Fatalf("unexpected report %+v", report)
+        }
+        tasks := ownerTasks(t, store, 1)
+        child := tasks["child"]
+        if !child.Done || child.ParentID == nil || *child.ParentID != report.IDs[10] || len(child.BlockedBy) != 1 || child.BlockedBy[0] != existing.ID {
+            t.Errorf("unexpected child %+v", child)
+        }
+        if tags := tasks["parent"].Tags; len(tags) != 2 {
+            t.Errorf("expected tags to be split, got %v", tags)
+        }
+    })
+
+    t.Run("Export larger than the body limit imports back", func(t *testing.T) {
+        const bodyLimit = 1 << 20
+        source := storage.NewTaskStore()
+        for i := 0; i < 1500; i++ {
+            mustCreate(t, source, models.Task{Title: fmt.Sprintf("task %d", i), Description: strings.Repeat("x", 900), UserID: 1})
+        }
+        w := httptest.NewRecorder()
+        NewTaskHandler(source, nil, 0).ExportTasks(w, asOwner(1, http.MethodGet, "/tasks/export", ""))
+        if w.Body.Len() <= bodyLimit {
+            t.Fatalf("expected export above %d bytes, got %d", bodyLimit, w.Body.Len())
+        }
+
+        //предел тела, как в main: общий и отдельный для импорта
+        target := storage.NewTaskStore()
+        h := NewTaskHandler(target, nil, 0)
+        mux := http.NewServeMux()
+        mux.HandleFunc("POST /tasks", h.CreateTask)
+        mux.HandleFunc("POST /tasks/import", h.ImportTasks)
+        stack := middleware.RouteRecorder(mux)(
+            middleware.MaxBodyMiddleware(bodyLimit, map[string]int64{"POST /tasks/import": MaxImportBytes})(mux),
+        )
+
+        imported := httptest.NewRecorder()
+        stack.ServeHTTP(imported, asOwner(1, http.MethodPost, "/tasks/import", w.Body.String()))
+        if imported.Code != http.StatusOK || target.Count() != 1500 {
+            t.Errorf("expected 1500 tasks imported, got %d with status %d", target.Count(), imported.Code)
+        }
+
+        large := httptest.NewRecorder()
+        stack.ServeHTTP(large, asOwner(1, http.MethodPost, "/tasks", `{"title":"`+strings.Repeat("x", bodyLimit)+`"}`))
+        if large.Code != http.StatusRequestEntityTooLarge {
+            t.Errorf("expected other routes to keep the body limit, got %d", large.Code)
+        }
+    })
+
+    t.Run("Export stops when the write deadline cannot be set", func(t *testing.T) {
+        store := storage.NewTaskStore()
+        mustCreate(t, store, models.Task{Title: "a", UserID: 1})
+
+        //ResponseRecorder не умеет дедлайны, с нулевым таймаутом они не нужны
+        w := httptest.NewRecorder()
+        NewTaskHandler(store, nil, time.Minute).ExportTasks(w, asOwner(1, http.MethodGet, "/tasks/export", ""))
+        if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), `"title":"a"`) {
+            t.Errorf("expected 500 without tasks, got %d: %s", w.Code, w.Body)
+        }
+    })
+
+    t.Run("Invalid parameters and empty files are rejected", func(t *testing.T) {
+        h := NewTaskHandler(storage.NewTaskStore(), nil, 0)
+        for _, tt := range []struct {
+            method, target, body string
+        }{
+            {http.MethodGet, "/tasks/export?format=xml", ""},
+            {http.MethodPost, "/tasks/import?dry_run=maybe", "{\"title\":\"a\"}"},
+            {http.MethodPost, "/tasks/import", ""},
+        } {
+            w := httptest.NewRecorder()
+            r := asOwner(1, tt.method, tt.target, tt.body)
+            if tt.method == http.MethodGet {
+                h.ExportTasks(w, r)
+            } else {
+                h.ImportTasks(w, r)
+            }
+            if w.Code != http.StatusBadRequest {
+                t.Errorf("%s %s: expected 400, got %d", tt.method, tt.target, w.Code)
+            }
+        }
+    })
+}
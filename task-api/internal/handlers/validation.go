@@ -0,0 +1,243 @@
+package handlers
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+    "task-api/internal/models"
+    "task-api/internal/recurrence"
+    "time"
+)
+
+const (
+    maxTitleLength       = 100
+    maxDescriptionLength = 1000
+    maxTags              = 20
+    maxTagLength         = 30
+    maxBlockers          = 50
+)
+
+var readOnlyTaskFields = map[string]bool{
+    "id":           true,
+    "userId":       true,
+    "external_ref": true,
+    "version":      true,
+    "created_at":   true,
+    "updated_at":   true,
+}
+
+//decodeTaskPatch разбирает JSON-объект с полями задачи в TaskPatch.
+//Ошибки копятся по полям, чтобы клиент получил их все разом.
+func decodeTaskPatch(raw map[string]json.RawMessage) (models.TaskPatch, []models.ValidationError) {
+    var patch models.TaskPatch
+    validationErrors := []models.ValidationError{}
+
+    addError := func(field, message string) {
+        validationErrors = append(validationErrors, models.ValidationError{Field: field, Message: message})
+    }
+
+    //сортируем ключи, чтобы порядок ошибок был стабильным
+    fields := make([]string, 0, len(raw))
+    for field := range raw {
+        fields = append(fields, field)
+    }
+    sort.Strings(fields)
+
+    for _, field := range fields {
+        value := raw[field]
+        switch field {
+        case "title":
+            var title string
+            if err := json.Unmarshal(value, &title); err != nil {
+                addError(field, "title must be a string")
+                continue
+            }
+            title = strings.TrimSpace(title)
+            if title == "" {
+                addError(field, "title cannot be empty")
+                continue
+            }
+            if len(title) > maxTitleLength {
+                addError(field, fmt.Sprintf("title too long, maximum %d characters", maxTitleLength))
+                continue
+            }
+            patch.Title = &title
+
+        case "description":
+            var description string
+            if err := json.Unmarshal(value, &description); err != nil {
+                addError(field, "description must be a string")
+                continue
+            }
+            description = strings.TrimSpace(description)
+            if len(description) > maxDescriptionLength {
+                addError(field, fmt.Sprintf("description too long, maximum %d characters", maxDescriptionLength))
+                continue
+            }
+            patch.Description = &description
+
+        case "done":
+            var done bool
+            if err := json.Unmarshal(value, &done); err != nil {
+                addError(field, "done must be a boolean")
+                continue
+            }
+            patch.Done = &done
+
+        case "due_at":
+            if string(value) == "null" {
+                patch.ClearDueAt = true
+                continue
+            }
+            var dueAtStr string
+            if err := json.Unmarshal(value, &dueAtStr); err != nil {
+                addError(field, "due_at must be an RFC 3339 timestamp or null")
+                continue
+            }
+            dueAt, err := time.Parse(time.RFC3339, dueAtStr)
+            if err != nil {
+                addError(field, "due_at must be an RFC 3339 timestamp or null")
+                continue
+            }
+            dueAt = dueAt.UTC()
+            patch.DueAt = &dueAt
+
+        case "priority":
+            var priority models.Priority
+            if err := json.Unmarshal(value, &priority); err != nil || !priority.Valid() {
+                addError(field, "priority must be one of: low, normal, high, urgent")
+                continue
+            }
+            patch.Priority = &priority
+
+        case "tags":
+            var tags []string
+            if err := json.Unmarshal(value, &tags); err != nil {
+                addError(field, "tags must be an array of strings")
+                continue
+            }
+            normalized, message := normalizeTags(tags)
+            if message != "" {
+                addError(field, message)
+                continue
+            }
+            patch.Tags = &normalized
+
+        case "parent_id":
+            if string(value) == "null" {
+                patch.ClearParent = true
+                continue
+            }
+            var parentID int
+            if err := json.Unmarshal(value, &parentID); err != nil || parentID <= 0 {
+                addError(field, "parent_id must be a positive task id or null")
+                continue
+            }
+            patch.ParentID = &parentID
+
+        case "blocked_by":
+            var blockedBy []int
+            if err := json.Unmarshal(value, &blockedBy); err != nil {
+                addError(field, "blocked_by must be an array of task ids")
+                continue
+            }
+            normalized, message := normalizeBlockers(blockedBy)
+            if message != "" {
+                addError(field, message)
+                continue
+            }
+            patch.BlockedBy = &normalized
+
+        case "recurrence":
+            if string(value) == "null" {
+                patch.ClearRecurrence = true
+                continue
+            }
+            rec, message := decodeRecurrence(value)
+            if message != "" {
+                addError(field, message)
+                continue
+            }
+            patch.Recurrence = rec
+
+        default:
+            if readOnlyTaskFields[field] {
+                addError(field, fmt.Sprintf("%s is read-only", field))
+            } else {
+                addError(field, fmt.Sprintf("unknown field %q", field))
+            }
+        }
+    }
+
+    return patch, validationErrors
+}
+
+//normalizeTags приводит теги к нижнему регистру и убирает дубли
+func normalizeTags(tags []string) ([]string, string) {
+    if len(tags) > maxTags {
+        return nil, fmt.Sprintf("too many tags, maximum %d", maxTags)
+    }
+
+    seen := make(map[string]bool, len(tags))
+    normalized := make([]string, 0, len(tags))
+    for _, tag := range tags {
+        tag = strings.ToLower(strings.TrimSpace(tag))
+        if tag == "" {
+            return nil, "tags cannot contain empty values"
+        }
+        if len(tag) > maxTagLength {
+            return nil, fmt.Sprintf("tag %q too long, maximum %d characters", tag, maxTagLength)
+        }
+        if seen[tag] {
+            continue
+        }
+        seen[tag] = true
+        normalized = append(normalized, tag)
+    }
+    return normalized, ""
+}
+
+//normalizeBlockers сортирует ID блокеров и убирает дубли
+func normalizeBlockers(ids []int) ([]int, string) {
+    if len(ids) > maxBlockers {
+        return nil, fmt.Sprintf("too many blockers, maximum %d", maxBlockers)
+    }
+
+    seen := make(map[int]bool, len(ids))
+    normalized := make([]int, 0, len(ids))
+    for _, id := range ids {
+        if id <= 0 {
+            return nil, "blocked_by must contain positive task ids"
+        }
+        if seen[id] {
+            continue
+        }
+        seen[id] = true
+        normalized = append(normalized, id)
+    }
+    sort.Ints(normalized)
+    return normalized, ""
+}
+
+//decodeRecurrence принимает {"rule": ..., "timezone": ...} и сразу проверяет
+//правило, чтобы ошибка в нем пришла клиенту как ошибка валидации
+func decodeRecurrence(value json.RawMessage) (*models.Recurrence, string) {
+    var req struct {
+        Rule     string `json:"rule"`
+        Timezone string `json:"timezone"`
+    }
+    dec := json.NewDecoder(bytes.NewReader(value))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&req); err != nil {
+        return nil, "recurrence must be an object with 'rule' and optional 'timezone', or null"
+    }
+
+    req.Rule = strings.TrimSpace(req.Rule)
+    req.Timezone = strings.TrimSpace(req.Timezone)
+    if _, err := recurrence.Parse(req.Rule, req.Timezone); err != nil {
+        return nil, "invalid recurrence: " + err.Error()
+    }
+    return &models.Recurrence{Rule: req.Rule, Timezone: req.Timezone}, ""
+}
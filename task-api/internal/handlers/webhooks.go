@@ -0,0 +1,193 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "task-api/internal/models"
+    "task-api/internal/webhooks"
+)
+
+type WebhookHandler struct {
+    dispatcher *webhooks.Dispatcher
+}
+
+func NewWebhookHandler(dispatcher *webhooks.Dispatcher) *WebhookHandler {
+    return &WebhookHandler{dispatcher: dispatcher}
+}
+
+//createdWebhookResponse - единственный ответ, в котором виден секрет подписи
+type createdWebhookResponse struct {
+    Webhook webhooks.Subscription `json:"webhook"`
+    Secret  string                `json:"secret"`
+    Notice  string                `json:"notice"`
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    json.NewEncoder(w).Encode(h.dispatcher.List(principal.UserID))
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    var req struct {
+        URL    string   `json:"url"`
+        Events []string `json:"events"`
+        Secret string   `json:"secret"`
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        sendDecodeError(w, r, err, "expected JSON with url, events and optional secret")
+        return
+    }
+
+    req.URL = strings.TrimSpace(req.URL)
+    validationErrors := []models.ValidationError{}
+
+    if err := webhooks.ValidateURL(req.URL); err != nil {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "url",
+            Message: err.Error(),
+        })
+    }
+
+    if len(req.Events) == 0 {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "events",
+            Message: "at least one event type is required",
+        })
+    }
+    for _, event := range req.Events {
+        if !webhooks.ValidEvent(event) {
+            validationErrors = append(validationErrors, models.ValidationError{
+                Field:   "events",
+                Message: fmt.Sprintf("unknown event type %q", event),
+            })
+        }
+    }
+
+    if req.Secret != "" && len(req.Secret) < webhooks.MinSecretLength {
+        validationErrors = append(validationErrors, models.ValidationError{
+            Field:   "secret",
+            Message: fmt.Sprintf("secret must be at least %d characters, omit it to generate one", webhooks.MinSecretLength),
+        })
+    }
+
+    if len(validationErrors) > 0 {
+        w.WriteHeader(http.StatusBadRequest)
+        sendError(w, r, "validation failed",
+            fmt.Sprintf("found %d validation error(s)", len(validationErrors)),
+            validationErrors)
+        return
+    }
+
+    sub, secret, err := h.dispatcher.Create(principal.UserID, req.URL, req.Events, req.Secret)
+    if errors.Is(err, webhooks.ErrTooManySubscriptions) {
+        w.WriteHeader(http.StatusConflict)
+        sendError(w, r, "too many webhooks", err.Error(), nil)
+        return
+    }
+    if err != nil {
+        w.WriteHeader(http.StatusInternalServerError)
+        sendError(w, r, "failed to create webhook", err.Error(), nil)
+        return
+    }
+
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(createdWebhookResponse{
+        Webhook: sub,
+        Secret:  secret,
+        Notice:  "store this secret now, it will not be shown again",
+    })
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    sub, err := h.dispatcher.Get(principal.UserID, r.PathValue("id"))
+    if err != nil {
+        h.writeWebhookError(w, r, err)
+        return
+    }
+    json.NewEncoder(w).Encode(sub)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    if err := h.dispatcher.Delete(principal.UserID, r.PathValue("id")); err != nil {
+        h.writeWebhookError(w, r, err)
+        return
+    }
+    json.NewEncoder(w).Encode(models.SuccessResponse{
+        Message: "webhook deleted",
+        Deleted: true,
+    })
+}
+
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    deliveries, err := h.dispatcher.Deliveries(principal.UserID, r.PathValue("id"))
+    if err != nil {
+        h.writeWebhookError(w, r, err)
+        return
+    }
+    json.NewEncoder(w).Encode(deliveries)
+}
+
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+
+    principal, ok := principalFromRequest(w, r)
+    if !ok {
+        return
+    }
+
+    deadLetters, err := h.dispatcher.DeadLetters(principal.UserID, r.PathValue("id"))
+    if err != nil {
+        h.writeWebhookError(w, r, err)
+        return
+    }
+    json.NewEncoder(w).Encode(deadLetters)
+}
+
+func (h *WebhookHandler) writeWebhookError(w http.ResponseWriter, r *http.Request, err error) {
+    switch {
+    case errors.Is(err, webhooks.ErrSubscriptionNotFound):
+        w.WriteHeader(http.StatusNotFound)
+        sendError(w, r, "webhook not found", fmt.Sprintf("webhook %q does not exist", r.PathValue("id")), nil)
+    default:
+        w.WriteHeader(http.StatusInternalServerError)
+        sendError(w, r, "webhook operation failed", err.Error(), nil)
+    }
+}
@@ -0,0 +1,181 @@
+package health
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const DefaultTimeout = 2 * time.Second
+
+const (
+    StatusOK           = "ok"
+    StatusFail         = "fail"
+    StatusDegraded     = "degraded"
+    StatusShuttingDown = "shutting_down"
+)
+
+//CheckFunc проверяет одну зависимость, ошибка означает недоступность
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+    name     string
+    critical bool
+    fn       CheckFunc
+}
+
+//CheckResult - итог одной проверки в ответе /readyz
+type CheckResult struct {
+    Name      string  `json:"name"`
+    Status    string  `json:"status"`
+    Critical  bool    `json:"critical"`
+    LatencyMS float64 `json:"latency_ms"`
+    Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+    Status string        `json:"status"`
+    Checks []CheckResult `json:"checks"`
+}
+
+//Registry хранит проверки готовности. Упавшая критичная проверка делает
+//сервис неготовым, некритичная только переводит отчет в degraded.
+type Registry struct {
+    mu           sync.Mutex
+    checks       []check
+    timeout      time.Duration
+    shuttingDown atomic.Bool
+    now          func() time.Time
+}
+
+func NewRegistry(timeout time.Duration) *Registry {
+    if timeout <= 0 {
+        timeout = DefaultTimeout
+    }
+    return &Registry{timeout: timeout, now: time.Now}
+}
+
+//Register добавляет проверку. Некритичные подходят для внешних зависимостей,
+//без которых сервис работает частично.
+func (r *Registry) Register(name string, critical bool, fn CheckFunc) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.checks = append(r.checks, check{name: name, critical: critical, fn: fn})
+}
+
+//StartShutdown переводит /readyz в состояние отказа, чтобы балансировщик
+//перестал слать запросы, пока сервер дорабатывает текущие
+func (r *Registry) StartShutdown() {
+    r.shuttingDown.Store(true)
+}
+
+func (r *Registry) ShuttingDown() bool {
+    return r.shuttingDown.Load()
+}
+
+//Check параллельно выполняет все проверки, каждую со своим таймаутом
+func (r *Registry) Check(ctx context.Context) Report {
+    r.mu.Lock()
+    checks := append([]check(nil), r.checks...)
+    r.mu.Unlock()
+
+    results := make([]CheckResult, len(checks))
+    var wg sync.WaitGroup
+    for i, c := range checks {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            results[i] = r.run(ctx, c)
+        }()
+    }
+    wg.Wait()
+
+    report := Report{Status: StatusOK, Checks: results}
+    for _, res := range results {
+        if res.Status == StatusOK {
+            continue
+        }
+        if res.Critical {
+            report.Status = StatusFail
+        } else if report.Status == StatusOK {
+            report.Status = StatusDegraded
+        }
+    }
+    if r.ShuttingDown() {
+        report.Status = StatusShuttingDown
+    }
+    return report
+}
+
+func (r *Registry) run(ctx context.Context, c check) CheckResult {
+    ctx, cancel := context.WithTimeout(ctx, r.timeout)
+    defer cancel()
+
+    start := r.now()
+    errCh := make(chan error, 1)
+    go func() {
+        errCh <- c.fn(ctx)
+    }()
+
+    //проверка, которая игнорирует контекст, не должна подвешивать пробу
+    var err error
+    select {
+    case err = <-errCh:
+    case <-ctx.Done():
+        err = ctx.Err()
+    }
+
+    res := CheckResult{
+        Name:      c.name,
+        Status:    StatusOK,
+        Critical:  c.critical,
+        LatencyMS: float64(r.now().Sub(start).Microseconds()) / 1000,
+    }
+    if err != nil {
+        res.Status = StatusFail
+        res.Error = err.Error()
+        if errors.Is(err, context.DeadlineExceeded) {
+            res.Error = "timed out after " + r.timeout.String()
+        }
+    }
+    return res
+}
+
+//LivenessHandler отвечает, пока процесс жив, и не трогает зависимости:
+//иначе падение апстрима приводило бы к перезапуску здоровых подов
+func (r *Registry) LivenessHandler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+    })
+}
+
+//ReadinessHandler отдает 503, если упала критичная проверка или идет остановка
+func (r *Registry) ReadinessHandler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        if r.ShuttingDown() {
+            writeJSON(w, http.StatusServiceUnavailable, Report{
+                Status: StatusShuttingDown,
+                Checks: []CheckResult{},
+            })
+            return
+        }
+
+        report := r.Check(req.Context())
+        code := http.StatusOK
+        if report.Status == StatusFail || report.Status == StatusShuttingDown {
+            code = http.StatusServiceUnavailable
+        }
+        writeJSON(w, code, report)
+    })
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(body)
+}
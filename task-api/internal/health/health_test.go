@@ -0,0 +1,102 @@
+package health
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func readyz(t *testing.T, reg *Registry) (int, Report) {
+    t.Helper()
+
+    rec := httptest.NewRecorder()
+    reg.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+    var report Report
+    if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+        t.Fatalf("failed to decode report: %v", err)
+    }
+    return rec.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+    ok := func(ctx context.Context) error { return nil }
+    failing := func(ctx context.Context) error { return errors.New("boom") }
+
+    t.Run("Ready when all checks pass", func(t *testing.T) {
+        reg := NewRegistry(time.Second)
+        reg.Register("store", true, ok)
+        reg.Register("external_api", false, ok)
+
+        code, report := readyz(t, reg)
+        if code != http.StatusOK || report.Status != StatusOK {
+            t.Errorf("expected 200 ok, got %d %s", code, report.Status)
+        }
+        if len(report.Checks) != 2 || report.Checks[0].Name != "store" {
+            t.Errorf("expected both checks in registration order, got %+v", report.Checks)
+        }
+    })
+
+    t.Run("Critical failure makes service unready", func(t *testing.T) {
+        reg := NewRegistry(time.Second)
+        reg.Register("store", true, failing)
+
+        code, report := readyz(t, reg)
+        if code != http.StatusServiceUnavailable || report.Status != StatusFail {
+            t.Errorf("expected 503 fail, got %d %s", code, report.Status)
+        }
+        if report.Checks[0].Error != "boom" {
+            t.Errorf("expected check error in report, got %+v", report.Checks[0])
+        }
+    })
+
+    t.Run("Optional failure only degrades", func(t *testing.T) {
+        reg := NewRegistry(time.Second)
+        reg.Register("store", true, ok)
+        reg.Register("external_api", false, failing)
+
+        code, report := readyz(t, reg)
+        if code != http.StatusOK || report.Status != StatusDegraded {
+            t.Errorf("expected 200 degraded, got %d %s", code, report.Status)
+        }
+    })
+
+    t.Run("Slow check times out", func(t *testing.T) {
+        reg := NewRegistry(20 * time.Millisecond)
+        reg.Register("external_api", true, func(ctx context.Context) error {
+            //проверка намеренно игнорирует контекст
+            time.Sleep(time.Second)
+            return nil
+        })
+
+        start := time.Now()
+        code, report := readyz(t, reg)
+        if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+            t.Errorf("expected probe to return after timeout, took %v", elapsed)
+        }
+        if code != http.StatusServiceUnavailable || report.Checks[0].Status != StatusFail {
+            t.Errorf("expected timed out check to fail, got %d %+v", code, report.Checks[0])
+        }
+    })
+
+    t.Run("Fails during shutdown", func(t *testing.T) {
+        reg := NewRegistry(time.Second)
+        reg.Register("store", true, ok)
+        reg.StartShutdown()
+
+        code, report := readyz(t, reg)
+        if code != http.StatusServiceUnavailable || report.Status != StatusShuttingDown {
+            t.Errorf("expected 503 shutting_down, got %d %s", code, report.Status)
+        }
+
+        rec := httptest.NewRecorder()
+        reg.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+        if rec.Code != http.StatusOK {
+            t.Errorf("expected liveness to stay ok during shutdown, got %d", rec.Code)
+        }
+    })
+}
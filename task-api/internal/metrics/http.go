@@ -0,0 +1,44 @@
+package metrics
+
+import "time"
+
+//HTTPMetrics - метрики входящих запросов
+type HTTPMetrics struct {
+    Requests *CounterVec
+    Duration *HistogramVec
+    InFlight *GaugeVec
+}
+
+func NewHTTPMetrics(reg *Registry) *HTTPMetrics {
+    return &HTTPMetrics{
+        Requests: reg.NewCounterVec("http_requests_total",
+            "Total number of HTTP requests by route and status code.", "method", "route", "status"),
+        Duration: reg.NewHistogramVec("http_request_duration_seconds",
+            "HTTP request latency in seconds.", DefaultBuckets, "method", "route"),
+        InFlight: reg.NewGaugeVec("http_requests_in_flight",
+            "Number of HTTP requests currently being served."),
+    }
+}
+
+//ExternalMetrics - исходы обращений к внешнему API, по одному на попытку
+type ExternalMetrics struct {
+    Calls    *CounterVec
+    Duration *HistogramVec
+}
+
+func NewExternalMetrics(reg *Registry) *ExternalMetrics {
+    return &ExternalMetrics{
+        Calls: reg.NewCounterVec("external_api_requests_total",
+            "Outbound external API attempts by operation and outcome.", "operation", "outcome"),
+        Duration: reg.NewHistogramVec("external_api_request_duration_seconds",
+            "Outbound external API attempt latency in seconds.", DefaultBuckets, "operation"),
+    }
+}
+
+func (m *ExternalMetrics) Observe(operation, outcome string, duration time.Duration) {
+    m.Calls.WithLabelValues(operation, outcome).Inc()
+    //short-circuit брейкера не ходит в сеть, его задержку не пишем
+    if outcome != "circuit_open" {
+        m.Duration.WithLabelValues(operation).Observe(duration.Seconds())
+    }
+}
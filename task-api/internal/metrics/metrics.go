@@ -0,0 +1,333 @@
+package metrics
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+//DefaultBuckets - границы гистограммы задержек в секундах, как у клиента Prometheus
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type collector interface {
+    name() string
+    write(w *bufio.Writer)
+}
+
+//Registry собирает метрики и отдает их в текстовом формате Prometheus
+type Registry struct {
+    mu         sync.Mutex
+    collectors []collector
+}
+
+func NewRegistry() *Registry {
+    return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for _, existing := range r.collectors {
+        if existing.name() == c.name() {
+            panic(fmt.Sprintf("metrics: duplicate metric %q", c.name()))
+        }
+    }
+    r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) Write(out io.Writer) error {
+    r.mu.Lock()
+    collectors := append([]collector(nil), r.collectors...)
+    r.mu.Unlock()
+
+    sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+    w := bufio.NewWriter(out)
+    for _, c := range collectors {
+        c.write(w)
+    }
+    return w.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        r.Write(w)
+    })
+}
+
+//vec - общая часть метрик с метками: серии хранятся по склеенным значениям меток
+type vec[S any] struct {
+    mu        sync.Mutex
+    metric    string
+    help      string
+    typ       string
+    labels    []string
+    series    map[string]*S
+    values    map[string][]string
+    newSeries func() *S
+}
+
+func newVec[S any](name, help, typ string, labels []string, newSeries func() *S) *vec[S] {
+    return &vec[S]{
+        metric:    name,
+        help:      help,
+        typ:       typ,
+        labels:    labels,
+        series:    make(map[string]*S),
+        values:    make(map[string][]string),
+        newSeries: newSeries,
+    }
+}
+
+func (v *vec[S]) name() string { return v.metric }
+
+func (v *vec[S]) with(values []string) *S {
+    if len(values) != len(v.labels) {
+        panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.metric, len(v.labels), len(values)))
+    }
+    key := strings.Join(values, "\xff")
+
+    v.mu.Lock()
+    defer v.mu.Unlock()
+
+    s, ok := v.series[key]
+    if !ok {
+        s = v.newSeries()
+        v.series[key] = s
+        v.values[key] = append([]string(nil), values...)
+    }
+    return s
+}
+
+//each обходит серии в стабильном порядке
+func (v *vec[S]) each(fn func(labels string, s *S)) {
+    v.mu.Lock()
+    defer v.mu.Unlock()
+
+    keys := make([]string, 0, len(v.series))
+    for key := range v.series {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        fn(formatLabels(v.labels, v.values[key]), v.series[key])
+    }
+}
+
+func (v *vec[S]) writeHeader(w *bufio.Writer) {
+    fmt.Fprintf(w, "# HELP %s %s\n", v.metric, escapeHelp(v.help))
+    fmt.Fprintf(w, "# TYPE %s %s\n", v.metric, v.typ)
+}
+
+type Counter struct {
+    mu    sync.Mutex
+    value float64
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) Add(delta float64) {
+    if delta < 0 {
+        panic("metrics: counter cannot decrease")
+    }
+    c.mu.Lock()
+    c.value += delta
+    c.mu.Unlock()
+}
+
+func (c *Counter) get() float64 {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.value
+}
+
+type CounterVec struct {
+    *vec[Counter]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+    c := &CounterVec{newVec(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+    r.register(c)
+    return c
+}
+
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+    return c.with(values)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+    c.writeHeader(w)
+    c.each(func(labels string, s *Counter) {
+        fmt.Fprintf(w, "%s%s %s\n", c.metric, labels, formatFloat(s.get()))
+    })
+}
+
+type Gauge struct {
+    mu    sync.Mutex
+    value float64
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) Add(delta float64) {
+    g.mu.Lock()
+    g.value += delta
+    g.mu.Unlock()
+}
+
+func (g *Gauge) Set(value float64) {
+    g.mu.Lock()
+    g.value = value
+    g.mu.Unlock()
+}
+
+func (g *Gauge) get() float64 {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    return g.value
+}
+
+type GaugeVec struct {
+    *vec[Gauge]
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+    g := &GaugeVec{newVec(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+    r.register(g)
+    return g
+}
+
+func (g *GaugeVec) WithLabelValues(values ...string) *Gauge {
+    return g.with(values)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+    g.writeHeader(w)
+    g.each(func(labels string, s *Gauge) {
+        fmt.Fprintf(w, "%s%s %s\n", g.metric, labels, formatFloat(s.get()))
+    })
+}
+
+//gaugeFunc считывает значение в момент скрейпа, например размер хранилища
+type gaugeFunc struct {
+    metric string
+    help   string
+    fn     func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+    r.register(&gaugeFunc{metric: name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) name() string { return g.metric }
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+    fmt.Fprintf(w, "# HELP %s %s\n", g.metric, escapeHelp(g.help))
+    fmt.Fprintf(w, "# TYPE %s gauge\n", g.metric)
+    fmt.Fprintf(w, "%s %s\n", g.metric, formatFloat(g.fn()))
+}
+
+type Histogram struct {
+    mu      sync.Mutex
+    buckets []float64
+    counts  []uint64
+    sum     float64
+    count   uint64
+}
+
+func (h *Histogram) Observe(value float64) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    for i, bound := range h.buckets {
+        if value <= bound {
+            h.counts[i]++
+        }
+    }
+    h.sum += value
+    h.count++
+}
+
+type HistogramVec struct {
+    *vec[Histogram]
+    buckets []float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+    buckets = append([]float64(nil), buckets...)
+    sort.Float64s(buckets)
+
+    h := &HistogramVec{buckets: buckets}
+    h.vec = newVec(name, help, "histogram", labels, func() *Histogram {
+        return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+    })
+    r.register(h)
+    return h
+}
+
+func (h *HistogramVec) WithLabelValues(values ...string) *Histogram {
+    return h.with(values)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+    h.writeHeader(w)
+    h.each(func(labels string, s *Histogram) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        for i, bound := range s.buckets {
+            fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, withLabel(labels, "le", formatFloat(bound)), s.counts[i])
+        }
+        fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, withLabel(labels, "le", "+Inf"), s.count)
+        fmt.Fprintf(w, "%s_sum%s %s\n", h.metric, labels, formatFloat(s.sum))
+        fmt.Fprintf(w, "%s_count%s %d\n", h.metric, labels, s.count)
+    })
+}
+
+func formatLabels(names, values []string) string {
+    if len(names) == 0 {
+        return ""
+    }
+    parts := make([]string, len(names))
+    for i, name := range names {
+        parts[i] = fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i]))
+    }
+    return "{" + strings.Join(parts, ",") + "}"
+}
+
+//withLabel дописывает метку le к уже отформатированным меткам серии
+func withLabel(labels, name, value string) string {
+    extra := fmt.Sprintf(`%s="%s"`, name, value)
+    if labels == "" {
+        return "{" + extra + "}"
+    }
+    return labels[:len(labels)-1] + "," + extra + "}"
+}
+
+func formatFloat(v float64) string {
+    switch {
+    case math.IsInf(v, 1):
+        return "+Inf"
+    case math.IsInf(v, -1):
+        return "-Inf"
+    case math.IsNaN(v):
+        return "NaN"
+    }
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestRegistryExposition(t *testing.T) {
+    reg := NewRegistry()
+
+    requests := reg.NewCounterVec("requests_total", "Total requests.", "route", "status")
+    requests.WithLabelValues("GET /tasks/{id}", "200").Inc()
+    requests.WithLabelValues("GET /tasks/{id}", "200").Inc()
+    requests.WithLabelValues(`weird "route"`, "500").Add(3)
+
+    latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+    latency.WithLabelValues("r").Observe(0.05)
+    latency.WithLabelValues("r").Observe(0.5)
+    latency.WithLabelValues("r").Observe(5)
+
+    reg.NewGaugeFunc("store_size", "Store size.", func() float64 { return 42 })
+
+    var out strings.Builder
+    if err := reg.Write(&out); err != nil {
+        t.Fatalf("expected no error, got %v", err)
+    }
+    text := out.String()
+
+    expected := []string{
+        "# TYPE requests_total counter",
+        `requests_total{route="GET /tasks/{id}",status="200"} 2`,
+        `requests_total{route="weird \"route\"",status="500"} 3`,
+        "# TYPE latency_seconds histogram",
+        `latency_seconds_bucket{route="r",le="0.1"} 1`,
+        `latency_seconds_bucket{route="r",le="1"} 2`,
+        `latency_seconds_bucket{route="r",le="+Inf"} 3`,
+        `latency_seconds_sum{route="r"} 5.55`,
+        `latency_seconds_count{route="r"} 3`,
+        "# TYPE store_size gauge",
+        "store_size 42",
+    }
+    for _, line := range expected {
+        if !strings.Contains(text, line+"\n") {
+            t.Errorf("expected exposition to contain %q, got:\n%s", line, text)
+        }
+    }
+}
+
+func TestDuplicateMetricPanics(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Error("expected panic on duplicate registration")
+        }
+    }()
+
+    reg := NewRegistry()
+    reg.NewCounterVec("dup_total", "First.")
+    reg.NewCounterVec("dup_total", "Second.")
+}
@@ -1,25 +1,117 @@
 package middleware
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "net/http"
+    "task-api/internal/auth"
     "task-api/internal/models"
+    "task-api/internal/tracing"
 )
 
-const ValidAPIKey = "secret12345"
+type contextKey string
 
-func APIKeyMiddleware(next http.Handler) http.Handler {
+const PrincipalKey contextKey = "principal"
+
+//PrincipalFromContext возвращает владельца ключа, положенного APIKeyMiddleware
+func PrincipalFromContext(ctx context.Context) (models.Principal, bool) {
+    principal, ok := ctx.Value(PrincipalKey).(models.Principal)
+    return principal, ok
+}
+
+//authResult - итог проверки X-API-KEY. RateLimitMiddleware кладет его в
+//контекст, и APIKeyMiddleware не ищет ключ второй раз.
+type authResult struct {
+    key auth.APIKey
+    err error
+}
+
+const authResultKey contextKey = "auth_result"
+
+//authenticate ищет ключ запроса один раз за запрос: повторный вызов берет
+//итог из контекста. LastUsedAt отмечает APIKeyMiddleware, когда запрос пропущен.
+func authenticate(keys *auth.KeyStore, r *http.Request) (*http.Request, auth.APIKey, error) {
+    if result, ok := r.Context().Value(authResultKey).(authResult); ok {
+        return r, result.key, result.err
+    }
+    key, err := keys.Lookup(r.Header.Get("X-API-KEY"))
+    ctx := context.WithValue(r.Context(), authResultKey, authResult{key: key, err: err})
+    return r.WithContext(ctx), key, err
+}
+
+//APIKeyMiddleware проверяет X-API-KEY. Пути из publicPaths (метрики, пробы)
+//пропускаются без ключа.
+func APIKeyMiddleware(keys *auth.KeyStore, publicPaths ...string) func(http.Handler) http.Handler {
+    public := make(map[string]bool, len(publicPaths))
+    for _, path := range publicPaths {
+        public[path] = true
+    }
+    
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if public[r.URL.Path] {
+                next.ServeHTTP(w, r)
+                return
+            }
+            
+            apiKey := r.Header.Get("X-API-KEY")
+            if apiKey == "" {
+                writeUnauthorized(w, "missing API key")
+                return
+            }
+            
+            r, key, err := authenticate(keys, r)
+            if err != nil {
+                details := "invalid API key"
+                if errors.Is(err, auth.ErrKeyExpired) {
+                    details = "API key expired"
+                } else if errors.Is(err, auth.ErrKeyRevoked) {
+                    details = "API key revoked"
+                }
+                writeUnauthorized(w, details)
+                return
+            }
+            keys.MarkUsed(key.ID)
+            
+            principal := key.Principal()
+            ctx := context.WithValue(r.Context(), PrincipalKey, principal)
+            
+            //автор изменений для аудита, хранилище не знает про HTTP
+            requestID, _ := tracing.RequestIDFromContext(ctx)
+            ctx = models.WithActor(ctx, models.Actor{
+                UserID:    principal.UserID,
+                Name:      principal.Name,
+                KeyID:     principal.KeyID,
+                RequestID: requestID,
+            })
+            next.ServeHTTP(w, r.WithContext(ctx))
+        })
+    }
+}
+
+//RequireScope пропускает запрос, только если у ключа есть нужный скоуп
+func RequireScope(scope string, next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        apiKey := r.Header.Get("X-API-KEY")
-        if apiKey != ValidAPIKey {
+        principal, ok := PrincipalFromContext(r.Context())
+        if !ok || !principal.HasScope(scope) {
             w.Header().Set("Content-Type", "application/json")
-            w.WriteHeader(http.StatusUnauthorized)
+            w.WriteHeader(http.StatusForbidden)
             json.NewEncoder(w).Encode(models.ErrorResponse{
-                Error:   "unauthorized",
-                Details: "invalid or missing API key",
+                Error:   "forbidden",
+                Details: "API key lacks required scope " + scope,
             })
             return
         }
         next.ServeHTTP(w, r)
     })
-}
\ No newline at end of file
+}
+
+func writeUnauthorized(w http.ResponseWriter, details string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusUnauthorized)
+    json.NewEncoder(w).Encode(models.ErrorResponse{
+        Error:   "unauthorized",
+        Details: details,
+    })
+}
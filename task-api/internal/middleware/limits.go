@@ -0,0 +1,129 @@
+package middleware
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "task-api/internal/auth"
+    "task-api/internal/models"
+    "task-api/internal/ratelimit"
+    "task-api/internal/tracing"
+    "time"
+)
+
+//MaxBodyMiddleware ограничивает тело запроса limit байтами, маршруты из
+//routeLimits (шаблон -> байты) - своим пределом. Запрос с заведомо
+//большим Content-Length отклоняется сразу, иначе хендлер получит
+//*http.MaxBytesError при чтении. limit <= 0 отключает ограничение.
+func MaxBodyMiddleware(limit int64, routeLimits map[string]int64) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        if limit <= 0 {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            //шаблон маршрута заранее нашел RouteRecorder
+            r, route := withRouteInfo(r)
+            limit := limit
+            if routeLimit, ok := routeLimits[route.pattern]; ok {
+                limit = routeLimit
+            }
+            
+            if r.ContentLength > limit {
+                resp := models.DetailedErrorResponse{
+                    Error:   "request body too large",
+                    Details: fmt.Sprintf("request body must not exceed %d bytes", limit),
+                }
+                resp.RequestID, _ = tracing.RequestIDFromContext(r.Context())
+                
+                w.Header().Set("Content-Type", "application/json")
+                w.Header().Set("Connection", "close")
+                w.WriteHeader(http.StatusRequestEntityTooLarge)
+                json.NewEncoder(w).Encode(resp)
+                return
+            }
+            
+            r.Body = http.MaxBytesReader(w, r.Body, limit)
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+//RateLimitMiddleware ограничивает частоту запросов: действующий ключ - по
+//скоупу маршрута из routeScopes (шаблон -> скоуп), запрос без ключа или с
+//чужим ключом - по IP клиента. Стоит перед APIKeyMiddleware, чтобы и подбор
+//ключей упирался в лимит; найденный ключ передается ему через контекст.
+//Пути из publicPaths (метрики, пробы) не ограничиваются, nil limiter
+//отключает ограничение.
+func RateLimitMiddleware(limiter *ratelimit.Limiter, keys *auth.KeyStore, routeScopes map[string]string, publicPaths ...string) func(http.Handler) http.Handler {
+    public := make(map[string]bool, len(publicPaths))
+    for _, path := range publicPaths {
+        public[path] = true
+    }
+    
+    return func(next http.Handler) http.Handler {
+        if limiter == nil {
+            return next
+        }
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if public[r.URL.Path] {
+                next.ServeHTTP(w, r)
+                return
+            }
+            
+            var decision ratelimit.Decision
+            var details string
+            r, key, err := authenticate(keys, r)
+            if err == nil {
+                //шаблон маршрута заранее нашел RouteRecorder
+                _, route := withRouteInfo(r)
+                scope := routeScopes[route.pattern]
+                decision = limiter.AllowKey(key.Lineage(), scope)
+                details = fmt.Sprintf("rate limit of %d requests per minute exceeded for scope %s", decision.Limit, scope)
+                if scope == "" {
+                    details = fmt.Sprintf("rate limit of %d requests per minute exceeded", decision.Limit)
+                }
+                if decision.QuotaExceeded {
+                    details = fmt.Sprintf("daily quota of %d requests exceeded, resets at 00:00 UTC", decision.Quota)
+                }
+            } else {
+                decision = limiter.AllowAnonymous(ClientIP(r))
+                details = fmt.Sprintf("rate limit of %d requests per minute exceeded for requests without a valid API key", decision.Limit)
+            }
+            
+            if decision.Limited {
+                w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+                w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+                w.Header().Set("RateLimit-Reset", ceilSeconds(decision.Reset))
+            }
+            if decision.Quota > 0 {
+                w.Header().Set("X-Quota-Limit", strconv.Itoa(decision.Quota))
+                w.Header().Set("X-Quota-Remaining", strconv.Itoa(decision.QuotaRemaining))
+                w.Header().Set("X-Quota-Reset", ceilSeconds(decision.QuotaReset))
+            }
+            
+            if !decision.Allowed {
+                resp := models.DetailedErrorResponse{
+                    Error:   "too many requests",
+                    Details: details,
+                }
+                resp.RequestID, _ = tracing.RequestIDFromContext(r.Context())
+                
+                w.Header().Set("Content-Type", "application/json")
+                w.Header().Set("Retry-After", ceilSeconds(decision.RetryAfter))
+                w.WriteHeader(http.StatusTooManyRequests)
+                json.NewEncoder(w).Encode(resp)
+                return
+            }
+            
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+//ceilSeconds округляет вверх: клиент, выждавший Retry-After, не должен
+//снова получить 429
+func ceilSeconds(d time.Duration) string {
+    return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
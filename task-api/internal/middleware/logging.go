@@ -1,34 +1,128 @@
 package middleware
 
 import (
-    "log"
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
     "net/http"
+    "strings"
+    "task-api/internal/tracing"
     "time"
 )
 
-func LoggingMiddleware(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        start := time.Now()
-        
-        rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-        next.ServeHTTP(rw, r)
-        
-        log.Printf("[%s] %s %s %d %v", 
-            time.Now().Format("2006-01-02T15:04:05"),
-            r.Method,
-            r.URL.Path,
-            rw.statusCode,
-            time.Since(start),
-        )
-    })
+const LoggerKey contextKey = "logger"
+
+//NewLogger создает slog-логгер с уровнем debug|info|warn|error и форматом text|json
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+    var lvl slog.Level
+    if err := lvl.UnmarshalText([]byte(level)); err != nil {
+        return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+    }
+
+    opts := &slog.HandlerOptions{Level: lvl}
+    switch strings.ToLower(format) {
+    case "json":
+        return slog.New(slog.NewJSONHandler(w, opts)), nil
+    case "text", "":
+        return slog.New(slog.NewTextHandler(w, opts)), nil
+    default:
+        return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+    }
+}
+
+//LoggerFromContext возвращает логгер запроса с request_id, вне запроса - slog.Default()
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+    if logger, ok := ctx.Value(LoggerKey).(*slog.Logger); ok {
+        return logger
+    }
+    return slog.Default()
+}
+
+//LoggingMiddleware пишет access-лог и кладет в контекст логгер запроса.
+//Должен стоять после RequestIDMiddleware, чтобы видеть ID запроса.
+func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            start := time.Now()
+
+            reqLogger := logger
+            if requestID, ok := tracing.RequestIDFromContext(r.Context()); ok {
+                reqLogger = reqLogger.With(slog.String("request_id", requestID))
+            }
+            if span, ok := tracing.SpanFromContext(r.Context()); ok {
+                reqLogger = reqLogger.With(slog.String("trace_id", span.TraceIDString()))
+            }
+
+            r, route := withRouteInfo(r)
+            ctx := context.WithValue(r.Context(), LoggerKey, reqLogger)
+
+            rw := wrapResponseWriter(w)
+            next.ServeHTTP(rw, r.WithContext(ctx))
+
+            level := slog.LevelInfo
+            switch {
+            case rw.statusCode >= 500:
+                level = slog.LevelError
+            case rw.statusCode >= 400:
+                level = slog.LevelWarn
+            }
+
+            reqLogger.LogAttrs(r.Context(), level, "request completed",
+                slog.String("method", r.Method),
+                slog.String("route", route.patternOr(r.URL.Path)),
+                slog.String("path", r.URL.Path),
+                slog.Int("status", rw.statusCode),
+                slog.Int64("bytes", rw.bytesWritten),
+                slog.Duration("latency", time.Since(start)),
+                slog.String("client_ip", ClientIP(r)),
+            )
+        })
+    }
+}
+
+//ClientIP берет адрес из RemoteAddr. X-Forwarded-For не учитываем: без
+//доверенного прокси перед сервисом его может подделать кто угодно.
+func ClientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
 }
 
 type responseWriter struct {
     http.ResponseWriter
-    statusCode int
+    statusCode   int
+    bytesWritten int64
+    wroteHeader  bool
+}
+
+//wrapResponseWriter не оборачивает повторно, если снаружи уже стоит responseWriter
+func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
+    if rw, ok := w.(*responseWriter); ok {
+        return rw
+    }
+    return &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 }
 
 func (rw *responseWriter) WriteHeader(statusCode int) {
-    rw.statusCode = statusCode
+    if !rw.wroteHeader {
+        rw.statusCode = statusCode
+        rw.wroteHeader = true
+    }
     rw.ResponseWriter.WriteHeader(statusCode)
-}
\ No newline at end of file
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+    rw.wroteHeader = true
+    n, err := rw.ResponseWriter.Write(b)
+    rw.bytesWritten += int64(n)
+    return n, err
+}
+
+//Unwrap дает http.ResponseController добраться до Flush и дедлайнов исходного writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+    return rw.ResponseWriter
+}
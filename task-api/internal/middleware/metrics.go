@@ -0,0 +1,29 @@
+package middleware
+
+import (
+    "net/http"
+    "strconv"
+    "task-api/internal/metrics"
+    "time"
+)
+
+//MetricsMiddleware считает запросы, задержки и запросы в работе по шаблону маршрута.
+//Запросы мимо всех маршрутов попадают в route="unmatched", чтобы не плодить серии.
+func MetricsMiddleware(m *metrics.HTTPMetrics) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            start := time.Now()
+            inFlight := m.InFlight.WithLabelValues()
+            inFlight.Inc()
+            defer inFlight.Dec()
+            
+            r, route := withRouteInfo(r)
+            rw := wrapResponseWriter(w)
+            next.ServeHTTP(rw, r)
+            
+            pattern := route.patternOr("unmatched")
+            m.Requests.WithLabelValues(r.Method, pattern, strconv.Itoa(rw.statusCode)).Inc()
+            m.Duration.WithLabelValues(r.Method, pattern).Observe(time.Since(start).Seconds())
+        })
+    }
+}
@@ -1,27 +1,49 @@
 package middleware
 
 import (
-    "context"
     "net/http"
-    "strconv"
-    "time"
+    "strings"
+    "task-api/internal/tracing"
 )
 
-type contextKey string
-
-const RequestIDKey contextKey = "request_id"
+const maxTracestateLength = 512
 
+//RequestIDMiddleware берет валидный X-Request-ID клиента или генерирует UUIDv7,
+//а также продолжает W3C-трейс из traceparent/tracestate либо начинает новый
 func RequestIDMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        //генерируем Request ID на основе timestamp
-        requestID := strconv.FormatInt(time.Now().UnixNano(), 10)
+        requestID := r.Header.Get(tracing.HeaderRequestID)
+        if !tracing.ValidRequestID(requestID) {
+            requestID = tracing.NewRequestID()
+        }
+        
+        var span tracing.SpanContext
+        if parent, ok := tracing.ParseTraceparent(r.Header.Get(tracing.HeaderTraceparent)); ok {
+            //tracestate имеет смысл только вместе с валидным traceparent
+            parent.State = sanitizeTracestate(r.Header.Values(tracing.HeaderTracestate))
+            span = tracing.NewSpan(&parent)
+        } else {
+            span = tracing.NewSpan(nil)
+        }
         
-        //добавляем в хедеры
-        w.Header().Set("X-Request-ID", requestID)
+        w.Header().Set(tracing.HeaderRequestID, requestID)
+        w.Header().Set(tracing.HeaderTraceparent, span.Traceparent())
+        if span.State != "" {
+            w.Header().Set(tracing.HeaderTracestate, span.State)
+        }
         
-        //добавляем в контекст запроса
-        ctx := context.WithValue(r.Context(), RequestIDKey, requestID)
+        ctx := tracing.WithRequestID(r.Context(), requestID)
+        ctx = tracing.WithSpan(ctx, span)
         
         next.ServeHTTP(w, r.WithContext(ctx))
     })
-}
\ No newline at end of file
+}
+
+//sanitizeTracestate склеивает повторные заголовки и отбрасывает слишком длинные
+func sanitizeTracestate(values []string) string {
+    state := strings.TrimSpace(strings.Join(values, ","))
+    if len(state) > maxTracestateLength {
+        return ""
+    }
+    return state
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+    "context"
+    "net/http"
+)
+
+const routeInfoKey contextKey = "route_info"
+
+//routeInfo хранит шаблон маршрута, который ServeMux выбрал для запроса.
+//ServeMux пишет Pattern в свою копию запроса, поэтому внешние мидлвари
+//узнают его только через общий указатель в контексте.
+type routeInfo struct {
+    pattern string
+}
+
+func (ri *routeInfo) patternOr(fallback string) string {
+    if ri.pattern == "" {
+        return fallback
+    }
+    return ri.pattern
+}
+
+//withRouteInfo кладет routeInfo в контекст, если его там еще нет
+func withRouteInfo(r *http.Request) (*http.Request, *routeInfo) {
+    if ri, ok := r.Context().Value(routeInfoKey).(*routeInfo); ok {
+        return r, ri
+    }
+    ri := &routeInfo{}
+    return r.WithContext(context.WithValue(r.Context(), routeInfoKey, ri)), ri
+}
+
+//RouteRecorder заранее ищет в mux шаблон маршрута, чтобы логи и метрики видели его
+//даже для запросов, отбитых раньше роутера, например без API-ключа
+func RouteRecorder(mux *http.ServeMux) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            r, ri := withRouteInfo(r)
+            if _, pattern := mux.Handler(r); pattern != "" {
+                ri.pattern = pattern
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
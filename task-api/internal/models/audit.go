@@ -0,0 +1,55 @@
+package models
+
+import (
+    "context"
+    "time"
+)
+
+//Actor - кто и каким запросом изменил задачу. Пустой Actor означает сам
+//сервис, например демо-задачи при старте.
+type Actor struct {
+    UserID    int    `json:"userId,omitempty"`
+    Name      string `json:"name,omitempty"`
+    KeyID     string `json:"key_id,omitempty"`
+    RequestID string `json:"-"`
+}
+
+type actorKey struct{}
+
+//WithActor кладет автора изменений в контекст, хранилище достает его для аудита
+func WithActor(ctx context.Context, actor Actor) context.Context {
+    return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) Actor {
+    actor, _ := ctx.Value(actorKey{}).(Actor)
+    return actor
+}
+
+//FieldChange - значение поля до и после изменения, nil - поля не было
+type FieldChange struct {
+    Field  string `json:"field"`
+    Before any    `json:"before"`
+    After  any    `json:"after"`
+}
+
+//AuditEntry - запись истории задачи. Version - версия задачи после
+//изменения, у deleted - последняя версия перед удалением.
+type AuditEntry struct {
+    ID        uint64        `json:"id"`
+    TaskID    int           `json:"task_id"`
+    OwnerID   int           `json:"-"`
+    Type      TaskEventType `json:"type"`
+    Version   int           `json:"version"`
+    Actor     Actor         `json:"actor"`
+    RequestID string        `json:"request_id,omitempty"`
+    At        time.Time     `json:"at"`
+    Changes   []FieldChange `json:"changes"`
+}
+
+//TaskHistory - ответ GET /tasks/{id}/history, записи от старых к новым
+type TaskHistory struct {
+    TaskID  int          `json:"task_id"`
+    Deleted bool         `json:"deleted"`
+    Entries []AuditEntry `json:"entries"`
+}
@@ -0,0 +1,58 @@
+package models
+
+type BulkOp string
+
+const (
+    BulkCreate BulkOp = "create"
+    BulkUpdate BulkOp = "update"
+    BulkDelete BulkOp = "delete"
+)
+
+type BulkMode string
+
+const (
+    //BulkAtomic применяет все операции или ни одной
+    BulkAtomic BulkMode = "atomic"
+    //BulkBestEffort применяет что получилось, ошибки возвращаются по операциям
+    BulkBestEffort BulkMode = "best_effort"
+)
+
+type BulkStatus string
+
+const (
+    BulkStatusCreated BulkStatus = "created"
+    BulkStatusUpdated BulkStatus = "updated"
+    BulkStatusDeleted BulkStatus = "deleted"
+    BulkStatusFailed  BulkStatus = "failed"
+    //BulkStatusSkipped - операция не применена, потому что atomic-пакет откатился
+    BulkStatusSkipped BulkStatus = "skipped"
+)
+
+//BulkOperation - одна уже провалидированная операция пакета. Для create
+//патч накладывается на пустую задачу, ID игнорируется. IfVersion, если не 0,
+//требует у update и delete именно эту версию задачи.
+type BulkOperation struct {
+    Op        BulkOp
+    ID        int
+    IfVersion int
+    Patch     TaskPatch
+}
+
+//BulkResult - итог операции с индексом из исходного запроса
+type BulkResult struct {
+    Index  int               `json:"index"`
+    Op     BulkOp            `json:"op"`
+    Status BulkStatus        `json:"status"`
+    ID     int               `json:"id,omitempty"`
+    Task   *Task             `json:"task,omitempty"`
+    Error  string            `json:"error,omitempty"`
+    Errors []ValidationError `json:"validation_errors,omitempty"`
+}
+
+type BulkResponse struct {
+    Mode      BulkMode     `json:"mode"`
+    Applied   bool         `json:"applied"`
+    Succeeded int          `json:"succeeded"`
+    Failed    int          `json:"failed"`
+    Results   []BulkResult `json:"results"`
+}
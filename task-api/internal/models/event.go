@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type TaskEventType string
+
+const (
+    TaskCreated TaskEventType = "created"
+    TaskUpdated TaskEventType = "updated"
+    TaskDeleted TaskEventType = "deleted"
+)
+
+//TaskChange - мутация задачи, которую хранилище отдает слушателям.
+//Previous - состояние до изменения, у created он nil. Actor и At нужны аудиту.
+type TaskChange struct {
+    Type     TaskEventType
+    Task     Task
+    Previous *Task
+    Actor    Actor
+    At       time.Time
+}
+
+//TaskEvent - уведомление об изменении задачи для потока /tasks/events.
+//У deleted в Task лежит состояние задачи перед удалением.
+type TaskEvent struct {
+    ID         uint64        `json:"id"`
+    Type       TaskEventType `json:"type"`
+    Task       Task          `json:"task"`
+    OccurredAt time.Time     `json:"occurred_at"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+type TaskSortField string
+
+const (
+    SortByID        TaskSortField = "id"
+    SortByTitle     TaskSortField = "title"
+    SortByCreatedAt TaskSortField = "created_at"
+    SortByPriority  TaskSortField = "priority"
+)
+
+func (f TaskSortField) Valid() bool {
+    switch f {
+    case SortByID, SortByTitle, SortByCreatedAt, SortByPriority:
+        return true
+    }
+    return false
+}
+
+//TaskFilter - условия отбора задач, пустые поля не фильтруют
+type TaskFilter struct {
+    Done          *bool
+    TitleContains string
+    Tag           string
+    DueAfter      *time.Time
+    DueBefore     *time.Time
+}
+
+type TaskQuery struct {
+    Filter TaskFilter
+    Sort   TaskSortField
+    Desc   bool
+    Limit  int
+    Cursor string
+}
+
+type TaskPage struct {
+    Items      []Task `json:"items"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+//SearchQuery - запрос GET /tasks/search: Query в синтаксисе search.Parse,
+//Done дополнительно фильтрует по статусу
+type SearchQuery struct {
+    Query  string
+    Done   *bool
+    Limit  int
+    Offset int
+}
+
+//SearchHit - найденная задача. Snippets - фрагменты полей с найденными
+//словами в <mark>, текст вне тегов экранирован как HTML.
+type SearchHit struct {
+    Task     Task              `json:"task"`
+    Score    float64           `json:"score"`
+    Snippets map[string]string `json:"snippets"`
+}
+
+type SearchResult struct {
+    Query string      `json:"query"`
+    Total int         `json:"total"`
+    Hits  []SearchHit `json:"hits"`
+}
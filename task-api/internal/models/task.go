@@ -1,10 +1,167 @@
 package models
 
+import (
+    "strings"
+    "time"
+)
+
+type Priority string
+
+const (
+    PriorityLow    Priority = "low"
+    PriorityNormal Priority = "normal"
+    PriorityHigh   Priority = "high"
+    PriorityUrgent Priority = "urgent"
+)
+
+//Rank задает порядок приоритетов при сортировке
+func (p Priority) Rank() int {
+    switch p {
+    case PriorityLow:
+        return 0
+    case PriorityHigh:
+        return 2
+    case PriorityUrgent:
+        return 3
+    }
+    return 1
+}
+
+func (p Priority) Valid() bool {
+    switch p {
+    case PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent:
+        return true
+    }
+    return false
+}
+
 type Task struct {
-    ID     int    `json:"id"`
-    Title  string `json:"title"`
-    Done   bool   `json:"done"`
-    UserID int    `json:"userId,omitempty"`
+    ID          int         `json:"id"`
+    Title       string      `json:"title"`
+    Description string      `json:"description,omitempty"`
+    Done        bool        `json:"done"`
+    DueAt       *time.Time  `json:"due_at,omitempty"`
+    Priority    Priority    `json:"priority"`
+    Tags        []string    `json:"tags,omitempty"`
+    //ParentID делает задачу подзадачей, BlockedBy - задачи, которые надо закрыть раньше
+    ParentID    *int        `json:"parent_id,omitempty"`
+    BlockedBy   []int       `json:"blocked_by,omitempty"`
+    Recurrence  *Recurrence `json:"recurrence,omitempty"`
+    UserID      int         `json:"userId,omitempty"`
+    ExternalRef string      `json:"external_ref,omitempty"`
+    //Version растет с каждым изменением, из него строится ETag
+    Version     int         `json:"version"`
+    CreatedAt   time.Time   `json:"created_at"`
+    UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+//Recurrence - правило повторения задачи: cron-выражение или RRULE из RFC 5545,
+//вычисляется в зоне Timezone (IANA, пустая - UTC). Start - начало серии,
+//SeriesID - ID ее первой задачи. NextAt - когда появится следующее вхождение;
+//nil, если серия закончилась или следующее вхождение уже создано.
+type Recurrence struct {
+    Rule     string     `json:"rule"`
+    Timezone string     `json:"timezone,omitempty"`
+    Start    time.Time  `json:"start"`
+    NextAt   *time.Time `json:"next_at,omitempty"`
+    SeriesID int        `json:"series_id"`
+}
+
+//SameRule сравнивает правило и зону, вычисляемые поля не учитываются
+func (r *Recurrence) SameRule(other *Recurrence) bool {
+    if r == nil || other == nil {
+        return r == other
+    }
+    return r.Rule == other.Rule && r.Timezone == other.Timezone
+}
+
+type UpsertResult string
+
+const (
+    UpsertCreated   UpsertResult = "created"
+    UpsertUpdated   UpsertResult = "updated"
+    UpsertUnchanged UpsertResult = "unchanged"
+)
+
+//TaskPatch - частичное обновление задачи, nil означает "поле не передано"
+type TaskPatch struct {
+    Title           *string
+    Description     *string
+    Done            *bool
+    DueAt           *time.Time
+    ClearDueAt      bool
+    Priority        *Priority
+    Tags            *[]string
+    ParentID        *int
+    ClearParent     bool
+    BlockedBy       *[]int
+    //Recurrence задает только Rule и Timezone, остальное считает хранилище
+    Recurrence      *Recurrence
+    ClearRecurrence bool
+}
+
+func (p TaskPatch) IsEmpty() bool {
+    return p.Title == nil && p.Description == nil && p.Done == nil &&
+        p.DueAt == nil && !p.ClearDueAt && p.Priority == nil && p.Tags == nil &&
+        p.ParentID == nil && !p.ClearParent && p.BlockedBy == nil &&
+        p.Recurrence == nil && !p.ClearRecurrence
+}
+
+//Apply накладывает переданные поля на задачу
+func (p TaskPatch) Apply(task *Task) {
+    if p.Title != nil {
+        task.Title = *p.Title
+    }
+    if p.Description != nil {
+        task.Description = *p.Description
+    }
+    if p.Done != nil {
+        task.Done = *p.Done
+    }
+    if p.ClearDueAt {
+        task.DueAt = nil
+    }
+    if p.DueAt != nil {
+        dueAt := *p.DueAt
+        task.DueAt = &dueAt
+    }
+    if p.Priority != nil {
+        task.Priority = *p.Priority
+    }
+    if p.Tags != nil {
+        task.Tags = append([]string(nil), (*p.Tags)...)
+    }
+    if p.ClearParent {
+        task.ParentID = nil
+    }
+    if p.ParentID != nil {
+        parentID := *p.ParentID
+        task.ParentID = &parentID
+    }
+    if p.BlockedBy != nil {
+        task.BlockedBy = append([]int(nil), (*p.BlockedBy)...)
+    }
+    if p.ClearRecurrence {
+        task.Recurrence = nil
+    }
+    //то же правило не перезапускает серию, новое начинает ее заново
+    if p.Recurrence != nil && !task.Recurrence.SameRule(p.Recurrence) {
+        recurrence := Recurrence{Rule: p.Recurrence.Rule, Timezone: p.Recurrence.Timezone}
+        if task.Recurrence != nil {
+            recurrence.SeriesID = task.Recurrence.SeriesID
+        }
+        task.Recurrence = &recurrence
+    }
+}
+
+//TaskTree - задача с подзадачами для GET /tasks/{id}/tree. OpenBlockers -
+//незакрытые задачи из blocked_by, пока они есть, done поставить нельзя.
+type TaskTree struct {
+    Task
+    OpenBlockers  []int      `json:"open_blockers,omitempty"`
+    SubtasksDone  int        `json:"subtasks_done"`
+    SubtasksTotal int        `json:"subtasks_total"`
+    Subtasks      []TaskTree `json:"subtasks"`
 }
 
 type ErrorResponse struct {
@@ -38,6 +195,20 @@ type ExternalTodo struct {
     Completed bool   `json:"completed"`
 }
 
+type ImportTodosRequest struct {
+    UserID int `json:"userId,omitempty"`
+    Limit  int `json:"limit,omitempty"`
+}
+
+type ImportSummary struct {
+    Total   int               `json:"total"`
+    Created int               `json:"created"`
+    Updated int               `json:"updated"`
+    Skipped int               `json:"skipped"`
+    Failed  int               `json:"failed"`
+    Errors  []ValidationError `json:"validation_errors,omitempty"`
+}
+
 type CreatePostRequest struct {
     Title  string `json:"title"`
     Body   string `json:"body"`
@@ -49,4 +220,25 @@ type CreatePostResponse struct {
     Title  string `json:"title"`
     Body   string `json:"body"`
     UserID int    `json:"userId"`
-}
\ No newline at end of file
+}
+
+//Principal - владелец API-ключа, от имени которого выполняется запрос
+type Principal struct {
+    UserID int      `json:"userId"`
+    Name   string   `json:"name"`
+    KeyID  string   `json:"key_id,omitempty"`
+    Scopes []string `json:"scopes,omitempty"`
+}
+
+//HasScope проверяет скоуп с учетом масок вида "external:*" и "*"
+func (p Principal) HasScope(required string) bool {
+    for _, granted := range p.Scopes {
+        if granted == "*" || granted == required {
+            return true
+        }
+        if prefix, ok := strings.CutSuffix(granted, "*"); ok && strings.HasPrefix(required, prefix) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,30 @@
+package models
+
+type TransferFormat string
+
+const (
+    //FormatJSONL - по задаче в формате ответа API на строку
+    FormatJSONL TransferFormat = "jsonl"
+    //FormatCSV - плоская таблица, списки через ";", повторение в колонках recurrence_*
+    FormatCSV TransferFormat = "csv"
+)
+
+//ImportLineError - ошибки строки файла импорта. TaskID не 0, если задача
+//создана, но не удалось восстановить ее связи.
+type ImportLineError struct {
+    Line   int               `json:"line"`
+    TaskID int               `json:"task_id,omitempty"`
+    Errors []ValidationError `json:"validation_errors"`
+}
+
+//ImportReport - итог POST /tasks/import. В dry_run Created - сколько задач
+//было бы создано. IDs сопоставляет id из файла с ID созданных задач.
+type ImportReport struct {
+    Format  TransferFormat    `json:"format"`
+    DryRun  bool              `json:"dry_run"`
+    Total   int               `json:"total"`
+    Created int               `json:"created"`
+    Failed  int               `json:"failed"`
+    IDs     map[int]int       `json:"ids,omitempty"`
+    Errors  []ImportLineError `json:"errors,omitempty"`
+}
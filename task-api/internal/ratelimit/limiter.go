@@ -0,0 +1,245 @@
+package ratelimit
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+    "sync"
+    "task-api/internal/auth"
+    "time"
+)
+
+//DefaultScopes - лимиты по умолчанию, запросов в минуту на ключ по скоупу маршрута
+const DefaultScopes = "tasks:read=600,tasks:write=120,external:read=60,external:write=30,webhooks:manage=60,keys:admin=30"
+
+const (
+    //DefaultPerMinute - лимит маршрутов, чей скоуп не указан в Config.Scopes
+    DefaultPerMinute = 120
+    //DefaultAnonymous - лимит по IP для запросов без действующего ключа
+    DefaultAnonymous = 60
+)
+
+//sweepInterval - как часто выбрасываются заполненные корзины и квоты прошлых суток
+const sweepInterval = time.Minute
+
+type Config struct {
+    //Scopes - запросов в минуту на ключ по скоупу маршрута, 0 снимает лимит
+    Scopes map[string]int
+    //Default - для скоупов, которых нет в Scopes, 0 снимает лимит
+    Default int
+    //Anonymous - запросов в минуту с одного IP без действующего ключа, 0 снимает лимит
+    Anonymous int
+    //DailyQuota - запросов на ключ за сутки UTC, 0 - без квоты
+    DailyQuota int
+}
+
+//Decision - итог проверки запроса. Limit, Remaining и Reset описывают корзину
+//и заданы, только если Limited; Reset - через сколько она снова заполнится.
+//Quota* заданы, если включена суточная квота. RetryAfter - когда стоит
+//повторить отклоненный запрос.
+type Decision struct {
+    Allowed        bool
+    Limited        bool
+    Limit          int
+    Remaining      int
+    Reset          time.Duration
+    RetryAfter     time.Duration
+    //QuotaExceeded - запрос отклонен суточной квотой, а не частотой
+    QuotaExceeded  bool
+    Quota          int
+    QuotaRemaining int
+    QuotaReset     time.Duration
+}
+
+//bucket - token bucket: емкость perMinute, пополняется равномерно за минуту,
+//так что клиент может потратить минутный лимит разом, но не больше
+type bucket struct {
+    perMinute int
+    tokens    float64
+    updated   time.Time
+}
+
+//refill пополняет корзину к моменту now
+func (b *bucket) refill(now time.Time) {
+    capacity := float64(b.perMinute)
+    b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*b.rate())
+    b.updated = now
+}
+
+//rate - токенов в секунду
+func (b *bucket) rate() float64 {
+    return float64(b.perMinute) / 60
+}
+
+type bucketKey struct {
+    identity string
+    scope    string
+}
+
+type quota struct {
+    day  time.Time
+    used int
+}
+
+//Limiter считает запросы в памяти процесса: у каждой реплики свои корзины.
+//Ключ получает отдельную корзину на каждый скоуп, запросы без ключа делят
+//одну корзину на IP.
+type Limiter struct {
+    mu        sync.Mutex
+    cfg       Config
+    buckets   map[bucketKey]*bucket
+    quotas    map[string]*quota
+    lastSweep time.Time
+    now       func() time.Time
+}
+
+func New(cfg Config) *Limiter {
+    return &Limiter{
+        cfg:     cfg,
+        buckets: make(map[bucketKey]*bucket),
+        quotas:  make(map[string]*quota),
+        now:     time.Now,
+    }
+}
+
+//AllowKey проверяет запрос ключа keyID к маршруту со скоупом scope. Чтобы
+//ротация не обнуляла лимиты, keyID - общий для цепочки ротаций, см.
+//auth.APIKey.Lineage. Отклоненный запрос не тратит ни токен, ни квоту.
+func (l *Limiter) AllowKey(keyID, scope string) Decision {
+    perMinute, ok := l.cfg.Scopes[scope]
+    if !ok {
+        perMinute = l.cfg.Default
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := l.now()
+    l.sweepLocked(now)
+    d := Decision{Allowed: true}
+
+    var q *quota
+    if l.cfg.DailyQuota > 0 {
+        q = l.quotaLocked(keyID, now)
+        d.Quota = l.cfg.DailyQuota
+        d.QuotaRemaining = max(l.cfg.DailyQuota-q.used, 0)
+        d.QuotaReset = q.day.Add(24 * time.Hour).Sub(now)
+        if q.used >= l.cfg.DailyQuota {
+            d.Allowed = false
+            d.QuotaExceeded = true
+            d.RetryAfter = d.QuotaReset
+            return d
+        }
+    }
+
+    l.takeLocked(&d, bucketKey{identity: "key:" + keyID, scope: scope}, perMinute, now)
+    if d.Allowed && q != nil {
+        q.used++
+        d.QuotaRemaining--
+    }
+    return d
+}
+
+//AllowAnonymous проверяет запрос без действующего ключа по IP клиента
+func (l *Limiter) AllowAnonymous(ip string) Decision {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := l.now()
+    l.sweepLocked(now)
+    d := Decision{Allowed: true}
+    l.takeLocked(&d, bucketKey{identity: "ip:" + ip}, l.cfg.Anonymous, now)
+    return d
+}
+
+func (l *Limiter) takeLocked(d *Decision, key bucketKey, perMinute int, now time.Time) {
+    if perMinute <= 0 {
+        return
+    }
+
+    b := l.buckets[key]
+    if b == nil {
+        b = &bucket{perMinute: perMinute, tokens: float64(perMinute), updated: now}
+        l.buckets[key] = b
+    }
+    b.refill(now)
+
+    d.Limited = true
+    d.Limit = perMinute
+    if b.tokens >= 1 {
+        b.tokens--
+    } else {
+        d.Allowed = false
+        d.RetryAfter = seconds((1 - b.tokens) / b.rate())
+    }
+    d.Remaining = int(b.tokens)
+    d.Reset = seconds((float64(perMinute) - b.tokens) / b.rate())
+}
+
+func (l *Limiter) quotaLocked(keyID string, now time.Time) *quota {
+    day := now.UTC().Truncate(24 * time.Hour)
+    q := l.quotas[keyID]
+    if q == nil || !q.day.Equal(day) {
+        q = &quota{day: day}
+        l.quotas[keyID] = q
+    }
+    return q
+}
+
+//sweepLocked выбрасывает заполненные корзины: новая корзина была бы такой
+//же, а IP клиентов иначе копились бы без конца
+func (l *Limiter) sweepLocked(now time.Time) {
+    if now.Sub(l.lastSweep) < sweepInterval {
+        return
+    }
+    l.lastSweep = now
+
+    for key, b := range l.buckets {
+        b.refill(now)
+        if b.tokens >= float64(b.perMinute) {
+            delete(l.buckets, key)
+        }
+    }
+    today := now.UTC().Truncate(24 * time.Hour)
+    for keyID, q := range l.quotas {
+        if q.day.Before(today) {
+            delete(l.quotas, keyID)
+        }
+    }
+}
+
+func seconds(s float64) time.Duration {
+    return time.Duration(s * float64(time.Second))
+}
+
+//ParseScopes разбирает лимиты вида "tasks:read=600,tasks:write=120" -
+//запросов в минуту на ключ по скоупу маршрута
+func ParseScopes(spec string) (map[string]int, error) {
+    scopes := map[string]int{}
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+
+        scope, value, ok := strings.Cut(entry, "=")
+        scope = strings.TrimSpace(scope)
+        if !ok || scope == "" {
+            return nil, fmt.Errorf("expected scope=requests_per_minute, got %q", entry)
+        }
+        //маршруты требуют конкретный скоуп, маска ни с одним не совпадет
+        if !auth.ValidScope(scope) || strings.HasSuffix(scope, "*") {
+            return nil, fmt.Errorf("unknown scope %q", scope)
+        }
+        if _, duplicate := scopes[scope]; duplicate {
+            return nil, fmt.Errorf("duplicate scope %q", scope)
+        }
+        perMinute, err := strconv.Atoi(strings.TrimSpace(value))
+        if err != nil || perMinute < 0 {
+            return nil, fmt.Errorf("limit of %s must be a non-negative integer, got %q", scope, value)
+        }
+        scopes[scope] = perMinute
+    }
+    return scopes, nil
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+    "testing"
+    "time"
+)
+
+func testLimiter(cfg Config, now *time.Time) *Limiter {
+    l := New(cfg)
+    l.now = func() time.Time { return *now }
+    return l
+}
+
+func TestLimiter(t *testing.T) {
+    t.Run("Bucket allows a burst and refills over a minute", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        l := testLimiter(Config{Scopes: map[string]int{"tasks:write": 3}}, &now)
+
+        for i := 0; i < 3; i++ {
+            if d := l.AllowKey("k1", "tasks:write"); !d.Allowed || d.Remaining != 2-i {
+                t.Fatalf("request %d: unexpected decision %+v", i, d)
+            }
+        }
+        d := l.AllowKey("k1", "tasks:write")
+        if d.Allowed || d.Limit != 3 || d.Remaining != 0 || d.RetryAfter != 20*time.Second || d.Reset != time.Minute {
+            t.Fatalf("expected rejection with retry after one token, got %+v", d)
+        }
+
+        now = now.Add(20 * time.Second)
+        if d := l.AllowKey("k1", "tasks:write"); !d.Allowed {
+            t.Errorf("expected refilled token to be spent, got %+v", d)
+        }
+    })
+
+    t.Run("Buckets are separate per key and scope", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        l := testLimiter(Config{Scopes: map[string]int{"tasks:read": 1, "tasks:write": 1}, Default: 1}, &now)
+
+        l.AllowKey("k1", "tasks:read")
+        if d := l.AllowKey("k1", "tasks:write"); !d.Allowed {
+            t.Errorf("expected other scope to have its own bucket, got %+v", d)
+        }
+        if d := l.AllowKey("k2", "tasks:read"); !d.Allowed {
+            t.Errorf("expected other key to have its own bucket, got %+v", d)
+        }
+        if d := l.AllowKey("k1", "tasks:read"); d.Allowed {
+            t.Errorf("expected exhausted bucket to reject, got %+v", d)
+        }
+    })
+
+    t.Run("Zero limit disables the bucket", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        l := testLimiter(Config{Scopes: map[string]int{"keys:admin": 0}, Default: 1}, &now)
+
+        for i := 0; i < 5; i++ {
+            if d := l.AllowKey("k1", "keys:admin"); !d.Allowed || d.Limited {
+                t.Fatalf("expected unlimited scope, got %+v", d)
+            }
+            if d := l.AllowAnonymous("10.0.0.1"); !d.Allowed || d.Limited {
+                t.Fatalf("expected unlimited anonymous requests, got %+v", d)
+            }
+        }
+    })
+
+    t.Run("Anonymous requests share a bucket per IP", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        l := testLimiter(Config{Anonymous: 2}, &now)
+
+        l.AllowAnonymous("10.0.0.1")
+        l.AllowAnonymous("10.0.0.1")
+        if d := l.AllowAnonymous("10.0.0.1"); d.Allowed {
+            t.Errorf("expected IP to be limited, got %+v", d)
+        }
+        if d := l.AllowAnonymous("10.0.0.2"); !d.Allowed {
+            t.Errorf("expected other IP to pass, got %+v", d)
+        }
+    })
+
+    t.Run("Daily quota counts allowed requests and resets at midnight UTC", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+        l := testLimiter(Config{Default: 1, DailyQuota: 2}, &now)
+
+        if d := l.AllowKey("k1", ""); !d.Allowed || d.QuotaRemaining != 1 {
+            t.Fatalf("unexpected decision %+v", d)
+        }
+        //отказ по частоте не тратит квоту
+        if d := l.AllowKey("k1", ""); d.Allowed || d.QuotaExceeded || d.QuotaRemaining != 1 {
+            t.Fatalf("expected rate rejection without quota charge, got %+v", d)
+        }
+        now = now.Add(time.Minute)
+        l.AllowKey("k1", "")
+
+        now = now.Add(time.Minute)
+        d := l.AllowKey("k1", "")
+        if d.Allowed || !d.QuotaExceeded || d.RetryAfter != 58*time.Minute {
+            t.Fatalf("expected quota rejection until midnight, got %+v", d)
+        }
+
+        now = time.Date(2026, 10, 19, 0, 0, 1, 0, time.UTC)
+        if d := l.AllowKey("k1", ""); !d.Allowed || d.QuotaRemaining != 1 {
+            t.Errorf("expected new day to reset the quota, got %+v", d)
+        }
+    })
+
+    t.Run("Sweep drops full buckets", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+        l := testLimiter(Config{Anonymous: 60}, &now)
+
+        l.AllowAnonymous("10.0.0.1")
+        now = now.Add(2 * time.Minute)
+        l.AllowAnonymous("10.0.0.2")
+        if _, exists := l.buckets[bucketKey{identity: "ip:10.0.0.1"}]; exists {
+            t.Error("expected refilled bucket to be swept")
+        }
+    })
+}
+
+func TestParseScopes(t *testing.T) {
+    scopes, err := ParseScopes(DefaultScopes)
+    if err != nil || scopes["tasks:read"] != 600 || len(scopes) != 6 {
+        t.Fatalf("unexpected default scopes %v, %v", scopes, err)
+    }
+
+    for _, spec := range []string{
+        "tasks:read",
+        "=10",
+        "tasks:read=-1",
+        "tasks:read=many",
+        "tasks:delete=10",
+        "external:*=10",
+        "tasks:read=1,tasks:read=2",
+    } {
+        if _, err := ParseScopes(spec); err == nil {
+            t.Errorf("expected ParseScopes(%q) to fail", spec)
+        }
+    }
+}
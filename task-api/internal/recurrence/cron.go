@@ -0,0 +1,192 @@
+package recurrence
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+//cronHorizon - сколько лет вперед ищется вхождение, "30 февраля" не найдется никогда
+const cronHorizon = 8
+
+var cronMacros = map[string]string{
+    "@yearly":   "0 0 1 1 *",
+    "@annually": "0 0 1 1 *",
+    "@monthly":  "0 0 1 * *",
+    "@weekly":   "0 0 * * 0",
+    "@daily":    "0 0 * * *",
+    "@midnight": "0 0 * * *",
+    "@hourly":   "0 * * * *",
+}
+
+var (
+    monthNames   = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+    weekdayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+type cronField struct {
+    name  string
+    min   int
+    max   int
+    names []string
+}
+
+var cronFields = []cronField{
+    {name: "minute", min: 0, max: 59},
+    {name: "hour", min: 0, max: 23},
+    {name: "day of month", min: 1, max: 31},
+    {name: "month", min: 1, max: 12, names: monthNames},
+    //7 - тоже воскресенье
+    {name: "day of week", min: 0, max: 7, names: weekdayNames},
+}
+
+//cronSchedule - классический cron: минута, час, день месяца, месяц, день
+//недели. Если ограничены и день месяца, и день недели, подходит любой из них.
+type cronSchedule struct {
+    minutes  uint64
+    hours    uint64
+    days     uint64
+    months   uint64
+    weekdays uint64
+    //anyDay и anyWeekday - поле задано звездочкой
+    anyDay     bool
+    anyWeekday bool
+    loc        *time.Location
+}
+
+func parseCron(expr string, loc *time.Location) (*cronSchedule, error) {
+    if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+        expr = macro
+    }
+
+    parts := strings.Fields(expr)
+    if len(parts) != len(cronFields) {
+        return nil, fmt.Errorf("cron expression must have 5 fields (minute hour day month weekday), got %d", len(parts))
+    }
+
+    sets := make([]uint64, len(cronFields))
+    for i, field := range cronFields {
+        set, err := field.parse(parts[i])
+        if err != nil {
+            return nil, err
+        }
+        sets[i] = set
+    }
+
+    //воскресенье можно записать и как 0, и как 7
+    if sets[4]&(1<<7) != 0 {
+        sets[4] = sets[4]&^(1<<7) | 1
+    }
+
+    return &cronSchedule{
+        minutes:    sets[0],
+        hours:      sets[1],
+        days:       sets[2],
+        months:     sets[3],
+        weekdays:   sets[4],
+        anyDay:     strings.HasPrefix(parts[2], "*"),
+        anyWeekday: strings.HasPrefix(parts[4], "*"),
+        loc:        loc,
+    }, nil
+}
+
+//parse разбирает список через запятую из *, N, N-M и шагов /S
+func (f cronField) parse(expr string) (uint64, error) {
+    var set uint64
+    for _, item := range strings.Split(expr, ",") {
+        rangeExpr, stepExpr, hasStep := strings.Cut(item, "/")
+        step := 1
+        if hasStep {
+            n, err := strconv.Atoi(stepExpr)
+            if err != nil || n <= 0 {
+                return 0, fmt.Errorf("invalid step %q in %s field", stepExpr, f.name)
+            }
+            step = n
+        }
+
+        low, high := f.min, f.max
+        switch {
+        case rangeExpr == "*":
+        case strings.Contains(rangeExpr, "-"):
+            from, to, _ := strings.Cut(rangeExpr, "-")
+            var err error
+            if low, err = f.value(from); err != nil {
+                return 0, err
+            }
+            if high, err = f.value(to); err != nil {
+                return 0, err
+            }
+            if low > high {
+                return 0, fmt.Errorf("invalid range %q in %s field", rangeExpr, f.name)
+            }
+        default:
+            value, err := f.value(rangeExpr)
+            if err != nil {
+                return 0, err
+            }
+            low = value
+            //"5/15" - с пятой минуты до конца диапазона
+            if !hasStep {
+                high = value
+            }
+        }
+
+        for v := low; v <= high; v += step {
+            set |= 1 << v
+        }
+    }
+    return set, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+    for i, name := range f.names {
+        if strings.EqualFold(s, name) {
+            return i + f.min, nil
+        }
+    }
+    n, err := strconv.Atoi(s)
+    if err != nil || n < f.min || n > f.max {
+        return 0, fmt.Errorf("invalid value %q in %s field, expected %d-%d", s, f.name, f.min, f.max)
+    }
+    return n, nil
+}
+
+func (c *cronSchedule) Next(_, after time.Time) (time.Time, bool) {
+    local := after.In(c.loc)
+    day := civilOf(local)
+    last := day.addDays(cronHorizon * 366)
+
+    for ; day != last; day = day.addDays(1) {
+        if !c.matchesDay(day) {
+            continue
+        }
+        for hour := 0; hour < 24; hour++ {
+            if c.hours&(1<<hour) == 0 {
+                continue
+            }
+            for minute := 0; minute < 60; minute++ {
+                if c.minutes&(1<<minute) == 0 {
+                    continue
+                }
+                t, ok := day.at(hour, minute, c.loc)
+                if ok && t.After(after) {
+                    return t, true
+                }
+            }
+        }
+    }
+    return time.Time{}, false
+}
+
+func (c *cronSchedule) matchesDay(day civil) bool {
+    if c.months&(1<<int(day.month)) == 0 {
+        return false
+    }
+    dayMatch := c.days&(1<<day.day) != 0
+    weekdayMatch := c.weekdays&(1<<int(day.weekday())) != 0
+    if c.anyDay || c.anyWeekday {
+        return dayMatch && weekdayMatch
+    }
+    return dayMatch || weekdayMatch
+}
@@ -0,0 +1,99 @@
+package recurrence
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "task-api/internal/models"
+    "time"
+)
+
+const maxRuleLength = 200
+
+//Schedule вычисляет моменты повторения в своей временной зоне. start -
+//начало серии, от него RRULE отсчитывает INTERVAL и COUNT, cron его не
+//использует. Next возвращает первое вхождение строго после after, false -
+//вхождений больше нет.
+type Schedule interface {
+    Next(start, after time.Time) (time.Time, bool)
+}
+
+//Parse разбирает правило: RRULE из RFC 5545 (с префиксом "RRULE:" или без,
+//узнается по FREQ=) либо cron-выражение из пяти полей или макрос вроде @daily.
+//Пустая зона - UTC.
+func Parse(rule, timezone string) (Schedule, error) {
+    rule = strings.TrimSpace(rule)
+    if rule == "" {
+        return nil, errors.New("rule cannot be empty")
+    }
+    if len(rule) > maxRuleLength {
+        return nil, fmt.Errorf("rule too long, maximum %d characters", maxRuleLength)
+    }
+
+    loc, err := LoadLocation(timezone)
+    if err != nil {
+        return nil, err
+    }
+
+    upper := strings.ToUpper(rule)
+    if strings.HasPrefix(upper, "RRULE:") || strings.Contains(upper, "FREQ=") {
+        return parseRRule(strings.TrimPrefix(upper, "RRULE:"), loc)
+    }
+    return parseCron(rule, loc)
+}
+
+//For строит расписание по правилу задачи
+func For(rec models.Recurrence) (Schedule, error) {
+    return Parse(rec.Rule, rec.Timezone)
+}
+
+//LoadLocation загружает зону IANA, пустая строка - UTC. Local не
+//принимается: правило не должно зависеть от машины, где запущен сервис.
+func LoadLocation(name string) (*time.Location, error) {
+    if name == "" || name == "UTC" {
+        return time.UTC, nil
+    }
+    if name == "Local" {
+        return nil, errors.New("timezone must be an IANA name like Europe/Berlin")
+    }
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+        return nil, fmt.Errorf("unknown timezone %q", name)
+    }
+    return loc, nil
+}
+
+//civil - календарная дата без времени и зоны
+type civil struct {
+    year  int
+    month time.Month
+    day   int
+}
+
+func civilOf(t time.Time) civil {
+    y, m, d := t.Date()
+    return civil{year: y, month: m, day: d}
+}
+
+//addDays сдвигает дату, полдень в UTC не дает переходу на летнее время сбить день
+func (c civil) addDays(n int) civil {
+    return civilOf(time.Date(c.year, c.month, c.day+n, 12, 0, 0, 0, time.UTC))
+}
+
+func (c civil) weekday() time.Weekday {
+    return time.Date(c.year, c.month, c.day, 12, 0, 0, 0, time.UTC).Weekday()
+}
+
+//at собирает момент в зоне loc. Время, которого нет из-за перехода на
+//летнее время, пропускается.
+func (c civil) at(hour, minute int, loc *time.Location) (time.Time, bool) {
+    t := time.Date(c.year, c.month, c.day, hour, minute, 0, 0, loc)
+    if t.Hour() != hour || t.Minute() != minute || t.Day() != c.day {
+        return time.Time{}, false
+    }
+    return t, true
+}
+
+func daysIn(year int, month time.Month) int {
+    return time.Date(year, month+1, 0, 12, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,177 @@
+package recurrence
+
+import (
+    "testing"
+    "time"
+)
+
+func mustParse(t *testing.T, rule, timezone string) Schedule {
+    t.Helper()
+    sched, err := Parse(rule, timezone)
+    if err != nil {
+        t.Fatalf("Parse(%q, %q): %v", rule, timezone, err)
+    }
+    return sched
+}
+
+func mustLoad(t *testing.T, name string) *time.Location {
+    t.Helper()
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+        t.Skipf("timezone data for %s is not available: %v", name, err)
+    }
+    return loc
+}
+
+//occurrences разворачивает n вхождений подряд, начиная после after
+func occurrences(sched Schedule, start, after time.Time, n int) []time.Time {
+    var result []time.Time
+    for len(result) < n {
+        next, ok := sched.Next(start, after)
+        if !ok {
+            break
+        }
+        result = append(result, next)
+        after = next
+    }
+    return result
+}
+
+func assertTimes(t *testing.T, got []time.Time, want ...string) {
+    t.Helper()
+    if len(got) != len(want) {
+        t.Fatalf("expected %d occurrences, got %d: %v", len(want), len(got), got)
+    }
+    for i := range want {
+        if got[i].Format(time.RFC3339) != want[i] {
+            t.Errorf("occurrence %d: expected %s, got %s", i, want[i], got[i].Format(time.RFC3339))
+        }
+    }
+}
+
+func TestCron(t *testing.T) {
+    t.Run("Weekday mornings", func(t *testing.T) {
+        sched := mustParse(t, "30 9 * * MON-FRI", "")
+        //пятница 2026-10-16
+        after := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+        assertTimes(t, occurrences(sched, time.Time{}, after, 3),
+            "2026-10-19T09:30:00Z", "2026-10-20T09:30:00Z", "2026-10-21T09:30:00Z")
+    })
+
+    t.Run("Steps, lists and macros", func(t *testing.T) {
+        after := time.Date(2026, 1, 1, 0, 7, 0, 0, time.UTC)
+        assertTimes(t, occurrences(mustParse(t, "*/15 0 * * *", ""), time.Time{}, after, 3),
+            "2026-01-01T00:15:00Z", "2026-01-01T00:30:00Z", "2026-01-01T00:45:00Z")
+        assertTimes(t, occurrences(mustParse(t, "0 8,20 1 jan,jul *", ""), time.Time{}, after, 3),
+            "2026-01-01T08:00:00Z", "2026-01-01T20:00:00Z", "2026-07-01T08:00:00Z")
+        assertTimes(t, occurrences(mustParse(t, "@weekly", ""), time.Time{}, after, 1),
+            "2026-01-04T00:00:00Z")
+    })
+
+    t.Run("Day of month or day of week", func(t *testing.T) {
+        //как в cron: 13-е число или любая пятница
+        sched := mustParse(t, "0 12 13 * 5", "")
+        after := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+        assertTimes(t, occurrences(sched, time.Time{}, after, 3),
+            "2026-02-06T12:00:00Z", "2026-02-13T12:00:00Z", "2026-02-20T12:00:00Z")
+    })
+
+    t.Run("Evaluates in timezone and skips DST gap", func(t *testing.T) {
+        loc := mustLoad(t, "Europe/Berlin")
+        sched := mustParse(t, "30 2 * * *", "Europe/Berlin")
+        //в ночь на 29 марта 2026 в Берлине 02:30 не существует
+        after := time.Date(2026, 3, 27, 12, 0, 0, 0, loc)
+        got := occurrences(sched, time.Time{}, after, 3)
+        assertTimes(t, got, "2026-03-28T02:30:00+01:00", "2026-03-30T02:30:00+02:00", "2026-03-31T02:30:00+02:00")
+    })
+
+    t.Run("Fires once on repeated DST hour", func(t *testing.T) {
+        mustLoad(t, "America/New_York")
+        sched := mustParse(t, "30 1 * * *", "America/New_York")
+        after := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+        got := occurrences(sched, time.Time{}, after, 2)
+        if len(got) != 2 || got[0].Day() != 1 || got[1].Day() != 2 {
+            t.Errorf("expected one occurrence on Nov 1 and the next on Nov 2, got %v", got)
+        }
+    })
+
+    t.Run("Impossible date has no occurrences", func(t *testing.T) {
+        if _, ok := mustParse(t, "0 0 30 2 *", "").Next(time.Time{}, time.Now()); ok {
+            t.Error("expected February 30 to never occur")
+        }
+    })
+}
+
+func TestRRule(t *testing.T) {
+    start := time.Date(2026, 10, 5, 9, 0, 0, 0, time.UTC) //понедельник
+
+    t.Run("Weekly with interval and days", func(t *testing.T) {
+        sched := mustParse(t, "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "")
+        assertTimes(t, occurrences(sched, start, start.Add(-time.Minute), 4),
+            "2026-10-05T09:00:00Z", "2026-10-08T09:00:00Z", "2026-10-19T09:00:00Z", "2026-10-22T09:00:00Z")
+    })
+
+    t.Run("Monthly last Friday and negative month day", func(t *testing.T) {
+        assertTimes(t, occurrences(mustParse(t, "FREQ=MONTHLY;BYDAY=-1FR;BYHOUR=17;BYMINUTE=0", ""), start, start, 3),
+            "2026-10-30T17:00:00Z", "2026-11-27T17:00:00Z", "2026-12-25T17:00:00Z")
+        assertTimes(t, occurrences(mustParse(t, "FREQ=MONTHLY;BYMONTHDAY=-1", ""), start, start, 3),
+            "2026-10-31T09:00:00Z", "2026-11-30T09:00:00Z", "2026-12-31T09:00:00Z")
+    })
+
+    t.Run("Skips months without the start day", func(t *testing.T) {
+        jan31 := time.Date(2027, 1, 31, 8, 0, 0, 0, time.UTC)
+        sched := mustParse(t, "FREQ=MONTHLY", "")
+        assertTimes(t, occurrences(sched, jan31, jan31, 2), "2027-03-31T08:00:00Z", "2027-05-31T08:00:00Z")
+    })
+
+    t.Run("COUNT and UNTIL end the series", func(t *testing.T) {
+        got := occurrences(mustParse(t, "FREQ=DAILY;COUNT=3", ""), start, start.Add(-time.Minute), 10)
+        assertTimes(t, got, "2026-10-05T09:00:00Z", "2026-10-06T09:00:00Z", "2026-10-07T09:00:00Z")
+
+        got = occurrences(mustParse(t, "FREQ=DAILY;UNTIL=20261007", ""), start, start, 10)
+        assertTimes(t, got, "2026-10-06T09:00:00Z", "2026-10-07T09:00:00Z")
+    })
+
+    t.Run("Jumps to far future without replaying the series", func(t *testing.T) {
+        sched := mustParse(t, "FREQ=DAILY;INTERVAL=3", "")
+        after := time.Date(2036, 10, 5, 12, 0, 0, 0, time.UTC)
+        next, ok := sched.Next(start, after)
+        //3653 дня от начала серии, ближайшее кратное трем - 3654
+        if !ok || !next.Equal(start.AddDate(0, 0, 3654)) {
+            t.Errorf("expected %s, got %s (%v)", start.AddDate(0, 0, 3654), next, ok)
+        }
+    })
+
+    t.Run("Keeps local wall time across DST", func(t *testing.T) {
+        loc := mustLoad(t, "Europe/Berlin")
+        localStart := time.Date(2026, 10, 23, 7, 0, 0, 0, loc)
+        sched := mustParse(t, "FREQ=DAILY", "Europe/Berlin")
+        got := occurrences(sched, localStart, localStart, 3)
+        assertTimes(t, got, "2026-10-24T07:00:00+02:00", "2026-10-25T07:00:00+01:00", "2026-10-26T07:00:00+01:00")
+    })
+}
+
+func TestParseErrors(t *testing.T) {
+    for _, tc := range []struct {
+        rule     string
+        timezone string
+    }{
+        {"", ""},
+        {"* * * *", ""},
+        {"60 * * * *", ""},
+        {"0 0 * * MON-SUNDAY", ""},
+        {"*/0 * * * *", ""},
+        {"FREQ=HOURLY", ""},
+        {"INTERVAL=2", ""},
+        {"FREQ=DAILY;COUNT=2;UNTIL=20261231", ""},
+        {"FREQ=WEEKLY;BYDAY=1MO", ""},
+        {"FREQ=DAILY;BYSETPOS=1", ""},
+        {"FREQ=DAILY;FREQ=WEEKLY", ""},
+        {"0 9 * * *", "Mars/Olympus"},
+        {"0 9 * * *", "Local"},
+    } {
+        if _, err := Parse(tc.rule, tc.timezone); err == nil {
+            t.Errorf("expected Parse(%q, %q) to fail", tc.rule, tc.timezone)
+        }
+    }
+}
@@ -0,0 +1,418 @@
+package recurrence
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+//maxPeriods - сколько периодов подряд можно перебрать в поисках вхождения
+const maxPeriods = 10000
+
+type frequency int
+
+const (
+    daily frequency = iota
+    weekly
+    monthly
+    yearly
+)
+
+var frequencies = map[string]frequency{
+    "DAILY":   daily,
+    "WEEKLY":  weekly,
+    "MONTHLY": monthly,
+    "YEARLY":  yearly,
+}
+
+var weekdayCodes = map[string]time.Weekday{
+    "SU": time.Sunday,
+    "MO": time.Monday,
+    "TU": time.Tuesday,
+    "WE": time.Wednesday,
+    "TH": time.Thursday,
+    "FR": time.Friday,
+    "SA": time.Saturday,
+}
+
+//byDay - элемент BYDAY: день недели и необязательный номер в месяце,
+//1MO - первый понедельник, -1FR - последняя пятница
+type byDay struct {
+    weekday time.Weekday
+    ordinal int
+}
+
+//rrule - подмножество RFC 5545: FREQ=DAILY|WEEKLY|MONTHLY|YEARLY, INTERVAL,
+//COUNT, UNTIL, BYMONTH, BYMONTHDAY, BYDAY, BYHOUR, BYMINUTE и WKST.
+//Начало серии играет роль DTSTART: от него берутся время, день и месяц,
+//если они не заданы правилом.
+type rrule struct {
+    freq      frequency
+    interval  int
+    count     int
+    until     *time.Time
+    months    []int
+    monthDays []int
+    days      []byDay
+    hours     []int
+    minutes   []int
+    weekStart time.Weekday
+    loc       *time.Location
+}
+
+func parseRRule(expr string, loc *time.Location) (*rrule, error) {
+    r := &rrule{interval: 1, weekStart: time.Monday, loc: loc}
+    seen := map[string]bool{}
+    hasFreq := false
+    var untilExpr string
+
+    for _, part := range strings.Split(strings.TrimSuffix(expr, ";"), ";") {
+        key, value, ok := strings.Cut(part, "=")
+        if !ok || value == "" {
+            return nil, fmt.Errorf("invalid RRULE part %q, expected KEY=VALUE", part)
+        }
+        if seen[key] {
+            return nil, fmt.Errorf("RRULE part %s is repeated", key)
+        }
+        seen[key] = true
+
+        var err error
+        switch key {
+        case "FREQ":
+            freq, known := frequencies[value]
+            if !known {
+                return nil, fmt.Errorf("unsupported FREQ %q, expected DAILY, WEEKLY, MONTHLY or YEARLY", value)
+            }
+            r.freq, hasFreq = freq, true
+        case "INTERVAL":
+            r.interval, err = positive(key, value)
+        case "COUNT":
+            r.count, err = positive(key, value)
+        case "UNTIL":
+            untilExpr = value
+        case "BYMONTH":
+            r.months, err = intList(key, value, 1, 12, false)
+        case "BYMONTHDAY":
+            r.monthDays, err = intList(key, value, 1, 31, true)
+        case "BYHOUR":
+            r.hours, err = intList(key, value, 0, 23, false)
+        case "BYMINUTE":
+            r.minutes, err = intList(key, value, 0, 59, false)
+        case "BYDAY":
+            r.days, err = parseByDay(value)
+        case "WKST":
+            weekday, known := weekdayCodes[value]
+            if !known {
+                return nil, fmt.Errorf("invalid WKST %q", value)
+            }
+            r.weekStart = weekday
+        default:
+            return nil, fmt.Errorf("unsupported RRULE part %s", key)
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if !hasFreq {
+        return nil, errors.New("RRULE must contain FREQ")
+    }
+    if r.count > 0 && untilExpr != "" {
+        return nil, errors.New("RRULE cannot contain both COUNT and UNTIL")
+    }
+    if untilExpr != "" {
+        until, err := parseUntil(untilExpr, loc)
+        if err != nil {
+            return nil, err
+        }
+        r.until = &until
+    }
+
+    //номер дня недели имеет смысл только внутри месяца
+    ordinals := r.freq == monthly || r.freq == yearly && len(r.months) > 0
+    for _, day := range r.days {
+        if day.ordinal != 0 && !ordinals {
+            return nil, errors.New("numbered BYDAY like 1MO needs FREQ=MONTHLY or FREQ=YEARLY with BYMONTH")
+        }
+    }
+    if r.freq == weekly && len(r.monthDays) > 0 {
+        return nil, errors.New("BYMONTHDAY is not supported with FREQ=WEEKLY")
+    }
+    return r, nil
+}
+
+func positive(key, value string) (int, error) {
+    n, err := strconv.Atoi(value)
+    if err != nil || n <= 0 {
+        return 0, fmt.Errorf("%s must be a positive integer", key)
+    }
+    return n, nil
+}
+
+//intList разбирает список чисел, negative разрешает отсчет с конца (-1 - последний день)
+func intList(key, value string, min, max int, negative bool) ([]int, error) {
+    var values []int
+    for _, item := range strings.Split(value, ",") {
+        n, err := strconv.Atoi(item)
+        valid := err == nil && (n >= min && n <= max || negative && n <= -min && n >= -max)
+        if !valid {
+            return nil, fmt.Errorf("invalid %s value %q", key, item)
+        }
+        values = append(values, n)
+    }
+    sort.Ints(values)
+    return values, nil
+}
+
+func parseByDay(value string) ([]byDay, error) {
+    var days []byDay
+    for _, item := range strings.Split(value, ",") {
+        if len(item) < 2 {
+            return nil, fmt.Errorf("invalid BYDAY value %q", item)
+        }
+        code := item[len(item)-2:]
+        weekday, known := weekdayCodes[code]
+        if !known {
+            return nil, fmt.Errorf("invalid BYDAY value %q", item)
+        }
+
+        day := byDay{weekday: weekday}
+        if prefix := item[:len(item)-2]; prefix != "" {
+            n, err := strconv.Atoi(prefix)
+            if err != nil || n == 0 || n < -5 || n > 5 {
+                return nil, fmt.Errorf("invalid BYDAY value %q", item)
+            }
+            day.ordinal = n
+        }
+        days = append(days, day)
+    }
+    return days, nil
+}
+
+//parseUntil принимает дату-время в UTC (20261231T235959Z), местное время
+//правила (20261231T235959) или дату - тогда включается весь день
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+    if t, err := time.Parse("20060102T150405Z", value); err == nil {
+        return t, nil
+    }
+    if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+        return t, nil
+    }
+    if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+        return t.AddDate(0, 0, 1).Add(-time.Second), nil
+    }
+    return time.Time{}, fmt.Errorf("invalid UNTIL %q, expected YYYYMMDD or YYYYMMDDTHHMMSSZ", value)
+}
+
+func (r *rrule) Next(start, after time.Time) (time.Time, bool) {
+    start = start.In(r.loc).Truncate(time.Minute)
+    first := 0
+    //без COUNT вхождения до after считать не нужно, сразу прыгаем к нему
+    if r.count == 0 && after.After(start) {
+        first = r.periodsBetween(start, after.In(r.loc))/r.interval - 1
+        if first < 0 {
+            first = 0
+        }
+    }
+
+    seen := 0
+    for k := first; k < first+maxPeriods; k++ {
+        for _, t := range r.expand(start, k*r.interval) {
+            if t.Before(start) {
+                continue
+            }
+            seen++
+            if r.count > 0 && seen > r.count || r.until != nil && t.After(*r.until) {
+                return time.Time{}, false
+            }
+            if t.After(after) {
+                return t, true
+            }
+        }
+    }
+    return time.Time{}, false
+}
+
+//periodsBetween - сколько целых периодов частоты прошло от start до t
+func (r *rrule) periodsBetween(start, t time.Time) int {
+    from, to := civilOf(start), civilOf(t)
+    switch r.freq {
+    case daily, weekly:
+        days := int(time.Date(to.year, to.month, to.day, 12, 0, 0, 0, time.UTC).
+            Sub(time.Date(from.year, from.month, from.day, 12, 0, 0, 0, time.UTC)).Hours() / 24)
+        if r.freq == weekly {
+            return days / 7
+        }
+        return days
+    case monthly:
+        return (to.year-from.year)*12 + int(to.month) - int(from.month)
+    }
+    return to.year - from.year
+}
+
+//expand возвращает отсортированные вхождения периода с номером offset от начала серии
+func (r *rrule) expand(start time.Time, offset int) []time.Time {
+    base := civilOf(start)
+    var days []civil
+
+    switch r.freq {
+    case daily:
+        day := base.addDays(offset)
+        if r.matchesFilters(day) {
+            days = append(days, day)
+        }
+    case weekly:
+        shift := (int(base.weekday()) - int(r.weekStart) + 7) % 7
+        weekStart := base.addDays(offset*7 - shift)
+        for i := 0; i < 7; i++ {
+            day := weekStart.addDays(i)
+            if r.matchesWeekday(day, start.Weekday()) && r.matchesMonth(day) {
+                days = append(days, day)
+            }
+        }
+    case monthly:
+        month := time.Date(base.year, base.month+time.Month(offset), 1, 12, 0, 0, 0, time.UTC)
+        if r.matchesMonth(civilOf(month)) {
+            days = r.monthDaysOf(month.Year(), month.Month(), base.day)
+        }
+    case yearly:
+        year := base.year + offset
+        months := r.months
+        if len(months) == 0 {
+            months = []int{int(base.month)}
+            if len(r.monthDays) > 0 || len(r.days) > 0 {
+                months = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+            }
+        }
+        for _, month := range months {
+            days = append(days, r.monthDaysOf(year, time.Month(month), base.day)...)
+        }
+    }
+
+    hours, minutes := r.hours, r.minutes
+    if len(hours) == 0 {
+        hours = []int{start.Hour()}
+    }
+    if len(minutes) == 0 {
+        minutes = []int{start.Minute()}
+    }
+
+    var occurrences []time.Time
+    for _, day := range days {
+        for _, hour := range hours {
+            for _, minute := range minutes {
+                if t, ok := day.at(hour, minute, r.loc); ok {
+                    occurrences = append(occurrences, t)
+                }
+            }
+        }
+    }
+    return occurrences
+}
+
+//monthDaysOf - дни месяца по BYMONTHDAY и BYDAY. Без них - день начала
+//серии; месяцы, где такого дня нет, пропускаются, как требует RFC 5545.
+func (r *rrule) monthDaysOf(year int, month time.Month, startDay int) []civil {
+    last := daysIn(year, month)
+    var matched []int
+
+    switch {
+    case len(r.monthDays) > 0:
+        for _, d := range r.monthDays {
+            if d < 0 {
+                d = last + d + 1
+            }
+            if d >= 1 && d <= last && (len(r.days) == 0 || r.matchesByDay(year, month, d)) {
+                matched = append(matched, d)
+            }
+        }
+    case len(r.days) > 0:
+        for d := 1; d <= last; d++ {
+            if r.matchesByDay(year, month, d) {
+                matched = append(matched, d)
+            }
+        }
+    case startDay <= last:
+        matched = append(matched, startDay)
+    }
+
+    sort.Ints(matched)
+    days := make([]civil, 0, len(matched))
+    for i, d := range matched {
+        if i > 0 && matched[i-1] == d {
+            continue
+        }
+        days = append(days, civil{year: year, month: month, day: d})
+    }
+    return days
+}
+
+//matchesByDay проверяет день месяца по BYDAY с учетом номеров вроде -1FR
+func (r *rrule) matchesByDay(year int, month time.Month, d int) bool {
+    day := civil{year: year, month: month, day: d}
+    weekday := day.weekday()
+    for _, by := range r.days {
+        if by.weekday != weekday {
+            continue
+        }
+        if by.ordinal == 0 {
+            return true
+        }
+        if by.ordinal > 0 && (d-1)/7+1 == by.ordinal {
+            return true
+        }
+        if by.ordinal < 0 && (daysIn(year, month)-d)/7+1 == -by.ordinal {
+            return true
+        }
+    }
+    return false
+}
+
+func (r *rrule) matchesFilters(day civil) bool {
+    if !r.matchesMonth(day) {
+        return false
+    }
+    if len(r.monthDays) > 0 {
+        last := daysIn(day.year, day.month)
+        found := false
+        for _, d := range r.monthDays {
+            if d == day.day || d < 0 && last+d+1 == day.day {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+    return len(r.days) == 0 || r.matchesWeekday(day, day.weekday())
+}
+
+//matchesWeekday сверяет день с BYDAY, без BYDAY подходит только fallback
+func (r *rrule) matchesWeekday(day civil, fallback time.Weekday) bool {
+    weekday := day.weekday()
+    if len(r.days) == 0 {
+        return weekday == fallback
+    }
+    for _, by := range r.days {
+        if by.weekday == weekday {
+            return true
+        }
+    }
+    return false
+}
+
+func (r *rrule) matchesMonth(day civil) bool {
+    if len(r.months) == 0 {
+        return true
+    }
+    for _, m := range r.months {
+        if m == int(day.month) {
+            return true
+        }
+    }
+    return false
+}
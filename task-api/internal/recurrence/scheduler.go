@@ -0,0 +1,87 @@
+package recurrence
+
+import (
+    "context"
+    "log/slog"
+    "sync"
+    "task-api/internal/models"
+    "time"
+)
+
+const DefaultInterval = 30 * time.Second
+
+//Advancer - часть хранилища, которая нужна планировщику
+type Advancer interface {
+    AdvanceRecurring(ctx context.Context, now time.Time) []models.Task
+}
+
+//Scheduler раз в interval создает вхождения серий, чье время наступило.
+//Закрытие вхождения создает следующее сразу, в хранилище, поэтому
+//планировщику остаются только серии, которые никто не закрыл.
+type Scheduler struct {
+    store    Advancer
+    interval time.Duration
+    now      func() time.Time
+    logger   *slog.Logger
+
+    stop     chan struct{}
+    done     chan struct{}
+    stopOnce sync.Once
+}
+
+func NewScheduler(store Advancer, interval time.Duration, logger *slog.Logger) *Scheduler {
+    if interval <= 0 {
+        interval = DefaultInterval
+    }
+    if logger == nil {
+        logger = slog.Default()
+    }
+    return &Scheduler{
+        store:    store,
+        interval: interval,
+        now:      time.Now,
+        logger:   logger,
+        stop:     make(chan struct{}),
+        done:     make(chan struct{}),
+    }
+}
+
+//Start запускает фоновую горутину, первый проход - сразу, чтобы догнать
+//серии, пропущенные пока сервис стоял
+func (s *Scheduler) Start() {
+    go s.run()
+}
+
+func (s *Scheduler) run() {
+    defer close(s.done)
+
+    ticker := time.NewTicker(s.interval)
+    defer ticker.Stop()
+
+    for {
+        s.Tick()
+        select {
+        case <-s.stop:
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+//Tick создает наступившие вхождения и возвращает их. Изменения идут от
+//имени сервиса, в аудите автором будет "scheduler".
+func (s *Scheduler) Tick() []models.Task {
+    ctx := models.WithActor(context.Background(), models.Actor{Name: "scheduler"})
+    created := s.store.AdvanceRecurring(ctx, s.now())
+    for _, task := range created {
+        s.logger.Info("recurring task materialized",
+            "task_id", task.ID, "series_id", task.Recurrence.SeriesID, "due_at", task.DueAt)
+    }
+    return created
+}
+
+//Stop останавливает горутину и ждет текущий проход
+func (s *Scheduler) Stop() {
+    s.stopOnce.Do(func() { close(s.stop) })
+    <-s.done
+}
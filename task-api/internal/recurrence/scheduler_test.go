@@ -0,0 +1,73 @@
+package recurrence
+
+import (
+    "context"
+    "sync"
+    "testing"
+    "time"
+
+    "task-api/internal/models"
+)
+
+type fakeStore struct {
+    mu     sync.Mutex
+    calls  []time.Time
+    actors []models.Actor
+}
+
+func (f *fakeStore) AdvanceRecurring(ctx context.Context, now time.Time) []models.Task {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    f.calls = append(f.calls, now)
+    f.actors = append(f.actors, models.ActorFromContext(ctx))
+    return []models.Task{{ID: len(f.calls), Recurrence: &models.Recurrence{SeriesID: 1}}}
+}
+
+func (f *fakeStore) callCount() int {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return len(f.calls)
+}
+
+func TestScheduler(t *testing.T) {
+    t.Run("Tick uses injected clock and scheduler actor", func(t *testing.T) {
+        store := &fakeStore{}
+        s := NewScheduler(store, time.Minute, nil)
+        clock := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+        s.now = func() time.Time { return clock }
+
+        s.Tick()
+        clock = clock.Add(time.Hour)
+        created := s.Tick()
+
+        if len(store.calls) != 2 || !store.calls[1].Equal(clock) {
+            t.Fatalf("expected ticks at the injected time, got %v", store.calls)
+        }
+        if store.actors[0].Name != "scheduler" {
+            t.Errorf("expected scheduler actor, got %+v", store.actors[0])
+        }
+        if len(created) != 1 || created[0].ID != 2 {
+            t.Errorf("expected created tasks to be returned, got %+v", created)
+        }
+    })
+
+    t.Run("Runs immediately and stops", func(t *testing.T) {
+        store := &fakeStore{}
+        s := NewScheduler(store, time.Hour, nil)
+        s.Start()
+
+        deadline := time.Now().Add(2 * time.Second)
+        for store.callCount() == 0 {
+            if time.Now().After(deadline) {
+                t.Fatal("expected first pass right after start")
+            }
+            time.Sleep(5 * time.Millisecond)
+        }
+        s.Stop()
+        s.Stop()
+        if calls := store.callCount(); calls != 1 {
+            t.Errorf("expected a single pass before the hourly tick, got %d", calls)
+        }
+    })
+}
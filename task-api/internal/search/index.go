@@ -0,0 +1,342 @@
+package search
+
+import (
+    "math"
+    "slices"
+    "sort"
+    "strings"
+    "task-api/internal/models"
+)
+
+//параметры BM25
+const (
+    k1 = 1.2
+    b  = 0.75
+)
+
+//maxPrefixTerms ограничивает раскрытие префикса, "ab*" не должен тянуть весь словарь
+const maxPrefixTerms = 100
+
+type field int
+
+const (
+    fieldTitle field = iota
+    fieldDescription
+    fieldTags
+    numFields
+)
+
+var fieldNames = [numFields]string{"title", "description", "tags"}
+
+//fieldWeights - вклад поля в BM25F: совпадение в названии весит больше
+var fieldWeights = [numFields]float64{2.5, 1, 1.5}
+
+type document struct {
+    id     int
+    text   [numFields]string
+    tokens [numFields][]token
+    //length - взвешенная длина документа
+    length float64
+}
+
+type posting struct {
+    freq      [numFields]int
+    positions [numFields][]int
+}
+
+//shard - индекс задач одного владельца. Статистика BM25 считается по
+//шарду, поэтому чужие задачи не влияют на ранжирование и не просвечивают в нем.
+type shard struct {
+    docs        map[int]*document
+    postings    map[string]map[int]*posting
+    totalLength float64
+}
+
+//Index - инвертированный индекс по названию, описанию и тегам задач.
+//Сам не блокируется: TaskStore пишет в него под своей блокировкой на запись
+//и ищет под блокировкой на чтение, а Search индекс не меняет.
+type Index struct {
+    shards map[int]*shard
+}
+
+func NewIndex() *Index {
+    return &Index{shards: make(map[int]*shard)}
+}
+
+//Hit - найденная задача и ее оценка
+type Hit struct {
+    ID    int
+    Score float64
+}
+
+//Put индексирует задачу заново, если изменились проиндексированные поля
+func (ix *Index) Put(task models.Task) {
+    text := [numFields]string{task.Title, task.Description, strings.Join(task.Tags, " ")}
+
+    sh := ix.shards[task.UserID]
+    if sh == nil {
+        sh = &shard{docs: make(map[int]*document), postings: make(map[string]map[int]*posting)}
+        ix.shards[task.UserID] = sh
+    }
+    if old, exists := sh.docs[task.ID]; exists {
+        if old.text == text {
+            return
+        }
+        sh.remove(old)
+    }
+
+    doc := &document{id: task.ID, text: text}
+    for f := field(0); f < numFields; f++ {
+        doc.tokens[f] = tokenize(text[f])
+        doc.length += fieldWeights[f] * float64(len(doc.tokens[f]))
+        for pos, tok := range doc.tokens[f] {
+            docs := sh.postings[tok.term]
+            if docs == nil {
+                docs = make(map[int]*posting)
+                sh.postings[tok.term] = docs
+            }
+            p := docs[doc.id]
+            if p == nil {
+                p = &posting{}
+                docs[doc.id] = p
+            }
+            p.freq[f]++
+            p.positions[f] = append(p.positions[f], pos)
+        }
+    }
+    sh.docs[doc.id] = doc
+    sh.totalLength += doc.length
+}
+
+//Remove убирает задачу из индекса
+func (ix *Index) Remove(ownerID, id int) {
+    sh := ix.shards[ownerID]
+    if sh == nil {
+        return
+    }
+    if doc, exists := sh.docs[id]; exists {
+        sh.remove(doc)
+    }
+    if len(sh.docs) == 0 {
+        delete(ix.shards, ownerID)
+    }
+}
+
+func (sh *shard) remove(doc *document) {
+    for f := field(0); f < numFields; f++ {
+        for _, tok := range doc.tokens[f] {
+            docs := sh.postings[tok.term]
+            delete(docs, doc.id)
+            if len(docs) == 0 {
+                delete(sh.postings, tok.term)
+            }
+        }
+    }
+    delete(sh.docs, doc.id)
+    sh.totalLength -= doc.length
+}
+
+//Search находит задачи владельца по запросу и сортирует по убыванию оценки,
+//при равенстве - по ID
+func (ix *Index) Search(ownerID int, q *Query) []Hit {
+    sh := ix.shards[ownerID]
+    if sh == nil {
+        return nil
+    }
+
+    matched := sh.eval(q.root)
+    terms := sh.positiveTerms(q.root, nil)
+
+    hits := make([]Hit, 0, len(matched))
+    for id := range matched {
+        hits = append(hits, Hit{ID: id, Score: sh.score(sh.docs[id], terms)})
+    }
+    sort.Slice(hits, func(i, j int) bool {
+        if hits[i].Score != hits[j].Score {
+            return hits[i].Score > hits[j].Score
+        }
+        return hits[i].ID < hits[j].ID
+    })
+    return hits
+}
+
+//Snippets подсвечивает в задаче слова запроса. Считается только для
+//отдаваемой страницы, а не для всех совпадений.
+func (ix *Index) Snippets(ownerID, id int, q *Query) map[string]string {
+    sh := ix.shards[ownerID]
+    if sh == nil || sh.docs[id] == nil {
+        return map[string]string{}
+    }
+    return snippets(sh.docs[id], sh.positiveTerms(q.root, nil))
+}
+
+type docSet map[int]bool
+
+func (sh *shard) eval(n node) docSet {
+    switch n := n.(type) {
+    case termNode:
+        result := docSet{}
+        for _, term := range sh.expand(n) {
+            for id := range sh.postings[term] {
+                result[id] = true
+            }
+        }
+        return result
+
+    case phraseNode:
+        return sh.phrase(n.terms)
+
+    case notNode:
+        return sh.complement(sh.eval(n.child))
+
+    case orNode:
+        result := docSet{}
+        for _, child := range n.children {
+            for id := range sh.eval(child) {
+                result[id] = true
+            }
+        }
+        return result
+
+    case andNode:
+        //отрицания вычитаются из пересечения остальных операндов
+        var result docSet
+        var excluded []docSet
+        for _, child := range n.children {
+            if not, ok := child.(notNode); ok {
+                excluded = append(excluded, sh.eval(not.child))
+                continue
+            }
+            set := sh.eval(child)
+            if result == nil {
+                result = set
+                continue
+            }
+            for id := range result {
+                if !set[id] {
+                    delete(result, id)
+                }
+            }
+        }
+        if result == nil {
+            result = sh.complement(docSet{})
+        }
+        for _, set := range excluded {
+            for id := range set {
+                delete(result, id)
+            }
+        }
+        return result
+    }
+    return docSet{}
+}
+
+func (sh *shard) complement(set docSet) docSet {
+    result := docSet{}
+    for id := range sh.docs {
+        if !set[id] {
+            result[id] = true
+        }
+    }
+    return result
+}
+
+//expand раскрывает префикс в термы словаря в алфавитном порядке
+func (sh *shard) expand(n termNode) []string {
+    if !n.prefix {
+        return []string{n.term}
+    }
+    var terms []string
+    for term := range sh.postings {
+        if strings.HasPrefix(term, n.term) {
+            terms = append(terms, term)
+        }
+    }
+    sort.Strings(terms)
+    if len(terms) > maxPrefixTerms {
+        terms = terms[:maxPrefixTerms]
+    }
+    return terms
+}
+
+//phrase ищет термы подряд внутри одного поля
+func (sh *shard) phrase(terms []string) docSet {
+    result := docSet{}
+    for id, first := range sh.postings[terms[0]] {
+        for f := field(0); f < numFields; f++ {
+            if sh.phraseIn(id, f, first.positions[f], terms[1:]) {
+                result[id] = true
+                break
+            }
+        }
+    }
+    return result
+}
+
+func (sh *shard) phraseIn(id int, f field, starts []int, rest []string) bool {
+    for _, start := range starts {
+        found := true
+        for offset, term := range rest {
+            p := sh.postings[term][id]
+            if p == nil || !slices.Contains(p.positions[f], start+offset+1) {
+                found = false
+                break
+            }
+        }
+        if found {
+            return true
+        }
+    }
+    return false
+}
+
+//positiveTerms - термы вне NOT, по ним считается оценка и подсветка
+func (sh *shard) positiveTerms(n node, terms []string) []string {
+    switch n := n.(type) {
+    case termNode:
+        terms = append(terms, sh.expand(n)...)
+    case phraseNode:
+        terms = append(terms, n.terms...)
+    case andNode:
+        for _, child := range n.children {
+            terms = sh.positiveTerms(child, terms)
+        }
+    case orNode:
+        for _, child := range n.children {
+            terms = sh.positiveTerms(child, terms)
+        }
+    }
+    return terms
+}
+
+//score - BM25F: частоты полей складываются с весами, длина документа тоже взвешенная
+func (sh *shard) score(doc *document, terms []string) float64 {
+    n := float64(len(sh.docs))
+    avgLength := sh.totalLength / n
+    if avgLength == 0 {
+        avgLength = 1
+    }
+
+    score := 0.0
+    seen := map[string]bool{}
+    for _, term := range terms {
+        if seen[term] {
+            continue
+        }
+        seen[term] = true
+
+        docs := sh.postings[term]
+        p := docs[doc.id]
+        if p == nil {
+            continue
+        }
+        tf := 0.0
+        for f := field(0); f < numFields; f++ {
+            tf += fieldWeights[f] * float64(p.freq[f])
+        }
+        df := float64(len(docs))
+        idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+        score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*doc.length/avgLength))
+    }
+    return score
+}
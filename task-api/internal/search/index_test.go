@@ -0,0 +1,141 @@
+package search
+
+import (
+    "strings"
+    "testing"
+
+    "task-api/internal/models"
+)
+
+func testIndex() *Index {
+    ix := NewIndex()
+    for _, task := range []models.Task{
+        {ID: 1, UserID: 1, Title: "Buy milk", Description: "Oat milk from the corner shop", Tags: []string{"shopping"}},
+        {ID: 2, UserID: 1, Title: "Write report", Description: "Quarterly report for the milk supplier"},
+        {ID: 3, UserID: 1, Title: "Milkshake party", Tags: []string{"fun"}},
+        {ID: 4, UserID: 1, Title: "Купить ёлку", Description: "Большую ель к Новому году"},
+        {ID: 5, UserID: 2, Title: "Buy milk", Description: "someone else's milk"},
+    } {
+        ix.Put(task)
+    }
+    return ix
+}
+
+func ids(t *testing.T, ix *Index, ownerID int, q string) []int {
+    t.Helper()
+    query, err := Parse(q)
+    if err != nil {
+        t.Fatalf("Parse(%q): %v", q, err)
+    }
+    var result []int
+    for _, hit := range ix.Search(ownerID, query) {
+        result = append(result, hit.ID)
+    }
+    return result
+}
+
+func assertIDs(t *testing.T, got []int, want ...int) {
+    t.Helper()
+    if len(got) != len(want) {
+        t.Fatalf("expected %v, got %v", want, got)
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Fatalf("expected %v, got %v", want, got)
+        }
+    }
+}
+
+func TestSearch(t *testing.T) {
+    ix := testIndex()
+
+    t.Run("Ranks title matches first", func(t *testing.T) {
+        assertIDs(t, ids(t, ix, 1, "milk"), 1, 2)
+    })
+
+    t.Run("Boolean operators", func(t *testing.T) {
+        assertIDs(t, ids(t, ix, 1, "milk AND report"), 2)
+        assertIDs(t, ids(t, ix, 1, "milk -report"), 1)
+        //короткое название весит больше двух совпадений в длинной задаче
+        assertIDs(t, ids(t, ix, 1, "report OR party"), 3, 2)
+        assertIDs(t, ids(t, ix, 1, "(buy OR write) NOT shopping"), 2)
+        assertIDs(t, ids(t, ix, 1, "NOT milk*"), 4)
+    })
+
+    t.Run("Prefix and phrase", func(t *testing.T) {
+        got := ids(t, ix, 1, "milk*")
+        if len(got) != 3 {
+            t.Errorf("expected prefix to match milk and milkshake, got %v", got)
+        }
+        assertIDs(t, ids(t, ix, 1, `"oat milk"`), 1)
+        //название кончается на milk, описание начинается с oat, но фраза не склеивается через границу полей
+        assertIDs(t, ids(t, ix, 1, `"milk oat"`))
+    })
+
+    t.Run("Unicode and yo folding", func(t *testing.T) {
+        assertIDs(t, ids(t, ix, 1, "елку"), 4)
+        assertIDs(t, ids(t, ix, 1, "НОВОМУ"), 4)
+    })
+
+    t.Run("Owners are isolated", func(t *testing.T) {
+        assertIDs(t, ids(t, ix, 2, "milk"), 5)
+        assertIDs(t, ids(t, ix, 3, "milk"))
+    })
+
+    t.Run("Reindexes and removes tasks", func(t *testing.T) {
+        ix := testIndex()
+        ix.Put(models.Task{ID: 2, UserID: 1, Title: "Write summary"})
+        assertIDs(t, ids(t, ix, 1, "report"))
+        assertIDs(t, ids(t, ix, 1, "summary"), 2)
+
+        ix.Remove(1, 1)
+        assertIDs(t, ids(t, ix, 1, "milk"))
+    })
+}
+
+func TestSnippets(t *testing.T) {
+    ix := testIndex()
+    ix.Put(models.Task{
+        ID:          6,
+        UserID:      1,
+        Title:       "Fix <script> bug",
+        Description: strings.Repeat("filler words here ", 20) + "the actual bug is in the parser " + strings.Repeat("more filler ", 20),
+    })
+
+    query, _ := Parse("bug")
+    snippets := ix.Snippets(1, 6, query)
+    if snippets["title"] != "Fix &lt;script&gt; <mark>bug</mark>" {
+        t.Errorf("unexpected title snippet %q", snippets["title"])
+    }
+    description := snippets["description"]
+    if !strings.HasPrefix(description, "…") || !strings.HasSuffix(description, "…") ||
+        !strings.Contains(description, "actual <mark>bug</mark> is") {
+        t.Errorf("unexpected description snippet %q", description)
+    }
+
+    query, _ = Parse("milk -shop")
+    if got := ix.Snippets(1, 2, query); got["description"] != "Quarterly report for the <mark>milk</mark> supplier" {
+        t.Errorf("expected only positive terms to be highlighted, got %v", got)
+    }
+}
+
+func TestParseErrors(t *testing.T) {
+    for _, q := range []string{
+        "",
+        "   ",
+        "milk AND",
+        "OR milk",
+        "milk OR OR tea",
+        "NOT",
+        "(milk",
+        "milk)",
+        `"oat milk`,
+        "m*",
+        "!!!",
+        strings.Repeat("word ", 40),
+    } {
+        if _, err := Parse(q); err == nil {
+            t.Errorf("expected Parse(%q) to fail", q)
+        }
+    }
+}
@@ -0,0 +1,301 @@
+package search
+
+import (
+    "fmt"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+const (
+    maxQueryLength = 500
+    maxQueryTerms  = 32
+    minPrefixRunes = 2
+)
+
+//QueryError - запрос не разобрался, Message можно отдать клиенту
+type QueryError struct {
+    Message string
+}
+
+func (e *QueryError) Error() string {
+    return e.Message
+}
+
+func queryError(format string, args ...any) error {
+    return &QueryError{Message: fmt.Sprintf(format, args...)}
+}
+
+//Query - разобранный поисковый запрос
+type Query struct {
+    root node
+}
+
+type node interface{}
+
+type termNode struct {
+    term   string
+    prefix bool
+}
+
+type phraseNode struct {
+    terms []string
+}
+
+type andNode struct {
+    children []node
+}
+
+type orNode struct {
+    children []node
+}
+
+type notNode struct {
+    child node
+}
+
+type lexKind int
+
+const (
+    lexWord lexKind = iota
+    lexPhrase
+    lexAnd
+    lexOr
+    lexNot
+    lexOpen
+    lexClose
+)
+
+type lexeme struct {
+    kind lexKind
+    text string
+}
+
+//Parse разбирает запрос: слова через пробел - AND, OR и NOT пишутся
+//заглавными, -слово - то же, что NOT, "фраза в кавычках" ищется подряд,
+//слово* - по префиксу, скобки группируют.
+func Parse(q string) (*Query, error) {
+    q = strings.TrimSpace(q)
+    if q == "" {
+        return nil, queryError("query cannot be empty")
+    }
+    if len(q) > maxQueryLength {
+        return nil, queryError("query too long, maximum %d characters", maxQueryLength)
+    }
+
+    lexemes, err := lex(q)
+    if err != nil {
+        return nil, err
+    }
+
+    p := &parser{lexemes: lexemes}
+    root, err := p.parseOr()
+    if err != nil {
+        return nil, err
+    }
+    if p.pos < len(p.lexemes) {
+        return nil, queryError("unexpected %q", p.lexemes[p.pos].text)
+    }
+    if root == nil {
+        return nil, queryError("query has no searchable words")
+    }
+    if p.terms > maxQueryTerms {
+        return nil, queryError("too many terms, maximum %d", maxQueryTerms)
+    }
+    return &Query{root: root}, nil
+}
+
+func lex(q string) ([]lexeme, error) {
+    var lexemes []lexeme
+    for i := 0; i < len(q); {
+        r, size := utf8.DecodeRuneInString(q[i:])
+        switch {
+        case unicode.IsSpace(r):
+            i += size
+        case r == '(':
+            lexemes = append(lexemes, lexeme{kind: lexOpen, text: "("})
+            i += size
+        case r == ')':
+            lexemes = append(lexemes, lexeme{kind: lexClose, text: ")"})
+            i += size
+        case r == '"':
+            end := strings.IndexByte(q[i+1:], '"')
+            if end < 0 {
+                return nil, queryError("unterminated phrase")
+            }
+            lexemes = append(lexemes, lexeme{kind: lexPhrase, text: q[i+1 : i+1+end]})
+            i += end + 2
+        case r == '-' && i+size < len(q) && !unicode.IsSpace(rune(q[i+size])):
+            lexemes = append(lexemes, lexeme{kind: lexNot, text: "-"})
+            i += size
+        default:
+            end := strings.IndexFunc(q[i:], func(r rune) bool {
+                return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+            })
+            if end < 0 {
+                end = len(q) - i
+            }
+            word := q[i : i+end]
+            i += end
+
+            switch word {
+            case "AND":
+                lexemes = append(lexemes, lexeme{kind: lexAnd, text: word})
+            case "OR":
+                lexemes = append(lexemes, lexeme{kind: lexOr, text: word})
+            case "NOT":
+                lexemes = append(lexemes, lexeme{kind: lexNot, text: word})
+            default:
+                lexemes = append(lexemes, lexeme{kind: lexWord, text: word})
+            }
+        }
+    }
+    return lexemes, nil
+}
+
+type parser struct {
+    lexemes []lexeme
+    pos     int
+    terms   int
+}
+
+func (p *parser) peek() (lexeme, bool) {
+    if p.pos >= len(p.lexemes) {
+        return lexeme{}, false
+    }
+    return p.lexemes[p.pos], true
+}
+
+func (p *parser) parseOr() (node, error) {
+    var children []node
+    for {
+        child, err := p.parseAnd()
+        if err != nil {
+            return nil, err
+        }
+        if child != nil {
+            children = append(children, child)
+        }
+
+        next, ok := p.peek()
+        if !ok || next.kind != lexOr {
+            break
+        }
+        p.pos++
+        if child == nil {
+            return nil, queryError("OR needs words on both sides")
+        }
+        if next, ok := p.peek(); !ok || next.kind == lexClose || next.kind == lexOr {
+            return nil, queryError("OR needs words on both sides")
+        }
+    }
+
+    switch len(children) {
+    case 0:
+        return nil, nil
+    case 1:
+        return children[0], nil
+    }
+    return orNode{children: children}, nil
+}
+
+//parseAnd собирает операнды до OR, закрывающей скобки или конца запроса
+func (p *parser) parseAnd() (node, error) {
+    var children []node
+    for {
+        next, ok := p.peek()
+        if !ok || next.kind == lexOr || next.kind == lexClose {
+            break
+        }
+        if next.kind == lexAnd {
+            if len(children) == 0 {
+                return nil, queryError("AND needs words on both sides")
+            }
+            p.pos++
+            if next, ok := p.peek(); !ok || next.kind == lexOr || next.kind == lexClose || next.kind == lexAnd {
+                return nil, queryError("AND needs words on both sides")
+            }
+            continue
+        }
+
+        child, err := p.parseUnary()
+        if err != nil {
+            return nil, err
+        }
+        if child != nil {
+            children = append(children, child)
+        }
+    }
+
+    switch len(children) {
+    case 0:
+        return nil, nil
+    case 1:
+        return children[0], nil
+    }
+    return andNode{children: children}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+    next, _ := p.peek()
+    p.pos++
+
+    switch next.kind {
+    case lexNot:
+        operand, ok := p.peek()
+        if !ok || operand.kind == lexOr || operand.kind == lexAnd || operand.kind == lexClose {
+            return nil, queryError("NOT needs a word after it")
+        }
+        child, err := p.parseUnary()
+        if err != nil || child == nil {
+            return nil, err
+        }
+        return notNode{child: child}, nil
+
+    case lexOpen:
+        child, err := p.parseOr()
+        if err != nil {
+            return nil, err
+        }
+        if closing, ok := p.peek(); !ok || closing.kind != lexClose {
+            return nil, queryError("missing closing parenthesis")
+        }
+        p.pos++
+        return child, nil
+
+    case lexClose:
+        return nil, queryError("unexpected \")\"")
+
+    case lexPhrase:
+        return p.words(next.text, false), nil
+    }
+
+    word := next.text
+    prefix := strings.HasSuffix(word, "*")
+    if prefix {
+        word = strings.TrimRight(word, "*")
+        if utf8.RuneCountInString(word) < minPrefixRunes {
+            return nil, queryError("prefix %q is too short, use at least %d characters", next.text, minPrefixRunes)
+        }
+    }
+    return p.words(word, prefix), nil
+}
+
+//words превращает слово или фразу в узел: одно слово - терм, несколько -
+//фраза, пунктуация без слов пропускается
+func (p *parser) words(text string, prefix bool) node {
+    tokens := tokenize(text)
+    p.terms += len(tokens)
+    switch len(tokens) {
+    case 0:
+        return nil
+    case 1:
+        return termNode{term: tokens[0].term, prefix: prefix}
+    }
+
+    terms := make([]string, len(tokens))
+    for i, tok := range tokens {
+        terms[i] = tok.term
+    }
+    return phraseNode{terms: terms}
+}
@@ -0,0 +1,87 @@
+package search
+
+import (
+    "html"
+    "strings"
+    "unicode/utf8"
+)
+
+const (
+    //snippetRunes - длина фрагмента длинного описания
+    snippetRunes = 160
+    //snippetContext - сколько символов оставить перед первым совпадением
+    snippetContext = 40
+    markOpen       = "<mark>"
+    markClose      = "</mark>"
+)
+
+//snippets подсвечивает найденные термы тегами <mark>, остальной текст
+//экранируется, так что фрагмент можно вставлять как HTML. Длинный текст
+//режется до окна вокруг первого совпадения.
+func snippets(doc *document, terms []string) map[string]string {
+    wanted := make(map[string]bool, len(terms))
+    for _, term := range terms {
+        wanted[term] = true
+    }
+
+    result := map[string]string{}
+    for f := field(0); f < numFields; f++ {
+        var marks []token
+        for _, tok := range doc.tokens[f] {
+            if wanted[tok.term] {
+                marks = append(marks, tok)
+            }
+        }
+        if len(marks) > 0 {
+            result[fieldNames[f]] = highlight(doc.text[f], marks)
+        }
+    }
+    return result
+}
+
+func highlight(text string, marks []token) string {
+    start, end := window(text, marks[0])
+
+    var sb strings.Builder
+    if start > 0 {
+        sb.WriteString("…")
+    }
+    pos := start
+    for _, mark := range marks {
+        if mark.end > end {
+            break
+        }
+        sb.WriteString(html.EscapeString(text[pos:mark.start]))
+        sb.WriteString(markOpen)
+        sb.WriteString(html.EscapeString(text[mark.start:mark.end]))
+        sb.WriteString(markClose)
+        pos = mark.end
+    }
+    sb.WriteString(html.EscapeString(text[pos:end]))
+    if end < len(text) {
+        sb.WriteString("…")
+    }
+    return sb.String()
+}
+
+//window - байтовые границы фрагмента, целиком включающего первое совпадение
+func window(text string, first token) (int, int) {
+    if utf8.RuneCountInString(text) <= snippetRunes {
+        return 0, len(text)
+    }
+
+    start := first.start
+    for i := 0; i < snippetContext && start > 0; i++ {
+        _, size := utf8.DecodeLastRuneInString(text[:start])
+        start -= size
+    }
+    end := start
+    for i := 0; i < snippetRunes && end < len(text); i++ {
+        _, size := utf8.DecodeRuneInString(text[end:])
+        end += size
+    }
+    if end < first.end {
+        end = first.end
+    }
+    return start, end
+}
@@ -0,0 +1,61 @@
+package search
+
+import (
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+//maxTermLength - длиннее слова обрезаются, чтобы мусор не раздувал словарь
+const maxTermLength = 64
+
+//token - слово текста и его байтовые границы для подсветки
+type token struct {
+    term  string
+    start int
+    end   int
+}
+
+//tokenize режет текст на слова из букв и цифр любого алфавита и приводит
+//их к нижнему регистру, ё считается за е
+func tokenize(text string) []token {
+    var tokens []token
+    start := -1
+    for i, r := range text {
+        if isWordRune(r) {
+            if start < 0 {
+                start = i
+            }
+            continue
+        }
+        if start >= 0 {
+            tokens = append(tokens, newToken(text, start, i))
+            start = -1
+        }
+    }
+    if start >= 0 {
+        tokens = append(tokens, newToken(text, start, len(text)))
+    }
+    return tokens
+}
+
+func newToken(text string, start, end int) token {
+    return token{term: normalize(text[start:end]), start: start, end: end}
+}
+
+func isWordRune(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func normalize(word string) string {
+    term := strings.ReplaceAll(strings.ToLower(word), "ё", "е")
+    if len(term) <= maxTermLength {
+        return term
+    }
+    //режем по границе руны
+    cut := maxTermLength
+    for cut > 0 && !utf8.RuneStart(term[cut]) {
+        cut--
+    }
+    return term[:cut]
+}
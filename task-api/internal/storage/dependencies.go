@@ -0,0 +1,285 @@
+package storage
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "task-api/internal/models"
+    "time"
+)
+
+var (
+    //ErrInvalidLink - parent_id или blocked_by ссылается на чужую или несуществующую задачу либо замыкает цикл
+    ErrInvalidLink = errors.New("invalid task link")
+    //ErrTaskBlocked - задачу пытаются закрыть, пока открыты ее блокеры
+    ErrTaskBlocked = errors.New("task is blocked")
+)
+
+//LinkError описывает, какое поле задачи нарушает связи. Err - ErrInvalidLink или ErrTaskBlocked.
+type LinkError struct {
+    Field   string
+    Message string
+    Err     error
+}
+
+func (e *LinkError) Error() string {
+    return e.Message
+}
+
+func (e *LinkError) Unwrap() error {
+    return e.Err
+}
+
+//Tree отдает задачу владельца со всеми подзадачами
+func (s *TaskStore) Tree(ownerID, id int) (models.TaskTree, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    task, exists := s.tasks[id]
+    if !exists || task.UserID != ownerID {
+        return models.TaskTree{}, false
+    }
+    return s.treeLocked(task), true
+}
+
+func (s *TaskStore) treeLocked(task models.Task) models.TaskTree {
+    node := models.TaskTree{
+        Task:         task,
+        OpenBlockers: s.openBlockersLocked(task),
+        Subtasks:     []models.TaskTree{},
+    }
+    for _, childID := range sortedLinks(s.children[task.ID]) {
+        child := s.tasks[childID]
+        node.SubtasksTotal++
+        if child.Done {
+            node.SubtasksDone++
+        }
+        node.Subtasks = append(node.Subtasks, s.treeLocked(child))
+    }
+    return node
+}
+
+//checkLinksLocked проверяет связи задачи перед записью. previous - состояние
+//до изменения, nil для новой задачи.
+func (s *TaskStore) checkLinksLocked(task models.Task, previous *models.Task) error {
+    if task.ParentID != nil {
+        parentID := *task.ParentID
+        if parentID == task.ID {
+            return &LinkError{Field: "parent_id", Message: "task cannot be its own parent", Err: ErrInvalidLink}
+        }
+        if !s.ownedLocked(task.UserID, parentID) {
+            return &LinkError{Field: "parent_id", Message: fmt.Sprintf("parent task %d does not exist", parentID), Err: ErrInvalidLink}
+        }
+        //новая задача не может оказаться предком, у нее еще нет подзадач
+        for ancestor := s.tasks[parentID].ParentID; ancestor != nil; ancestor = s.tasks[*ancestor].ParentID {
+            if *ancestor == task.ID {
+                return &LinkError{
+                    Field:   "parent_id",
+                    Message: fmt.Sprintf("task %d is a subtask of task %d and cannot become its parent", parentID, task.ID),
+                    Err:     ErrInvalidLink,
+                }
+            }
+        }
+    }
+
+    for _, blockerID := range task.BlockedBy {
+        if blockerID == task.ID {
+            return &LinkError{Field: "blocked_by", Message: "task cannot block itself", Err: ErrInvalidLink}
+        }
+        if !s.ownedLocked(task.UserID, blockerID) {
+            return &LinkError{Field: "blocked_by", Message: fmt.Sprintf("blocker task %d does not exist", blockerID), Err: ErrInvalidLink}
+        }
+        if s.dependsOnLocked(blockerID, task.ID) {
+            return &LinkError{
+                Field:   "blocked_by",
+                Message: fmt.Sprintf("task %d already depends on task %d, blocking would create a cycle", blockerID, task.ID),
+                Err:     ErrInvalidLink,
+            }
+        }
+    }
+
+    if task.Done && (previous == nil || !previous.Done) {
+        if open := s.openBlockersLocked(task); len(open) > 0 {
+            return &LinkError{
+                Field:   "done",
+                Message: "task is blocked by open task(s) " + joinIDs(open),
+                Err:     ErrTaskBlocked,
+            }
+        }
+    }
+    return nil
+}
+
+func (s *TaskStore) ownedLocked(ownerID, id int) bool {
+    task, exists := s.tasks[id]
+    return exists && task.UserID == ownerID
+}
+
+//dependsOnLocked ищет путь по blocked_by от задачи from до задачи target
+func (s *TaskStore) dependsOnLocked(from, target int) bool {
+    visited := map[int]bool{}
+    stack := []int{from}
+    for len(stack) > 0 {
+        id := stack[len(stack)-1]
+        stack = stack[:len(stack)-1]
+        if id == target {
+            return true
+        }
+        if visited[id] {
+            continue
+        }
+        visited[id] = true
+        stack = append(stack, s.tasks[id].BlockedBy...)
+    }
+    return false
+}
+
+func (s *TaskStore) openBlockersLocked(task models.Task) []int {
+    var open []int
+    for _, blockerID := range task.BlockedBy {
+        if blocker, exists := s.tasks[blockerID]; exists && !blocker.Done {
+            open = append(open, blockerID)
+        }
+    }
+    return open
+}
+
+//rollupLocked закрывает родителя, когда закрылась, удалилась или ушла к
+//другому родителю его последняя открытая подзадача. Закрытие поднимается
+//вверх по дереву. Родитель с открытыми блокерами остается открытым.
+//Повторяющийся родитель создает следующее вхождение.
+func (s *TaskStore) rollupLocked(changes []models.TaskChange, previous, task *models.Task, now time.Time) []models.TaskChange {
+    moved := previous != nil && task != nil && !sameParent(previous.ParentID, task.ParentID)
+
+    var parents []int
+    if task != nil && task.ParentID != nil && task.Done && (previous == nil || !previous.Done || moved) {
+        parents = append(parents, *task.ParentID)
+    }
+    if previous != nil && previous.ParentID != nil && !previous.Done && (task == nil || moved) {
+        parents = append(parents, *previous.ParentID)
+    }
+
+    for _, parentID := range parents {
+        parent, exists := s.tasks[parentID]
+        if !exists || parent.Done || !s.childrenDoneLocked(parentID) || len(s.openBlockersLocked(parent)) > 0 {
+            continue
+        }
+
+        before := parent
+        parent.Done = true
+        //закрытый повторяющийся родитель передает серию, как и при обычном закрытии
+        next := handOver(&parent, now)
+        parent.Version++
+        parent.UpdatedAt = now
+        s.insertLocked(parent)
+        changes = append(changes, models.TaskChange{Type: models.TaskUpdated, Task: parent, Previous: &before})
+        changes = s.spawnLocked(changes, next, now)
+        changes = s.rollupLocked(changes, &before, &parent, now)
+    }
+    return changes
+}
+
+func (s *TaskStore) childrenDoneLocked(parentID int) bool {
+    children := s.children[parentID]
+    if len(children) == 0 {
+        return false
+    }
+    for childID := range children {
+        if !s.tasks[childID].Done {
+            return false
+        }
+    }
+    return true
+}
+
+//detachLocked убирает ссылки на удаленную задачу: подзадачи становятся
+//корневыми, из blocked_by зависимых задач она вычеркивается
+func (s *TaskStore) detachLocked(changes []models.TaskChange, id int, now time.Time) []models.TaskChange {
+    for _, childID := range sortedLinks(s.children[id]) {
+        child := s.tasks[childID]
+        before := child
+        child.ParentID = nil
+        child.Version++
+        child.UpdatedAt = now
+        s.insertLocked(child)
+        changes = append(changes, models.TaskChange{Type: models.TaskUpdated, Task: child, Previous: &before})
+    }
+
+    for _, dependentID := range sortedLinks(s.dependents[id]) {
+        dependent := s.tasks[dependentID]
+        before := dependent
+        blockedBy := make([]int, 0, len(dependent.BlockedBy))
+        for _, blockerID := range dependent.BlockedBy {
+            if blockerID != id {
+                blockedBy = append(blockedBy, blockerID)
+            }
+        }
+        if len(blockedBy) == 0 {
+            blockedBy = nil
+        }
+        dependent.BlockedBy = blockedBy
+        dependent.Version++
+        dependent.UpdatedAt = now
+        s.insertLocked(dependent)
+        changes = append(changes, models.TaskChange{Type: models.TaskUpdated, Task: dependent, Previous: &before})
+    }
+    return changes
+}
+
+func (s *TaskStore) indexLinksLocked(task models.Task) {
+    if task.ParentID != nil {
+        addLink(s.children, *task.ParentID, task.ID)
+    }
+    for _, blockerID := range task.BlockedBy {
+        addLink(s.dependents, blockerID, task.ID)
+    }
+}
+
+func (s *TaskStore) unindexLinksLocked(task models.Task) {
+    if task.ParentID != nil {
+        removeLink(s.children, *task.ParentID, task.ID)
+    }
+    for _, blockerID := range task.BlockedBy {
+        removeLink(s.dependents, blockerID, task.ID)
+    }
+}
+
+func addLink(index map[int]map[int]bool, from, to int) {
+    if index[from] == nil {
+        index[from] = make(map[int]bool)
+    }
+    index[from][to] = true
+}
+
+func removeLink(index map[int]map[int]bool, from, to int) {
+    delete(index[from], to)
+    if len(index[from]) == 0 {
+        delete(index, from)
+    }
+}
+
+func sortedLinks(links map[int]bool) []int {
+    ids := make([]int, 0, len(links))
+    for id := range links {
+        ids = append(ids, id)
+    }
+    sort.Ints(ids)
+    return ids
+}
+
+func sameParent(a, b *int) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+    return *a == *b
+}
+
+func joinIDs(ids []int) string {
+    parts := make([]string, len(ids))
+    for i, id := range ids {
+        parts[i] = strconv.Itoa(id)
+    }
+    return strings.Join(parts, ", ")
+}
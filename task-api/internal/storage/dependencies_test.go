@@ -0,0 +1,156 @@
+package storage
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "task-api/internal/models"
+)
+
+func done(v bool) models.TaskPatch {
+    return models.TaskPatch{Done: &v}
+}
+
+func parent(id int) models.TaskPatch {
+    return models.TaskPatch{ParentID: &id}
+}
+
+func blockedBy(ids ...int) models.TaskPatch {
+    return models.TaskPatch{BlockedBy: &ids}
+}
+
+func TestTaskLinks(t *testing.T) {
+    t.Run("Rejects cycles and foreign links", func(t *testing.T) {
+        s := NewTaskStore()
+        a := mustCreate(t, s, models.Task{Title: "a", UserID: 1})
+        b := mustCreate(t, s, models.Task{Title: "b", UserID: 1, ParentID: &a.ID, BlockedBy: []int{a.ID}})
+        foreign := mustCreate(t, s, models.Task{Title: "f", UserID: 2})
+
+        var linkErr *LinkError
+        if _, err := s.Update(ctx, 1, a.ID, parent(b.ID), 0); !errors.As(err, &linkErr) || linkErr.Field != "parent_id" {
+            t.Errorf("expected parent cycle to be rejected, got %v", err)
+        }
+        if _, err := s.Update(ctx, 1, a.ID, blockedBy(b.ID), 0); !errors.Is(err, ErrInvalidLink) {
+            t.Errorf("expected blocker cycle to be rejected, got %v", err)
+        }
+        if _, err := s.Update(ctx, 1, a.ID, blockedBy(a.ID), 0); !errors.Is(err, ErrInvalidLink) {
+            t.Errorf("expected self block to be rejected, got %v", err)
+        }
+        if _, err := s.Create(ctx, models.Task{Title: "c", UserID: 1, ParentID: &foreign.ID}); !errors.Is(err, ErrInvalidLink) {
+            t.Errorf("expected foreign parent to be rejected, got %v", err)
+        }
+        if task, _ := s.GetByID(1, a.ID); task.Version != 1 {
+            t.Errorf("expected rejected updates to leave task untouched, got version %d", task.Version)
+        }
+    })
+
+    t.Run("Refuses done while blockers are open", func(t *testing.T) {
+        s := NewTaskStore()
+        blocker := mustCreate(t, s, models.Task{Title: "blocker", UserID: 1})
+        task := mustCreate(t, s, models.Task{Title: "task", UserID: 1, BlockedBy: []int{blocker.ID}})
+
+        if _, err := s.Update(ctx, 1, task.ID, done(true), 0); !errors.Is(err, ErrTaskBlocked) {
+            t.Fatalf("expected blocked error, got %v", err)
+        }
+        s.Update(ctx, 1, blocker.ID, done(true), 0)
+        if _, err := s.Update(ctx, 1, task.ID, done(true), 0); err != nil {
+            t.Errorf("expected task to close after blocker, got %v", err)
+        }
+    })
+
+    t.Run("Completes parent when last subtask is done", func(t *testing.T) {
+        s := NewTaskStore()
+        root := mustCreate(t, s, models.Task{Title: "root", UserID: 1})
+        mid := mustCreate(t, s, models.Task{Title: "mid", UserID: 1, ParentID: &root.ID})
+        first := mustCreate(t, s, models.Task{Title: "first", UserID: 1, ParentID: &mid.ID})
+        second := mustCreate(t, s, models.Task{Title: "second", UserID: 1, ParentID: &mid.ID})
+
+        var changes []models.TaskChange
+        s.OnChange(func(change models.TaskChange) { changes = append(changes, change) })
+
+        s.Update(ctx, 1, first.ID, done(true), 0)
+        if task, _ := s.GetByID(1, mid.ID); task.Done {
+            t.Fatal("expected parent to stay open while a subtask is open")
+        }
+
+        s.Update(ctx, 1, second.ID, done(true), 0)
+        for _, id := range []int{mid.ID, root.ID} {
+            if task, _ := s.GetByID(1, id); !task.Done {
+                t.Errorf("expected task %d to be completed by rollup", id)
+            }
+        }
+        if len(changes) != 4 {
+            t.Errorf("expected rollup changes to be published, got %d", len(changes))
+        }
+
+        tree, _ := s.Tree(1, root.ID)
+        if tree.SubtasksTotal != 1 || len(tree.Subtasks[0].Subtasks) != 2 || tree.Subtasks[0].SubtasksDone != 2 {
+            t.Errorf("unexpected tree: %+v", tree)
+        }
+    })
+
+    t.Run("Delete detaches subtasks and dependents", func(t *testing.T) {
+        s := NewTaskStore()
+        a := mustCreate(t, s, models.Task{Title: "a", UserID: 1})
+        child := mustCreate(t, s, models.Task{Title: "child", UserID: 1, ParentID: &a.ID})
+        dependent := mustCreate(t, s, models.Task{Title: "dep", UserID: 1, BlockedBy: []int{a.ID}})
+
+        if _, err := s.Delete(ctx, 1, a.ID, 0); err != nil {
+            t.Fatalf("expected delete, got %v", err)
+        }
+        if task, _ := s.GetByID(1, child.ID); task.ParentID != nil || task.Version != 2 {
+            t.Errorf("expected child to become root, got %+v", task)
+        }
+        if task, _ := s.GetByID(1, dependent.ID); len(task.BlockedBy) != 0 {
+            t.Errorf("expected blocker to be removed, got %+v", task)
+        }
+    })
+
+    t.Run("Atomic bulk rolls back rollup", func(t *testing.T) {
+        s := NewTaskStore()
+        p := mustCreate(t, s, models.Task{Title: "p", UserID: 1})
+        child := mustCreate(t, s, models.Task{Title: "c", UserID: 1, ParentID: &p.ID})
+
+        _, applied := s.ApplyBulk(ctx, 1, []models.BulkOperation{
+            {Op: models.BulkUpdate, ID: child.ID, Patch: done(true)},
+            {Op: models.BulkDelete, ID: 99},
+        }, true)
+        if applied {
+            t.Fatal("expected batch to fail")
+        }
+        if task, _ := s.GetByID(1, p.ID); task.Done || task.Version != 1 {
+            t.Errorf("expected parent rollup to be rolled back, got %+v", task)
+        }
+        if tree, _ := s.Tree(1, p.ID); tree.SubtasksTotal != 1 {
+            t.Errorf("expected child index to be restored, got %+v", tree)
+        }
+    })
+
+    t.Run("Rollup of a recurring parent creates its next occurrence", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+        s := recurringStore(&now)
+        due := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+        p := mustCreate(t, s, models.Task{Title: "weekly review", UserID: 1, DueAt: &due, Recurrence: recurring("FREQ=WEEKLY")})
+        child := mustCreate(t, s, models.Task{Title: "collect notes", UserID: 1, ParentID: &p.ID})
+
+        var changes []models.TaskChange
+        s.OnChange(func(change models.TaskChange) { changes = append(changes, change) })
+        s.Update(ctx, 1, child.ID, done(true), 0)
+
+        closed, _ := s.GetByID(1, p.ID)
+        if !closed.Done || closed.Recurrence.NextAt != nil {
+            t.Errorf("expected parent to close and hand over the series, got %+v", closed)
+        }
+        if len(changes) != 3 || changes[2].Type != models.TaskCreated {
+            t.Fatalf("expected child update, parent rollup and next occurrence, got %+v", changes)
+        }
+        next := changes[2].Task
+        if next.Done || !next.DueAt.Equal(due.AddDate(0, 0, 7)) || next.Recurrence.SeriesID != p.ID {
+            t.Errorf("unexpected next occurrence %+v", next)
+        }
+        if created := s.AdvanceRecurring(ctx, due.AddDate(0, 0, 1)); len(created) != 0 {
+            t.Errorf("expected closed parent not to advance again, got %+v", created)
+        }
+    })
+}
@@ -0,0 +1,352 @@
+package storage
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "sort"
+    "sync"
+    "task-api/internal/models"
+    "time"
+)
+
+const DefaultCompactEvery = 1000
+
+const (
+    opPut    = "put"
+    opDelete = "delete"
+    opNextID = "next_id"
+)
+
+type logRecord struct {
+    Op     string       `json:"op"`
+    Task   *models.Task `json:"task,omitempty"`
+    ID     int          `json:"id,omitempty"`
+    NextID int          `json:"next_id,omitempty"`
+}
+
+//FileTaskStore держит задачи в памяти и пишет каждую мутацию в append-only лог.
+//Когда в логе накапливается compactEvery записей, он переписывается снапшотом.
+type FileTaskStore struct {
+    mu           sync.Mutex
+    mem          *TaskStore
+    path         string
+    file         *os.File
+    writer       *bufio.Writer
+    records      int
+    compactEvery int
+    //writeErr - последняя ошибка записи в лог, сбрасывается удачной записью
+    writeErr     error
+    //pending - записи текущей мутации, собранные слушателем record
+    pending      []logRecord
+}
+
+func NewFileTaskStore(path string, compactEvery int) (*FileTaskStore, error) {
+    if compactEvery <= 0 {
+        compactEvery = DefaultCompactEvery
+    }
+
+    s := &FileTaskStore{
+        mem:          NewTaskStore(),
+        path:         path,
+        compactEvery: compactEvery,
+    }
+
+    if err := s.replay(); err != nil {
+        return nil, err
+    }
+    //восстановление из лога событий не порождает, поэтому подписываемся после него
+    s.mem.OnChange(s.record)
+
+    //сразу компактим, чтобы начать с чистого снапшота
+    if err := s.compact(); err != nil {
+        return nil, err
+    }
+
+    return s, nil
+}
+
+func (s *FileTaskStore) replay() error {
+    f, err := os.Open(s.path)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to open task log: %w", err)
+    }
+    defer f.Close()
+
+    scanner := bufio.NewScanner(f)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        var rec logRecord
+        if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+            //оборванная последняя строка после падения процесса
+            log.Printf("task log %s: skipping malformed record at line %d: %v", s.path, line, err)
+            continue
+        }
+
+        switch rec.Op {
+        case opPut:
+            if rec.Task != nil {
+                s.mem.put(*rec.Task)
+            }
+        case opDelete:
+            s.mem.remove(rec.ID)
+        case opNextID:
+            s.mem.setNextID(rec.NextID)
+        default:
+            log.Printf("task log %s: unknown op %q at line %d", s.path, rec.Op, line)
+        }
+    }
+
+    if err := scanner.Err(); err != nil {
+        return fmt.Errorf("failed to read task log: %w", err)
+    }
+    return nil
+}
+
+//compact переписывает лог как снапшот текущего состояния. Вызывать под s.mu.
+//Старый лог остается открытым, пока снапшот не встал на его место, так что при
+//ошибке записи продолжают идти в него.
+func (s *FileTaskStore) compact() error {
+    tmpPath := s.path + ".tmp"
+    //снапшот сразу открыт на дозапись: после переименования он и есть новый лог
+    tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return fmt.Errorf("failed to create snapshot: %w", err)
+    }
+    discard := func(err error) error {
+        tmp.Close()
+        os.Remove(tmpPath)
+        return err
+    }
+
+    w := bufio.NewWriter(tmp)
+    enc := json.NewEncoder(w)
+
+    tasks := s.mem.GetAll()
+    sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+    if err := enc.Encode(logRecord{Op: opNextID, NextID: s.mem.getNextID()}); err != nil {
+        return discard(fmt.Errorf("failed to write snapshot: %w", err))
+    }
+    for i := range tasks {
+        if err := enc.Encode(logRecord{Op: opPut, Task: &tasks[i]}); err != nil {
+            return discard(fmt.Errorf("failed to write snapshot: %w", err))
+        }
+    }
+
+    if err := w.Flush(); err != nil {
+        return discard(fmt.Errorf("failed to flush snapshot: %w", err))
+    }
+    if err := tmp.Sync(); err != nil {
+        return discard(fmt.Errorf("failed to sync snapshot: %w", err))
+    }
+
+    if s.file != nil {
+        if err := s.writer.Flush(); err != nil {
+            return discard(fmt.Errorf("failed to flush task log: %w", err))
+        }
+    }
+
+    if err := os.Rename(tmpPath, s.path); err != nil {
+        return discard(fmt.Errorf("failed to replace task log: %w", err))
+    }
+
+    if s.file != nil {
+        if err := s.file.Close(); err != nil {
+            //снапшот уже на месте, старый файл больше не нужен
+            log.Printf("task log %s: failed to close replaced log: %v", s.path, err)
+        }
+    }
+
+    s.file = tmp
+    s.writer = w
+    s.records = 0
+    return nil
+}
+
+//appendRecord дописывает записи в лог одним сбросом буфера. Вызывать под s.mu.
+func (s *FileTaskStore) appendRecord(recs ...logRecord) {
+    if len(recs) == 0 {
+        return
+    }
+    if s.file == nil {
+        log.Printf("task log %s: store is closed, dropping %d record(s)", s.path, len(recs))
+        return
+    }
+
+    var data []byte
+    for _, rec := range recs {
+        line, err := json.Marshal(rec)
+        if err != nil {
+            log.Printf("task log %s: failed to marshal record: %v", s.path, err)
+            return
+        }
+        data = append(data, line...)
+        data = append(data, '\n')
+    }
+
+    if _, err := s.writer.Write(data); err != nil {
+        log.Printf("task log %s: failed to append record: %v", s.path, err)
+        s.writeErr = err
+        return
+    }
+    if err := s.writer.Flush(); err != nil {
+        log.Printf("task log %s: failed to flush record: %v", s.path, err)
+        s.writeErr = err
+        return
+    }
+
+    s.writeErr = nil
+    s.records += len(recs)
+    if s.records >= s.compactEvery {
+        //записи продолжают идти в старый лог, а readyz видит ошибку до удачной компакции
+        if err := s.compact(); err != nil {
+            log.Printf("task log %s: compaction failed: %v", s.path, err)
+            s.writeErr = err
+        }
+    }
+}
+
+func (s *FileTaskStore) Create(ctx context.Context, task models.Task) (models.Task, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    created, err := s.mem.Create(ctx, task)
+    s.flushPending()
+    return created, err
+}
+
+func (s *FileTaskStore) UpsertByExternalRef(ctx context.Context, task models.Task) (models.Task, models.UpsertResult, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    upserted, result, err := s.mem.UpsertByExternalRef(ctx, task)
+    s.flushPending()
+    return upserted, result, err
+}
+
+func (s *FileTaskStore) GetByID(ownerID, id int) (models.Task, bool) {
+    return s.mem.GetByID(ownerID, id)
+}
+
+func (s *FileTaskStore) GetAllFiltered(ownerID int, query models.TaskQuery) (models.TaskPage, error) {
+    return s.mem.GetAllFiltered(ownerID, query)
+}
+
+func (s *FileTaskStore) Search(ownerID int, query models.SearchQuery) (models.SearchResult, error) {
+    return s.mem.Search(ownerID, query)
+}
+
+func (s *FileTaskStore) Tree(ownerID, id int) (models.TaskTree, bool) {
+    return s.mem.Tree(ownerID, id)
+}
+
+func (s *FileTaskStore) Update(ctx context.Context, ownerID, id int, patch models.TaskPatch, ifVersion int) (models.Task, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    updated, err := s.mem.Update(ctx, ownerID, id, patch, ifVersion)
+    s.flushPending()
+    return updated, err
+}
+
+func (s *FileTaskStore) Delete(ctx context.Context, ownerID, id int, ifVersion int) (models.Task, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    deleted, err := s.mem.Delete(ctx, ownerID, id, ifVersion)
+    s.flushPending()
+    return deleted, err
+}
+
+//ApplyBulk пишет в лог только примененные изменения, все разом
+func (s *FileTaskStore) ApplyBulk(ctx context.Context, ownerID int, ops []models.BulkOperation, atomic bool) ([]models.BulkResult, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    results, applied := s.mem.ApplyBulk(ctx, ownerID, ops, atomic)
+    s.flushPending()
+    return results, applied
+}
+
+//AdvanceRecurring пишет в лог вхождения серий и передачу серии от предыдущих
+func (s *FileTaskStore) AdvanceRecurring(ctx context.Context, now time.Time) []models.Task {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    created := s.mem.AdvanceRecurring(ctx, now)
+    s.flushPending()
+    return created
+}
+
+//record копит изменения, о которых сообщило in-memory хранилище, включая
+//побочные: закрытие родителя, отвязку подзадач удаленной задачи. Вызывается
+//под s.mu, так как все мутации идут через методы FileTaskStore.
+func (s *FileTaskStore) record(change models.TaskChange) {
+    if change.Type == models.TaskDeleted {
+        s.pending = append(s.pending, logRecord{Op: opDelete, ID: change.Task.ID})
+        return
+    }
+    task := change.Task
+    s.pending = append(s.pending, logRecord{Op: opPut, Task: &task})
+}
+
+//flushPending пишет накопленные изменения одной операции разом. Вызывать под s.mu.
+func (s *FileTaskStore) flushPending() {
+    s.appendRecord(s.pending...)
+    s.pending = nil
+}
+
+func (s *FileTaskStore) Count() int {
+    return s.mem.Count()
+}
+
+func (s *FileTaskStore) OnChange(listener ChangeListener) {
+    s.mem.OnChange(listener)
+}
+
+//Ping сообщает о закрытом логе, последней неудачной записи или пропавшем файле
+func (s *FileTaskStore) Ping() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.file == nil {
+        return fmt.Errorf("task log %s is closed", s.path)
+    }
+    if s.writeErr != nil {
+        return fmt.Errorf("last write to task log failed: %w", s.writeErr)
+    }
+    if _, err := os.Stat(s.path); err != nil {
+        return fmt.Errorf("task log unavailable: %w", err)
+    }
+    return nil
+}
+
+//Close компактит лог и закрывает файл
+func (s *FileTaskStore) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.file == nil {
+        return nil
+    }
+
+    if err := s.compact(); err != nil {
+        return err
+    }
+
+    if err := s.writer.Flush(); err != nil {
+        return fmt.Errorf("failed to flush task log: %w", err)
+    }
+    err := s.file.Close()
+    s.file = nil
+    return err
+}
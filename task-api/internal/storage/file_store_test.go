@@ -0,0 +1,182 @@
+package storage
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "task-api/internal/models"
+)
+
+func openFileStore(t *testing.T, path string, compactEvery int) *FileTaskStore {
+    t.Helper()
+    s, err := NewFileTaskStore(path, compactEvery)
+    if err != nil {
+        t.Fatalf("expected store to open, got %v", err)
+    }
+    return s
+}
+
+func logLines(t *testing.T, path string) int {
+    t.Helper()
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return bytes.Count(data, []byte("\n"))
+}
+
+func TestFileTaskStore(t *testing.T) {
+    t.Run("Replays the log after reopen", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "tasks.log")
+        s := openFileStore(t, path, 0)
+        kept := mustCreate(t, s, models.Task{Title: "kept", UserID: 1, Tags: []string{"home"}})
+        mustCreate(t, s, models.Task{Title: "child", UserID: 1, ParentID: &kept.ID})
+        if _, err := s.Update(ctx, 1, kept.ID, title("renamed"), 0); err != nil {
+            t.Fatal(err)
+        }
+
+        //без Close, как после падения процесса: лог дописывается на каждой мутации
+        reopened := openFileStore(t, path, 0)
+        defer reopened.Close()
+        task, ok := reopened.GetByID(1, kept.ID)
+        if !ok || task.Title != "renamed" || task.Version != 2 || len(task.Tags) != 1 {
+            t.Errorf("expected replayed update, got %+v", task)
+        }
+        if tree, _ := reopened.Tree(1, kept.ID); tree.SubtasksTotal != 1 {
+            t.Errorf("expected subtask links to be rebuilt, got %+v", tree)
+        }
+        s.Close()
+    })
+
+    t.Run("Persists deletes and next id", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "tasks.log")
+        s := openFileStore(t, path, 0)
+        first := mustCreate(t, s, models.Task{Title: "first", UserID: 1})
+        last := mustCreate(t, s, models.Task{Title: "last", UserID: 1})
+        if _, err := s.Delete(ctx, 1, last.ID, 0); err != nil {
+            t.Fatal(err)
+        }
+        s.Close()
+
+        reopened := openFileStore(t, path, 0)
+        defer reopened.Close()
+        if _, ok := reopened.GetByID(1, last.ID); ok || reopened.Count() != 1 {
+            t.Errorf("expected deleted task to stay deleted, got %d tasks", reopened.Count())
+        }
+        if _, ok := reopened.GetByID(1, first.ID); !ok {
+            t.Error("expected remaining task to be restored")
+        }
+        //ID удаленной задачи не выдается повторно
+        if created := mustCreate(t, reopened, models.Task{Title: "next", UserID: 1}); created.ID != last.ID+1 {
+            t.Errorf("expected next id %d, got %d", last.ID+1, created.ID)
+        }
+    })
+
+    t.Run("Skips a truncated last line", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "tasks.log")
+        s := openFileStore(t, path, 0)
+        task := mustCreate(t, s, models.Task{Title: "kept", UserID: 1})
+        s.Close()
+
+        f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+        if err != nil {
+            t.Fatal(err)
+        }
+        f.WriteString(`{"op":"put","task":{"id":2,"title":"torn`)
+        f.Close()
+
+        reopened := openFileStore(t, path, 0)
+        defer reopened.Close()
+        if _, ok := reopened.GetByID(1, task.ID); !ok || reopened.Count() != 1 {
+            t.Errorf("expected complete records to be restored, got %d tasks", reopened.Count())
+        }
+        //открытие сразу компактит лог, оборванная строка пропадает
+        if lines := logLines(t, path); lines != 2 {
+            t.Errorf("expected snapshot of next_id and one task, got %d lines", lines)
+        }
+    })
+
+    t.Run("Compacts after compactEvery records", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "tasks.log")
+        s := openFileStore(t, path, 3)
+        defer s.Close()
+
+        task := mustCreate(t, s, models.Task{Title: "a", UserID: 1})
+        s.Update(ctx, 1, task.ID, title("b"), 0)
+        if lines := logLines(t, path); lines != 3 {
+            t.Fatalf("expected snapshot line and two appended records, got %d", lines)
+        }
+
+        s.Update(ctx, 1, task.ID, title("c"), 0)
+        if lines := logLines(t, path); lines != 2 {
+            t.Errorf("expected log to be rewritten as a snapshot, got %d lines", lines)
+        }
+        if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+            t.Errorf("expected temporary snapshot to be renamed, got %v", err)
+        }
+
+        reopened := openFileStore(t, path, 3)
+        defer reopened.Close()
+        if got, _ := reopened.GetByID(1, task.ID); got.Title != "c" || got.Version != 3 {
+            t.Errorf("expected compacted state to replay, got %+v", got)
+        }
+    })
+
+    t.Run("Keeps appending to the old log when compaction fails", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "tasks.log")
+        s := openFileStore(t, path, 2)
+        defer s.Close()
+
+        //каталог на месте снапшота не дает его создать
+        if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+            t.Fatal(err)
+        }
+        task := mustCreate(t, s, models.Task{Title: "a", UserID: 1})
+        s.Update(ctx, 1, task.ID, title("b"), 0)
+        if err := s.Ping(); err == nil {
+            t.Error("expected failed compaction to fail ping")
+        }
+        s.Update(ctx, 1, task.ID, title("c"), 0)
+        if lines := logLines(t, path); lines != 4 {
+            t.Errorf("expected records to keep landing in the old log, got %d lines", lines)
+        }
+
+        os.Remove(path + ".tmp")
+        s.Update(ctx, 1, task.ID, title("d"), 0)
+        if err := s.Ping(); err != nil {
+            t.Errorf("expected successful compaction to clear the error, got %v", err)
+        }
+        if lines := logLines(t, path); lines != 2 {
+            t.Errorf("expected log to be compacted, got %d lines", lines)
+        }
+    })
+
+    t.Run("Ping reports a closed store", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "tasks.log")
+        s := openFileStore(t, path, 0)
+        if err := s.Ping(); err != nil {
+            t.Fatalf("expected open store to be ready, got %v", err)
+        }
+        if err := s.Close(); err != nil {
+            t.Fatal(err)
+        }
+        if err := s.Ping(); err == nil {
+            t.Error("expected closed store to fail ping")
+        }
+        if err := s.Close(); err != nil {
+            t.Errorf("expected second close to be a no-op, got %v", err)
+        }
+    })
+
+    t.Run("Ping reports a missing log", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "tasks.log")
+        s := openFileStore(t, path, 0)
+        defer s.Close()
+        os.Remove(path)
+        if err := s.Ping(); err == nil {
+            t.Error("expected removed log to fail ping")
+        }
+    })
+}
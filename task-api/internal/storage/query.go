@@ -0,0 +1,196 @@
+package storage
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "sort"
+    "strings"
+    "task-api/internal/models"
+)
+
+const (
+    DefaultPageLimit = 50
+    MaxPageLimit     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+//cursor указывает на последнюю отданную задачу. Сортировка зашита внутрь,
+//чтобы курсор от одного порядка нельзя было применить к другому.
+type cursor struct {
+    Sort models.TaskSortField `json:"s"`
+    Desc bool                 `json:"d,omitempty"`
+    Num  int64                `json:"n,omitempty"`
+    Str  string               `json:"k,omitempty"`
+    ID   int                  `json:"id"`
+}
+
+type sortKey struct {
+    num int64
+    str string
+    id  int
+}
+
+func keyOf(task models.Task, field models.TaskSortField) sortKey {
+    key := sortKey{id: task.ID}
+    switch field {
+    case models.SortByTitle:
+        key.str = strings.ToLower(task.Title)
+    case models.SortByCreatedAt:
+        key.num = task.CreatedAt.UnixNano()
+    case models.SortByPriority:
+        key.num = int64(task.Priority.Rank())
+    }
+    return key
+}
+
+//compareKeys сравнивает по полю сортировки, при равенстве - по ID
+func compareKeys(a, b sortKey) int {
+    switch {
+    case a.num < b.num:
+        return -1
+    case a.num > b.num:
+        return 1
+    case a.str < b.str:
+        return -1
+    case a.str > b.str:
+        return 1
+    case a.id < b.id:
+        return -1
+    case a.id > b.id:
+        return 1
+    }
+    return 0
+}
+
+func encodeCursor(c cursor) string {
+    data, _ := json.Marshal(c)
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+    var c cursor
+    data, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return c, ErrInvalidCursor
+    }
+    if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+        return c, ErrInvalidCursor
+    }
+    return c, nil
+}
+
+func matchesFilter(task models.Task, filter models.TaskFilter) bool {
+    if filter.Done != nil && task.Done != *filter.Done {
+        return false
+    }
+    if filter.TitleContains != "" &&
+        !strings.Contains(strings.ToLower(task.Title), strings.ToLower(filter.TitleContains)) {
+        return false
+    }
+    if filter.Tag != "" {
+        found := false
+        for _, tag := range task.Tags {
+            if tag == filter.Tag {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+    if filter.DueAfter != nil || filter.DueBefore != nil {
+        if task.DueAt == nil {
+            return false
+        }
+        if filter.DueAfter != nil && task.DueAt.Before(*filter.DueAfter) {
+            return false
+        }
+        if filter.DueBefore != nil && task.DueAt.After(*filter.DueBefore) {
+            return false
+        }
+    }
+    return true
+}
+
+//paginate сортирует отобранные задачи и вырезает страницу после курсора
+func paginate(tasks []models.Task, query models.TaskQuery) (models.TaskPage, error) {
+    field := query.Sort
+    if field == "" {
+        field = models.SortByID
+    }
+
+    limit := query.Limit
+    if limit <= 0 {
+        limit = DefaultPageLimit
+    }
+    if limit > MaxPageLimit {
+        limit = MaxPageLimit
+    }
+
+    keys := make([]sortKey, len(tasks))
+    for i, task := range tasks {
+        keys[i] = keyOf(task, field)
+    }
+    sort.Sort(byKey{tasks: tasks, keys: keys, desc: query.Desc})
+
+    start := 0
+    if query.Cursor != "" {
+        c, err := decodeCursor(query.Cursor)
+        if err != nil {
+            return models.TaskPage{}, err
+        }
+        if c.Sort != field || c.Desc != query.Desc {
+            return models.TaskPage{}, ErrInvalidCursor
+        }
+
+        after := sortKey{num: c.Num, str: c.Str, id: c.ID}
+        start = sort.Search(len(keys), func(i int) bool {
+            cmp := compareKeys(keys[i], after)
+            if query.Desc {
+                return cmp < 0
+            }
+            return cmp > 0
+        })
+    }
+
+    end := start + limit
+    if end > len(tasks) {
+        end = len(tasks)
+    }
+
+    page := models.TaskPage{Items: tasks[start:end]}
+    if end < len(tasks) {
+        last := keys[end-1]
+        page.NextCursor = encodeCursor(cursor{
+            Sort: field,
+            Desc: query.Desc,
+            Num:  last.num,
+            Str:  last.str,
+            ID:   last.id,
+        })
+    }
+    return page, nil
+}
+
+type byKey struct {
+    tasks []models.Task
+    keys  []sortKey
+    desc  bool
+}
+
+func (b byKey) Len() int { return len(b.tasks) }
+
+func (b byKey) Less(i, j int) bool {
+    if b.desc {
+        return compareKeys(b.keys[i], b.keys[j]) > 0
+    }
+    return compareKeys(b.keys[i], b.keys[j]) < 0
+}
+
+func (b byKey) Swap(i, j int) {
+    b.tasks[i], b.tasks[j] = b.tasks[j], b.tasks[i]
+    b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
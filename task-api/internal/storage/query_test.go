@@ -0,0 +1,177 @@
+package storage
+
+import (
+    "encoding/base64"
+    "errors"
+    "testing"
+    "time"
+
+    "task-api/internal/models"
+)
+
+//pagedStore - задачи с повторяющимися ключами сортировки, чтобы порядок
+//держался на ID
+func pagedStore(t *testing.T) *TaskStore {
+    t.Helper()
+    now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+    s := recurringStore(&now)
+    for i, task := range []models.Task{
+        {Title: "Beta", Priority: models.PriorityHigh, Tags: []string{"work"}},
+        {Title: "alpha", Priority: models.PriorityLow},
+        {Title: "beta", Priority: models.PriorityHigh, Tags: []string{"work"}, Done: true},
+        {Title: "gamma", Priority: models.PriorityUrgent, Tags: []string{"work"}},
+        {Title: "Alpha", Priority: models.PriorityNormal},
+        {Title: "delta", Priority: models.PriorityHigh, Tags: []string{"work"}},
+        {Title: "beta", Priority: models.PriorityLow, Tags: []string{"home"}},
+    } {
+        //пары задач создаются в одну наносекунду
+        now = now.Add(time.Duration(i%2) * time.Nanosecond)
+        task.UserID = 1
+        mustCreate(t, s, task)
+    }
+    mustCreate(t, s, models.Task{Title: "foreign", UserID: 2})
+    return s
+}
+
+//collectPages проходит все страницы и возвращает ID в порядке выдачи
+func collectPages(t *testing.T, s *TaskStore, query models.TaskQuery) []int {
+    t.Helper()
+    var ids []int
+    for pages := 0; ; pages++ {
+        if pages > 20 {
+            t.Fatal("pagination does not terminate")
+        }
+        page, err := s.GetAllFiltered(1, query)
+        if err != nil {
+            t.Fatalf("unexpected error on page %d: %v", pages, err)
+        }
+        if len(page.Items) > query.Limit {
+            t.Fatalf("page %d has %d items, limit %d", pages, len(page.Items), query.Limit)
+        }
+        for _, task := range page.Items {
+            ids = append(ids, task.ID)
+        }
+        if page.NextCursor == "" {
+            return ids
+        }
+        query.Cursor = page.NextCursor
+    }
+}
+
+func TestPagination(t *testing.T) {
+    s := pagedStore(t)
+
+    tests := []struct {
+        name string
+        sort models.TaskSortField
+        desc bool
+        want []int
+    }{
+        {"id", models.SortByID, false, []int{1, 2, 3, 4, 5, 6, 7}},
+        {"id desc", models.SortByID, true, []int{7, 6, 5, 4, 3, 2, 1}},
+        {"title ignores case, ties by id", models.SortByTitle, false, []int{2, 5, 1, 3, 7, 6, 4}},
+        {"title desc", models.SortByTitle, true, []int{4, 6, 7, 3, 1, 5, 2}},
+        {"created_at ties by id", models.SortByCreatedAt, false, []int{1, 2, 3, 4, 5, 6, 7}},
+        {"created_at desc", models.SortByCreatedAt, true, []int{7, 6, 5, 4, 3, 2, 1}},
+        {"priority", models.SortByPriority, false, []int{2, 7, 5, 1, 3, 6, 4}},
+        {"priority desc", models.SortByPriority, true, []int{4, 6, 3, 1, 5, 7, 2}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for _, limit := range []int{1, 2, 3, 7} {
+                got := collectPages(t, s, models.TaskQuery{Sort: tt.sort, Desc: tt.desc, Limit: limit})
+                if !equalIDs(got, tt.want) {
+                    t.Errorf("limit %d: expected %v, got %v", limit, tt.want, got)
+                }
+            }
+        })
+    }
+
+    t.Run("Cursor survives changes between pages", func(t *testing.T) {
+        s := pagedStore(t)
+        query := models.TaskQuery{Sort: models.SortByTitle, Limit: 3}
+        page, _ := s.GetAllFiltered(1, query)
+
+        //курсор хранит ключ, а не позицию: удаление отданной задачи не сдвигает выдачу
+        s.Delete(ctx, 1, page.Items[0].ID, 0)
+        mustCreate(t, s, models.Task{Title: "aardvark", UserID: 1})
+
+        query.Cursor = page.NextCursor
+        next, err := s.GetAllFiltered(1, query)
+        if err != nil || len(next.Items) != 3 || next.Items[0].ID != 3 {
+            t.Errorf("expected page to continue after the cursor, got %+v, %v", next.Items, err)
+        }
+    })
+
+    t.Run("Filters combine with the cursor", func(t *testing.T) {
+        open := false
+        query := models.TaskQuery{
+            Filter: models.TaskFilter{Tag: "work", Done: &open},
+            Sort:   models.SortByPriority,
+            Desc:   true,
+            Limit:  1,
+        }
+        if got := collectPages(t, s, query); !equalIDs(got, []int{4, 6, 1}) {
+            t.Errorf("expected filtered pages [4 6 1], got %v", got)
+        }
+
+        query = models.TaskQuery{Filter: models.TaskFilter{TitleContains: "BETA"}, Sort: models.SortByTitle, Limit: 2}
+        if got := collectPages(t, s, query); !equalIDs(got, []int{1, 3, 7}) {
+            t.Errorf("expected filtered pages [1 3 7], got %v", got)
+        }
+    })
+
+    t.Run("Rejects invalid and tampered cursors", func(t *testing.T) {
+        first, _ := s.GetAllFiltered(1, models.TaskQuery{Sort: models.SortByTitle, Limit: 2})
+        raw, _ := base64.RawURLEncoding.DecodeString(first.NextCursor)
+        tampered := []byte(first.NextCursor)
+        tampered[0] ^= 0x20
+
+        tests := []struct {
+            name   string
+            cursor string
+            sort   models.TaskSortField
+            desc   bool
+        }{
+            {"not base64", "%%%", models.SortByTitle, false},
+            {"not json", base64.RawURLEncoding.EncodeToString([]byte("garbage")), models.SortByTitle, false},
+            {"padded base64", base64.URLEncoding.EncodeToString(raw) + "==", models.SortByTitle, false},
+            {"flipped byte", string(tampered), models.SortByTitle, false},
+            {"missing id", encodeCursor(cursor{Sort: models.SortByTitle, Str: "beta"}), models.SortByTitle, false},
+            {"negative id", encodeCursor(cursor{Sort: models.SortByTitle, Str: "beta", ID: -1}), models.SortByTitle, false},
+            {"other sort", first.NextCursor, models.SortByPriority, false},
+            {"other direction", first.NextCursor, models.SortByTitle, true},
+        }
+        for _, tt := range tests {
+            t.Run(tt.name, func(t *testing.T) {
+                _, err := s.GetAllFiltered(1, models.TaskQuery{Sort: tt.sort, Desc: tt.desc, Limit: 2, Cursor: tt.cursor})
+                if !errors.Is(err, ErrInvalidCursor) {
+                    t.Errorf("expected ErrInvalidCursor, got %v", err)
+                }
+            })
+        }
+    })
+
+    t.Run("Limit defaults and is capped", func(t *testing.T) {
+        page, _ := paginate(make([]models.Task, MaxPageLimit+10), models.TaskQuery{Limit: MaxPageLimit + 10})
+        if len(page.Items) != MaxPageLimit || page.NextCursor == "" {
+            t.Errorf("expected page capped at %d, got %d", MaxPageLimit, len(page.Items))
+        }
+        page, _ = paginate(make([]models.Task, DefaultPageLimit+1), models.TaskQuery{})
+        if len(page.Items) != DefaultPageLimit {
+            t.Errorf("expected default limit %d, got %d", DefaultPageLimit, len(page.Items))
+        }
+    })
+}
+
+func equalIDs(a, b []int) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
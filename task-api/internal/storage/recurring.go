@@ -0,0 +1,181 @@
+package storage
+
+import (
+    "context"
+    "sort"
+    "task-api/internal/models"
+    "task-api/internal/recurrence"
+    "time"
+)
+
+//maxCatchUp ограничивает перебор вхождений, пропущенных пока сервис стоял
+const maxCatchUp = 100000
+
+//AdvanceRecurring создает очередные вхождения серий, чье время наступило к
+//моменту now, и возвращает созданные задачи. Предыдущее вхождение остается
+//как есть, только передает серию новому.
+func (s *TaskStore) AdvanceRecurring(ctx context.Context, now time.Time) []models.Task {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now = now.UTC()
+    var due []int
+    for id, task := range s.tasks {
+        if task.Recurrence != nil && task.Recurrence.NextAt != nil && !task.Recurrence.NextAt.After(now) {
+            due = append(due, id)
+        }
+    }
+    sort.Ints(due)
+
+    var created []models.Task
+    var changes []models.TaskChange
+    for _, id := range due {
+        task := s.tasks[id]
+        previous := task
+        next := handOver(&task, now)
+        if next == nil {
+            continue
+        }
+
+        task.Version++
+        task.UpdatedAt = now
+        s.insertLocked(task)
+        changes = append(changes, models.TaskChange{Type: models.TaskUpdated, Task: task, Previous: &previous})
+
+        spawned, err := s.createLocked(*next, now)
+        if err != nil {
+            continue
+        }
+        created = append(created, spawned[0].Task)
+        changes = append(changes, spawned...)
+    }
+
+    s.notifyLocked(ctx, changes...)
+    return created
+}
+
+//schedule заполняет вычисляемые поля повторения. Новое правило начинает
+//серию со срока задачи, а без срока - с текущей минуты, и тогда срок
+//становится первым вхождением. Созданная задача без NextAt, например
+//восстановленная из экспорта, получает его от своего срока, а заданный
+//NextAt сохраняет. Перенос срока у текущего вхождения пересчитывает NextAt.
+func schedule(task *models.Task, previous *models.Task, now time.Time) {
+    if task.Recurrence == nil {
+        return
+    }
+    rec := *task.Recurrence
+    if rec.SeriesID == 0 {
+        rec.SeriesID = task.ID
+        task.Recurrence = &rec
+    }
+    sched, err := recurrence.For(rec)
+    if err != nil {
+        //правило проверяет хендлер, сюда попадет только пропавшая зона
+        return
+    }
+
+    switch {
+    case rec.Start.IsZero():
+        rec.Start = now.Truncate(time.Minute)
+        if task.DueAt != nil {
+            rec.Start = *task.DueAt
+        } else if first, ok := sched.Next(rec.Start, rec.Start.Add(-time.Nanosecond)); ok {
+            first = first.UTC()
+            task.DueAt = &first
+        }
+    case previous == nil && rec.NextAt == nil:
+    case previous != nil && rec.NextAt != nil && !sameTime(previous.DueAt, task.DueAt):
+    default:
+        return
+    }
+
+    after := now
+    if task.DueAt != nil {
+        after = *task.DueAt
+    }
+    rec.NextAt = nil
+    if next, ok := sched.Next(rec.Start, after); ok {
+        next = next.UTC()
+        rec.NextAt = &next
+    }
+    task.Recurrence = &rec
+}
+
+//handedOverLocked узнает восстановленное вхождение, которое уже передало
+//серию: у него нет NextAt, а у владельца есть более позднее вхождение той же
+//серии. Такому вхождению schedule не нужен, иначе серия раздвоится.
+func (s *TaskStore) handedOverLocked(task models.Task) bool {
+    rec := task.Recurrence
+    if rec == nil || rec.Start.IsZero() || rec.NextAt != nil || rec.SeriesID == 0 || task.DueAt == nil {
+        return false
+    }
+    for _, other := range s.tasks {
+        if other.UserID == task.UserID && other.Recurrence != nil && other.Recurrence.SeriesID == rec.SeriesID &&
+            other.DueAt != nil && other.DueAt.After(*task.DueAt) {
+            return true
+        }
+    }
+    return false
+}
+
+//handOver передает серию следующему вхождению: у task пропадает NextAt, а
+//в ответе - новая задача, которую надо создать. Из вхождений, пропущенных
+//пока сервис стоял, создается только последнее наступившее.
+func handOver(task *models.Task, now time.Time) *models.Task {
+    if task.Recurrence == nil || task.Recurrence.NextAt == nil {
+        return nil
+    }
+    rec := *task.Recurrence
+    sched, err := recurrence.For(rec)
+    if err != nil {
+        return nil
+    }
+
+    occurrence := *rec.NextAt
+    for i := 0; i < maxCatchUp; i++ {
+        next, ok := sched.Next(rec.Start, occurrence)
+        if !ok || next.After(now) {
+            break
+        }
+        occurrence = next
+    }
+    occurrence = occurrence.UTC()
+
+    handed := rec
+    handed.NextAt = nil
+    task.Recurrence = &handed
+
+    var nextAt *time.Time
+    if after, ok := sched.Next(rec.Start, occurrence); ok {
+        after = after.UTC()
+        nextAt = &after
+    }
+
+    next := models.Task{
+        Title:       task.Title,
+        Description: task.Description,
+        DueAt:       &occurrence,
+        Priority:    task.Priority,
+        Tags:        append([]string(nil), task.Tags...),
+        UserID:      task.UserID,
+        Recurrence: &models.Recurrence{
+            Rule:     rec.Rule,
+            Timezone: rec.Timezone,
+            Start:    rec.Start,
+            NextAt:   nextAt,
+            SeriesID: rec.SeriesID,
+        },
+    }
+    if task.ParentID != nil {
+        parentID := *task.ParentID
+        next.ParentID = &parentID
+    }
+    return &next
+}
+
+func sameTime(a, b *time.Time) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+    return a.Equal(*b)
+}
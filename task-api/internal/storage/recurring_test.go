@@ -0,0 +1,171 @@
+package storage
+
+import (
+    "testing"
+    "time"
+
+    "task-api/internal/models"
+)
+
+//recurringStore - хранилище с часами, которые двигает тест
+func recurringStore(now *time.Time) *TaskStore {
+    s := NewTaskStore()
+    s.now = func() time.Time { return *now }
+    return s
+}
+
+func recurring(rule string) *models.Recurrence {
+    return &models.Recurrence{Rule: rule}
+}
+
+func TestRecurringTasks(t *testing.T) {
+    t.Run("Schedules series from due date or first occurrence", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 14, 37, 12, 0, time.UTC)
+        s := recurringStore(&now)
+
+        due := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+        withDue := mustCreate(t, s, models.Task{Title: "standup", UserID: 1, DueAt: &due, Recurrence: recurring("0 9 * * *")})
+        rec := withDue.Recurrence
+        if rec.SeriesID != withDue.ID || !rec.Start.Equal(due) || rec.NextAt == nil || !rec.NextAt.Equal(due.AddDate(0, 0, 1)) {
+            t.Errorf("unexpected schedule %+v", rec)
+        }
+
+        noDue := mustCreate(t, s, models.Task{Title: "water plants", UserID: 1, Recurrence: recurring("0 9 * * *")})
+        if noDue.DueAt == nil || !noDue.DueAt.Equal(due) {
+            t.Errorf("expected due_at to become the first occurrence %s, got %v", due, noDue.DueAt)
+        }
+    })
+
+    t.Run("Completing an occurrence creates the next one", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+        s := recurringStore(&now)
+        due := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+        first := mustCreate(t, s, models.Task{Title: "standup", UserID: 1, Tags: []string{"team"}, DueAt: &due, Recurrence: recurring("0 9 * * *")})
+
+        var changes []models.TaskChange
+        s.OnChange(func(change models.TaskChange) { changes = append(changes, change) })
+
+        closed, err := s.Update(ctx, 1, first.ID, done(true), 0)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if closed.Recurrence.NextAt != nil {
+            t.Errorf("expected completed occurrence to hand over the series, got %+v", closed.Recurrence)
+        }
+        if len(changes) != 2 || changes[1].Type != models.TaskCreated {
+            t.Fatalf("expected update and created occurrence, got %+v", changes)
+        }
+
+        next := changes[1].Task
+        if next.Done || next.Title != "standup" || len(next.Tags) != 1 || !next.DueAt.Equal(due.AddDate(0, 0, 1)) {
+            t.Errorf("unexpected next occurrence %+v", next)
+        }
+        if next.Recurrence.SeriesID != first.ID || !next.Recurrence.NextAt.Equal(due.AddDate(0, 0, 2)) {
+            t.Errorf("unexpected next schedule %+v", next.Recurrence)
+        }
+
+        //повторное закрытие старого вхождения серию не двигает
+        s.Update(ctx, 1, first.ID, done(false), 0)
+        s.Update(ctx, 1, first.ID, done(true), 0)
+        if count := s.Count(); count != 2 {
+            t.Errorf("expected handed over occurrence to stay inert, got %d tasks", count)
+        }
+    })
+
+    t.Run("Scheduler catches up with the latest due occurrence", func(t *testing.T) {
+        now := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+        s := recurringStore(&now)
+        due := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+        first := mustCreate(t, s, models.Task{Title: "report", UserID: 1, DueAt: &due, Recurrence: recurring("FREQ=DAILY")})
+
+        if created := s.AdvanceRecurring(ctx, now); len(created) != 0 {
+            t.Fatalf("expected nothing before the next occurrence, got %+v", created)
+        }
+
+        //сервис простоял три дня
+        now = time.Date(2026, 10, 4, 10, 0, 0, 0, time.UTC)
+        created := s.AdvanceRecurring(ctx, now)
+        if len(created) != 1 || !created[0].DueAt.Equal(time.Date(2026, 10, 4, 9, 0, 0, 0, time.UTC)) {
+            t.Fatalf("expected a single occurrence due today, got %+v", created)
+        }
+        if task, _ := s.GetByID(1, first.ID); task.Done || task.Recurrence.NextAt != nil {
+            t.Errorf("expected previous occurrence to stay open without schedule, got %+v", task)
+        }
+        if again := s.AdvanceRecurring(ctx, now); len(again) != 0 {
+            t.Errorf("expected second pass to be a no-op, got %+v", again)
+        }
+    })
+
+    t.Run("Recurring subtask keeps parent open", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+        s := recurringStore(&now)
+        root := mustCreate(t, s, models.Task{Title: "chores", UserID: 1})
+        chore := mustCreate(t, s, models.Task{Title: "vacuum", UserID: 1, ParentID: &root.ID, Recurrence: recurring("@weekly")})
+
+        s.Update(ctx, 1, chore.ID, done(true), 0)
+        if task, _ := s.GetByID(1, root.ID); task.Done {
+            t.Error("expected parent to stay open while the series continues")
+        }
+        tree, _ := s.Tree(1, root.ID)
+        if tree.SubtasksTotal != 2 || tree.SubtasksDone != 1 {
+            t.Errorf("expected next occurrence under the same parent, got %d/%d", tree.SubtasksDone, tree.SubtasksTotal)
+        }
+    })
+
+    t.Run("Ended series creates nothing", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+        s := recurringStore(&now)
+        due := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+        task := mustCreate(t, s, models.Task{Title: "once", UserID: 1, DueAt: &due, Recurrence: recurring("FREQ=DAILY;COUNT=1")})
+        if task.Recurrence.NextAt != nil {
+            t.Fatalf("expected no next occurrence, got %v", task.Recurrence.NextAt)
+        }
+        s.Update(ctx, 1, task.ID, done(true), 0)
+        if count := s.Count(); count != 1 {
+            t.Errorf("expected no new occurrence, got %d tasks", count)
+        }
+    })
+
+    t.Run("Restored series state is kept", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+        s := recurringStore(&now)
+        start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+        due := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+        nextAt := due.AddDate(0, 0, 1)
+
+        head := mustCreate(t, s, models.Task{Title: "report", UserID: 1, DueAt: &due,
+            Recurrence: &models.Recurrence{Rule: "FREQ=DAILY", Start: start, NextAt: &nextAt}})
+        //закрытое вхождение уже передало серию и не должно создать следующее
+        handed := mustCreate(t, s, models.Task{Title: "report", UserID: 1, Done: true, DueAt: &start,
+            Recurrence: &models.Recurrence{Rule: "FREQ=DAILY", Start: start, SeriesID: head.ID}})
+        if count := s.Count(); count != 2 {
+            t.Fatalf("expected no occurrence to be spawned, got %d tasks", count)
+        }
+        rec := head.Recurrence
+        if !rec.Start.Equal(start) || rec.NextAt == nil || !rec.NextAt.Equal(nextAt) || rec.SeriesID != head.ID {
+            t.Errorf("expected restored schedule to be kept, got %+v", rec)
+        }
+        if handed.Recurrence.NextAt != nil || handed.Recurrence.SeriesID != head.ID {
+            t.Errorf("expected handed over occurrence to stay inert, got %+v", handed.Recurrence)
+        }
+    })
+
+    t.Run("Restored series without next_at is scheduled from its due date", func(t *testing.T) {
+        now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+        s := recurringStore(&now)
+        start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+        due := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+        restored := mustCreate(t, s, models.Task{Title: "report", UserID: 1, DueAt: &due,
+            Recurrence: &models.Recurrence{Rule: "FREQ=DAILY", Start: start}})
+        rec := restored.Recurrence
+        if !rec.Start.Equal(start) || rec.NextAt == nil || !rec.NextAt.Equal(due.AddDate(0, 0, 1)) || rec.SeriesID != restored.ID {
+            t.Fatalf("expected next occurrence to be computed, got %+v", rec)
+        }
+
+        now = now.Add(2 * time.Hour)
+        if created := s.AdvanceRecurring(ctx, now); len(created) != 1 || !created[0].DueAt.Equal(due.AddDate(0, 0, 1)) {
+            t.Errorf("expected restored series to advance, got %+v", created)
+        }
+    })
+}
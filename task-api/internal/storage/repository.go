@@ -0,0 +1,48 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "task-api/internal/models"
+    "time"
+)
+
+var (
+    //ErrTaskNotFound - задачи нет или она принадлежит другому владельцу
+    ErrTaskNotFound = errors.New("task not found")
+    //ErrVersionMismatch - If-Match не совпал с текущей версией задачи
+    ErrVersionMismatch = errors.New("task version mismatch")
+)
+
+//TaskRepository описывает хранилище задач, от которого зависят хендлеры.
+//Все чтения и записи ограничены задачами владельца ownerID, Create берет его из task.UserID.
+//Мутации берут автора изменения для аудита из models.ActorFromContext(ctx).
+type TaskRepository interface {
+    //Create, Update и ApplyBulk проверяют parent_id и blocked_by и возвращают *LinkError
+    Create(ctx context.Context, task models.Task) (models.Task, error)
+    UpsertByExternalRef(ctx context.Context, task models.Task) (models.Task, models.UpsertResult, error)
+    GetByID(ownerID, id int) (models.Task, bool)
+    GetAllFiltered(ownerID int, query models.TaskQuery) (models.TaskPage, error)
+    //Search - полнотекстовый поиск с BM25, ошибка запроса - *search.QueryError
+    Search(ownerID int, query models.SearchQuery) (models.SearchResult, error)
+    //Tree отдает задачу с подзадачами, открытыми блокерами и прогрессом
+    Tree(ownerID, id int) (models.TaskTree, bool)
+    //Update и Delete с ifVersion != 0 проверяют версию под той же блокировкой,
+    //что и запись. При ErrVersionMismatch возвращается текущая задача.
+    Update(ctx context.Context, ownerID, id int, patch models.TaskPatch, ifVersion int) (models.Task, error)
+    Delete(ctx context.Context, ownerID, id int, ifVersion int) (models.Task, error)
+    //ApplyBulk выполняет пакет операций владельца, в atomic режиме все или ничего
+    ApplyBulk(ctx context.Context, ownerID int, ops []models.BulkOperation, atomic bool) ([]models.BulkResult, bool)
+    //AdvanceRecurring создает вхождения повторяющихся задач, чье время наступило к now
+    AdvanceRecurring(ctx context.Context, now time.Time) []models.Task
+    Count() int
+    OnChange(listener ChangeListener)
+    //Ping проверяет, что хранилище способно принимать записи, для /readyz
+    Ping() error
+    Close() error
+}
+
+var (
+    _ TaskRepository = (*TaskStore)(nil)
+    _ TaskRepository = (*FileTaskStore)(nil)
+)
@@ -0,0 +1,45 @@
+package storage
+
+import (
+    "task-api/internal/models"
+    "task-api/internal/search"
+)
+
+const (
+    DefaultSearchLimit = 20
+    MaxSearchLimit     = 100
+)
+
+//Search ищет по названию, описанию и тегам задач владельца, лучшие
+//совпадения первыми. Ошибка разбора запроса - *search.QueryError.
+func (s *TaskStore) Search(ownerID int, query models.SearchQuery) (models.SearchResult, error) {
+    q, err := search.Parse(query.Query)
+    if err != nil {
+        return models.SearchResult{}, err
+    }
+    limit := query.Limit
+    if limit <= 0 {
+        limit = DefaultSearchLimit
+    }
+
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    result := models.SearchResult{Query: query.Query, Hits: []models.SearchHit{}}
+    for _, hit := range s.index.Search(ownerID, q) {
+        task := s.tasks[hit.ID]
+        if query.Done != nil && task.Done != *query.Done {
+            continue
+        }
+        result.Total++
+        if result.Total <= query.Offset || len(result.Hits) >= limit {
+            continue
+        }
+        result.Hits = append(result.Hits, models.SearchHit{
+            Task:     task,
+            Score:    hit.Score,
+            Snippets: s.index.Snippets(ownerID, hit.ID, q),
+        })
+    }
+    return result, nil
+}
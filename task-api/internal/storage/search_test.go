@@ -0,0 +1,85 @@
+package storage
+
+import (
+    "path/filepath"
+    "testing"
+
+    "task-api/internal/models"
+)
+
+func searchIDs(t *testing.T, s TaskRepository, ownerID int, q string) []int {
+    t.Helper()
+    result, err := s.Search(ownerID, models.SearchQuery{Query: q})
+    if err != nil {
+        t.Fatalf("Search(%q): %v", q, err)
+    }
+    var ids []int
+    for _, hit := range result.Hits {
+        ids = append(ids, hit.Task.ID)
+    }
+    return ids
+}
+
+func TestSearchIndex(t *testing.T) {
+    t.Run("Follows updates, deletes and rollbacks", func(t *testing.T) {
+        s := NewTaskStore()
+        task := mustCreate(t, s, models.Task{Title: "buy milk", UserID: 1})
+
+        s.Update(ctx, 1, task.ID, title("buy bread"), 0)
+        if ids := searchIDs(t, s, 1, "milk"); len(ids) != 0 {
+            t.Errorf("expected renamed task to leave the index, got %v", ids)
+        }
+
+        s.ApplyBulk(ctx, 1, []models.BulkOperation{
+            {Op: models.BulkUpdate, ID: task.ID, Patch: title("buy cheese")},
+            {Op: models.BulkDelete, ID: 999},
+        }, true)
+        if ids := searchIDs(t, s, 1, "bread"); len(ids) != 1 {
+            t.Errorf("expected rolled back batch to restore the index, got %v", ids)
+        }
+
+        s.Delete(ctx, 1, task.ID, 0)
+        if ids := searchIDs(t, s, 1, "bread"); len(ids) != 0 {
+            t.Errorf("expected deleted task to leave the index, got %v", ids)
+        }
+    })
+
+    t.Run("Filters and pages results", func(t *testing.T) {
+        s := NewTaskStore()
+        for _, task := range []models.Task{
+            {Title: "report one", UserID: 1},
+            {Title: "report two", UserID: 1, Done: true},
+            {Title: "report three", UserID: 1},
+        } {
+            mustCreate(t, s, task)
+        }
+
+        open := false
+        result, _ := s.Search(1, models.SearchQuery{Query: "report", Done: &open, Limit: 1, Offset: 1})
+        if result.Total != 2 || len(result.Hits) != 1 || result.Hits[0].Task.ID != 3 {
+            t.Errorf("unexpected page %+v", result)
+        }
+        if result.Hits[0].Snippets["title"] != "<mark>report</mark> three" {
+            t.Errorf("unexpected snippets %v", result.Hits[0].Snippets)
+        }
+    })
+
+    t.Run("File store rebuilds index on replay", func(t *testing.T) {
+        path := filepath.Join(t.TempDir(), "tasks.log")
+        s, err := NewFileTaskStore(path, 0)
+        if err != nil {
+            t.Fatal(err)
+        }
+        s.Create(ctx, models.Task{Title: "water plants", UserID: 1})
+        s.Close()
+
+        reopened, err := NewFileTaskStore(path, 0)
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer reopened.Close()
+        if ids := searchIDs(t, reopened, 1, "plant*"); len(ids) != 1 {
+            t.Errorf("expected replayed task to be searchable, got %v", ids)
+        }
+    })
+}
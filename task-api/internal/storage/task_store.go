@@ -1,39 +1,110 @@
 package storage
 
 import (
+    "context"
+    "errors"
+    "fmt"
     "sync"
     "task-api/internal/models"
+    "task-api/internal/search"
+    "time"
 )
 
 type TaskStore struct {
-    mu     sync.RWMutex
-    tasks  map[int]models.Task
-    nextID int
+    mu           sync.RWMutex
+    tasks        map[int]models.Task
+    externalRefs map[externalKey]int
+    //children и dependents - обратные индексы parent_id и blocked_by
+    children     map[int]map[int]bool
+    dependents   map[int]map[int]bool
+    nextID       int
+    listeners    []ChangeListener
+    now          func() time.Time
+    //index - полнотекстовый индекс, обновляется вместе с tasks
+    index        *search.Index
+}
+
+//ChangeListener получает каждую мутацию задачи. Вызывается под блокировкой
+//хранилища, поэтому порядок событий совпадает с порядком изменений, а сам
+//слушатель должен быстро возвращаться и не обращаться к хранилищу.
+type ChangeListener func(change models.TaskChange)
+
+//externalKey - индекс задач, импортированных из внешнего API, в пределах владельца
+type externalKey struct {
+    ownerID int
+    ref     string
 }
 
 func NewTaskStore() *TaskStore {
     return &TaskStore{
-        tasks:  make(map[int]models.Task),
-        nextID: 1,
+        tasks:        make(map[int]models.Task),
+        externalRefs: make(map[externalKey]int),
+        children:     make(map[int]map[int]bool),
+        dependents:   make(map[int]map[int]bool),
+        nextID:       1,
+        now:          time.Now,
+        index:        search.NewIndex(),
     }
 }
 
-func (s *TaskStore) Create(task models.Task) models.Task {
+func (s *TaskStore) Create(ctx context.Context, task models.Task) (models.Task, error) {
     s.mu.Lock()
     defer s.mu.Unlock()
     
-    task.ID = s.nextID
-    s.tasks[task.ID] = task
-    s.nextID++
-    return task
+    changes, err := s.createLocked(task, s.now().UTC())
+    if err != nil {
+        return models.Task{}, err
+    }
+    s.notifyLocked(ctx, changes...)
+    return changes[0].Task, nil
+}
+
+//UpsertByExternalRef создает задачу по task.ExternalRef или обновляет у найденной
+//название и статус. Поиск и запись идут под одной блокировкой, поэтому
+//параллельные импорты не создают дублей.
+func (s *TaskStore) UpsertByExternalRef(ctx context.Context, task models.Task) (models.Task, models.UpsertResult, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    now := s.now().UTC()
+    id, exists := s.externalRefs[externalKey{ownerID: task.UserID, ref: task.ExternalRef}]
+    if !exists {
+        changes, err := s.createLocked(task, now)
+        if err != nil {
+            return models.Task{}, "", err
+        }
+        s.notifyLocked(ctx, changes...)
+        return changes[0].Task, models.UpsertCreated, nil
+    }
+    
+    existing := s.tasks[id]
+    //закрыть по импорту можно только задачу без открытых блокеров
+    if task.Done && !existing.Done && len(s.openBlockersLocked(existing)) > 0 {
+        task.Done = existing.Done
+    }
+    if existing.Title == task.Title && existing.Done == task.Done {
+        return existing, models.UpsertUnchanged, nil
+    }
+    
+    title, done := task.Title, task.Done
+    updated, changes, err := s.updateLocked(task.UserID, id, models.TaskPatch{Title: &title, Done: &done}, 0, now)
+    if err != nil {
+        return models.Task{}, "", err
+    }
+    s.notifyLocked(ctx, changes...)
+    return updated, models.UpsertUpdated, nil
 }
 
-func (s *TaskStore) GetByID(id int) (models.Task, bool) {
+//GetByID отдает задачу только ее владельцу, чужие задачи выглядят как несуществующие
+func (s *TaskStore) GetByID(ownerID, id int) (models.Task, bool) {
     s.mu.RLock()
     defer s.mu.RUnlock()
     
     task, exists := s.tasks[id]
-    return task, exists
+    if !exists || task.UserID != ownerID {
+        return models.Task{}, false
+    }
+    return task, true
 }
 
 func (s *TaskStore) GetAll() []models.Task {
@@ -47,47 +118,340 @@ func (s *TaskStore) GetAll() []models.Task {
     return tasks
 }
 
-func (s *TaskStore) GetAllFiltered(doneFilter *bool) []models.Task {
+func (s *TaskStore) GetAllFiltered(ownerID int, query models.TaskQuery) (models.TaskPage, error) {
     s.mu.RLock()
-    defer s.mu.RUnlock()
-    
     tasks := make([]models.Task, 0, len(s.tasks))
     for _, task := range s.tasks {
-        if doneFilter == nil || task.Done == *doneFilter {
+        if task.UserID == ownerID && matchesFilter(task, query.Filter) {
             tasks = append(tasks, task)
         }
     }
-    return tasks
+    s.mu.RUnlock()
+    
+    return paginate(tasks, query)
 }
 
-func (s *TaskStore) Update(id int, done bool) (models.Task, bool) {
+func (s *TaskStore) Update(ctx context.Context, ownerID, id int, patch models.TaskPatch, ifVersion int) (models.Task, error) {
     s.mu.Lock()
     defer s.mu.Unlock()
     
-    task, exists := s.tasks[id]
-    if !exists {
-        return models.Task{}, false
+    task, changes, err := s.updateLocked(ownerID, id, patch, ifVersion, s.now().UTC())
+    if err != nil {
+        return task, err
     }
+    s.notifyLocked(ctx, changes...)
+    return task, nil
+}
+
+func (s *TaskStore) Delete(ctx context.Context, ownerID, id int, ifVersion int) (models.Task, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
     
-    task.Done = done
-    s.tasks[id] = task
-    return task, true
+    task, changes, err := s.deleteTaskLocked(ownerID, id, ifVersion, s.now().UTC())
+    if err != nil {
+        return task, err
+    }
+    s.notifyLocked(ctx, changes...)
+    return task, nil
+}
+
+//createLocked добавляет задачу. Первое изменение в ответе - сама задача,
+//дальше идут вызванные ею изменения других задач.
+func (s *TaskStore) createLocked(task models.Task, now time.Time) ([]models.TaskChange, error) {
+    task.ID = s.nextID
+    if task.Priority == "" {
+        task.Priority = models.PriorityNormal
+    }
+    if err := s.checkLinksLocked(task, nil); err != nil {
+        return nil, err
+    }
+    
+    if !s.handedOverLocked(task) {
+        schedule(&task, nil, now)
+    }
+    var next *models.Task
+    if task.Done {
+        next = handOver(&task, now)
+    }
+    
+    task.Version = 1
+    task.CreatedAt = now
+    task.UpdatedAt = now
+    s.insertLocked(task)
+    
+    changes := []models.TaskChange{{Type: models.TaskCreated, Task: task}}
+    changes = s.spawnLocked(changes, next, now)
+    return s.rollupLocked(changes, nil, &task, now), nil
+}
+
+//updateLocked накладывает патч. При ошибке возвращает текущее состояние задачи.
+func (s *TaskStore) updateLocked(ownerID, id int, patch models.TaskPatch, ifVersion int, now time.Time) (models.Task, []models.TaskChange, error) {
+    task, err := s.checkLocked(ownerID, id, ifVersion)
+    if err != nil {
+        return task, nil, err
+    }
+    
+    previous := task
+    patch.Apply(&task)
+    if err := s.checkLinksLocked(task, &previous); err != nil {
+        return previous, nil, err
+    }
+    
+    schedule(&task, &previous, now)
+    //закрытое вхождение сразу создает следующее, не дожидаясь его времени
+    var next *models.Task
+    if task.Done && !previous.Done {
+        next = handOver(&task, now)
+    }
+    
+    task.Version++
+    task.UpdatedAt = now
+    s.insertLocked(task)
+    
+    changes := []models.TaskChange{{Type: models.TaskUpdated, Task: task, Previous: &previous}}
+    changes = s.spawnLocked(changes, next, now)
+    return task, s.rollupLocked(changes, &previous, &task, now), nil
+}
+
+//spawnLocked создает следующее вхождение серии до rollup, чтобы родитель
+//повторяющейся подзадачи не закрылся
+func (s *TaskStore) spawnLocked(changes []models.TaskChange, next *models.Task, now time.Time) []models.TaskChange {
+    if next == nil {
+        return changes
+    }
+    spawned, err := s.createLocked(*next, now)
+    if err != nil {
+        return changes
+    }
+    return append(changes, spawned...)
+}
+
+//deleteTaskLocked удаляет задачу и отвязывает от нее подзадачи и зависимые задачи
+func (s *TaskStore) deleteTaskLocked(ownerID, id int, ifVersion int, now time.Time) (models.Task, []models.TaskChange, error) {
+    task, err := s.checkLocked(ownerID, id, ifVersion)
+    if err != nil {
+        return task, nil, err
+    }
+    
+    s.deleteLocked(id)
+    changes := []models.TaskChange{{Type: models.TaskDeleted, Task: task, Previous: &task}}
+    changes = s.detachLocked(changes, id, now)
+    return task, s.rollupLocked(changes, &task, nil, now), nil
+}
+
+//checkLocked находит задачу владельца и сверяет версию, если она задана
+func (s *TaskStore) checkLocked(ownerID, id int, ifVersion int) (models.Task, error) {
+    task, exists := s.tasks[id]
+    if !exists || task.UserID != ownerID {
+        return models.Task{}, ErrTaskNotFound
+    }
+    if ifVersion != 0 && task.Version != ifVersion {
+        return task, ErrVersionMismatch
+    }
+    return task, nil
 }
 
-func (s *TaskStore) Delete(id int) bool {
+//ApplyBulk выполняет пакет операций владельца под одной блокировкой. В atomic
+//режиме первая неудачная операция откатывает уже примененные, и слушатели не
+//видят ни одного изменения; иначе неудачные операции просто пропускаются.
+//Возвращает результаты по операциям и признак, что пакет применен.
+func (s *TaskStore) ApplyBulk(ctx context.Context, ownerID int, ops []models.BulkOperation, atomic bool) ([]models.BulkResult, bool) {
     s.mu.Lock()
     defer s.mu.Unlock()
     
-    if _, exists := s.tasks[id]; !exists {
-        return false
+    now := s.now().UTC()
+    startNextID := s.nextID
+    results := make([]models.BulkResult, len(ops))
+    changes := make([]models.TaskChange, 0, len(ops))
+    applied := 0
+    failed := -1
+    
+    for i, op := range ops {
+        results[i] = models.BulkResult{Index: i, Op: op.Op, ID: op.ID}
+        current, opChanges, err := s.applyLocked(ownerID, op, now)
+        if err != nil {
+            results[i].Status = models.BulkStatusFailed
+            results[i].Error = bulkError(op, current, err)
+            if atomic {
+                failed = i
+                break
+            }
+            continue
+        }
+        
+        //первое изменение - сама операция, остальные - ее последствия
+        task := opChanges[0].Task
+        results[i].ID = task.ID
+        switch opChanges[0].Type {
+        case models.TaskCreated:
+            results[i].Status = models.BulkStatusCreated
+            results[i].Task = &task
+        case models.TaskUpdated:
+            results[i].Status = models.BulkStatusUpdated
+            results[i].Task = &task
+        case models.TaskDeleted:
+            results[i].Status = models.BulkStatusDeleted
+        }
+        changes = append(changes, opChanges...)
+        applied++
     }
     
-    delete(s.tasks, id)
-    return true
+    if failed >= 0 {
+        //откатываем в обратном порядке, чтобы цепочки изменений одной задачи распутались
+        for i := len(changes) - 1; i >= 0; i-- {
+            change := changes[i]
+            if change.Previous == nil {
+                s.deleteLocked(change.Task.ID)
+            } else {
+                s.insertLocked(*change.Previous)
+            }
+        }
+        s.nextID = startNextID
+        
+        for i := range results {
+            if i != failed {
+                results[i] = models.BulkResult{Index: i, Op: ops[i].Op, ID: ops[i].ID, Status: models.BulkStatusSkipped}
+            }
+        }
+        return results, false
+    }
+    
+    s.notifyLocked(ctx, changes...)
+    return results, applied > 0
+}
+
+//applyLocked выполняет одну операцию пакета. При несовпадении версии
+//возвращает текущее состояние задачи.
+func (s *TaskStore) applyLocked(ownerID int, op models.BulkOperation, now time.Time) (models.Task, []models.TaskChange, error) {
+    switch op.Op {
+    case models.BulkCreate:
+        task := models.Task{UserID: ownerID}
+        op.Patch.Apply(&task)
+        changes, err := s.createLocked(task, now)
+        return models.Task{}, changes, err
+    case models.BulkDelete:
+        return s.deleteTaskLocked(ownerID, op.ID, op.IfVersion, now)
+    default:
+        return s.updateLocked(ownerID, op.ID, op.Patch, op.IfVersion, now)
+    }
+}
+
+func bulkError(op models.BulkOperation, current models.Task, err error) string {
+    switch {
+    case errors.Is(err, ErrVersionMismatch):
+        return fmt.Sprintf("task %d is at version %d, expected %d", op.ID, current.Version, op.IfVersion)
+    case errors.Is(err, ErrTaskNotFound):
+        return fmt.Sprintf("task with id %d does not exist", op.ID)
+    }
+    return err.Error()
 }
 
 func (s *TaskStore) Count() int {
     s.mu.RLock()
     defer s.mu.RUnlock()
     return len(s.tasks)
+}
+
+//OnChange подписывает слушателя на создание, изменение и удаление задач.
+//Восстановление из лога файлового хранилища событий не порождает.
+func (s *TaskStore) OnChange(listener ChangeListener) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    s.listeners = append(s.listeners, listener)
+}
+
+//notifyLocked дополняет изменения автором из контекста и временем
+func (s *TaskStore) notifyLocked(ctx context.Context, changes ...models.TaskChange) {
+    actor := models.ActorFromContext(ctx)
+    for _, change := range changes {
+        change.Actor = actor
+        change.At = change.Task.UpdatedAt
+        if change.Type == models.TaskDeleted {
+            change.At = s.now().UTC()
+        }
+        for _, listener := range s.listeners {
+            listener(change)
+        }
+    }
+}
+
+//Ping берет блокировку, так что зависшее хранилище не пройдет проверку готовности
+func (s *TaskStore) Ping() error {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return nil
+}
+
+//Close ничего не делает, in-memory хранилищу нечего сбрасывать
+func (s *TaskStore) Close() error {
+    return nil
+}
+
+//put кладет задачу с уже известным ID, используется при восстановлении из лога
+func (s *TaskStore) put(task models.Task) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    //записи из логов до появления версий
+    if task.Version == 0 {
+        task.Version = 1
+    }
+    s.insertLocked(task)
+}
+
+//remove удаляет задачу без проверки владельца, используется при восстановлении из лога
+func (s *TaskStore) remove(id int) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    s.deleteLocked(id)
+}
+
+func (s *TaskStore) insertLocked(task models.Task) {
+    if old, exists := s.tasks[task.ID]; exists {
+        if old.ExternalRef != "" {
+            delete(s.externalRefs, externalKey{ownerID: old.UserID, ref: old.ExternalRef})
+        }
+        s.unindexLinksLocked(old)
+    }
+    
+    s.tasks[task.ID] = task
+    s.index.Put(task)
+    if task.ExternalRef != "" {
+        s.externalRefs[externalKey{ownerID: task.UserID, ref: task.ExternalRef}] = task.ID
+    }
+    s.indexLinksLocked(task)
+    if task.ID >= s.nextID {
+        s.nextID = task.ID + 1
+    }
+}
+
+func (s *TaskStore) deleteLocked(id int) {
+    task, exists := s.tasks[id]
+    if !exists {
+        return
+    }
+    
+    if task.ExternalRef != "" {
+        delete(s.externalRefs, externalKey{ownerID: task.UserID, ref: task.ExternalRef})
+    }
+    s.unindexLinksLocked(task)
+    s.index.Remove(task.UserID, id)
+    delete(s.tasks, id)
+}
+
+func (s *TaskStore) setNextID(nextID int) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    if nextID > s.nextID {
+        s.nextID = nextID
+    }
+}
+
+func (s *TaskStore) getNextID() int {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.nextID
 }
\ No newline at end of file
@@ -0,0 +1,159 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "task-api/internal/models"
+)
+
+var ctx = context.Background()
+
+func mustCreate(t *testing.T, s TaskRepository, task models.Task) models.Task {
+    t.Helper()
+    created, err := s.Create(ctx, task)
+    if err != nil {
+        t.Fatalf("expected no error on create, got %v", err)
+    }
+    return created
+}
+
+func title(s string) models.TaskPatch {
+    return models.TaskPatch{Title: &s}
+}
+
+func TestApplyBulk(t *testing.T) {
+    t.Run("Atomic batch rolls back on failure", func(t *testing.T) {
+        s := NewTaskStore()
+        existing := mustCreate(t, s, models.Task{Title: "keep", UserID: 1})
+        foreign := mustCreate(t, s, models.Task{Title: "foreign", UserID: 2})
+
+        var changes []models.TaskChange
+        s.OnChange(func(change models.TaskChange) { changes = append(changes, change) })
+
+        results, applied := s.ApplyBulk(ctx, 1, []models.BulkOperation{
+            {Op: models.BulkCreate, Patch: title("new")},
+            {Op: models.BulkUpdate, ID: existing.ID, Patch: title("renamed")},
+            {Op: models.BulkDelete, ID: existing.ID},
+            {Op: models.BulkUpdate, ID: foreign.ID, Patch: title("stolen")},
+        }, true)
+
+        if applied {
+            t.Fatal("expected batch not to be applied")
+        }
+        if results[3].Status != models.BulkStatusFailed || results[0].Status != models.BulkStatusSkipped {
+            t.Errorf("unexpected results: %+v", results)
+        }
+        if task, ok := s.GetByID(1, existing.ID); !ok || task.Title != "keep" {
+            t.Errorf("expected task to be restored, got %+v", task)
+        }
+        if s.Count() != 2 || len(changes) != 0 {
+            t.Errorf("expected untouched store and no events, got count=%d events=%d", s.Count(), len(changes))
+        }
+
+        created := mustCreate(t, s, models.Task{Title: "next", UserID: 1})
+        if created.ID != foreign.ID+1 {
+            t.Errorf("expected rolled back ids to be reused, got %d", created.ID)
+        }
+    })
+
+    t.Run("Best effort applies valid operations", func(t *testing.T) {
+        s := NewTaskStore()
+        existing := mustCreate(t, s, models.Task{Title: "old", UserID: 1})
+
+        var changes []models.TaskChange
+        s.OnChange(func(change models.TaskChange) { changes = append(changes, change) })
+
+        results, applied := s.ApplyBulk(ctx, 1, []models.BulkOperation{
+            {Op: models.BulkDelete, ID: 99},
+            {Op: models.BulkCreate, Patch: title("new")},
+            {Op: models.BulkDelete, ID: existing.ID},
+        }, false)
+
+        if !applied {
+            t.Fatal("expected batch to be applied")
+        }
+        if results[0].Status != models.BulkStatusFailed || results[1].Status != models.BulkStatusCreated || results[2].Status != models.BulkStatusDeleted {
+            t.Errorf("unexpected results: %+v", results)
+        }
+        if results[1].Task == nil || results[1].Task.Priority != models.PriorityNormal {
+            t.Errorf("expected created task with default priority, got %+v", results[1].Task)
+        }
+        if len(changes) != 2 || changes[0].Type != models.TaskCreated || changes[1].Type != models.TaskDeleted {
+            t.Errorf("expected created and deleted events, got %+v", changes)
+        }
+    })
+}
+
+func TestVersionPreconditions(t *testing.T) {
+    s := NewTaskStore()
+    task := mustCreate(t, s, models.Task{Title: "v", UserID: 1})
+    if task.Version != 1 {
+        t.Fatalf("expected version 1 on create, got %d", task.Version)
+    }
+
+    updated, err := s.Update(ctx, 1, task.ID, title("v2"), 1)
+    if err != nil || updated.Version != 2 {
+        t.Fatalf("expected update to version 2, got %d, %v", updated.Version, err)
+    }
+
+    current, err := s.Update(ctx, 1, task.ID, title("stale"), 1)
+    if err != ErrVersionMismatch || current.Version != 2 || current.Title != "v2" {
+        t.Errorf("expected mismatch with current task, got %+v, %v", current, err)
+    }
+    if _, err := s.Delete(ctx, 1, task.ID, 1); err != ErrVersionMismatch {
+        t.Errorf("expected delete to check version, got %v", err)
+    }
+    if _, err := s.Delete(ctx, 2, task.ID, 0); err != ErrTaskNotFound {
+        t.Errorf("expected foreign task to be hidden, got %v", err)
+    }
+    if _, err := s.Delete(ctx, 1, task.ID, 2); err != nil {
+        t.Errorf("expected delete with current version, got %v", err)
+    }
+}
+
+func TestUpsertByExternalRef(t *testing.T) {
+    s := NewTaskStore()
+    upsert := func(task models.Task) (models.Task, models.UpsertResult) {
+        t.Helper()
+        task.ExternalRef = "todos/1"
+        upserted, result, err := s.UpsertByExternalRef(ctx, task)
+        if err != nil {
+            t.Fatalf("expected no error on upsert, got %v", err)
+        }
+        return upserted, result
+    }
+
+    created, result := upsert(models.Task{Title: "buy milk", UserID: 1})
+    if result != models.UpsertCreated || created.ExternalRef != "todos/1" {
+        t.Fatalf("expected created task, got %s %+v", result, created)
+    }
+
+    if same, result := upsert(models.Task{Title: "buy milk", UserID: 1}); result != models.UpsertUnchanged || same.Version != 1 {
+        t.Errorf("expected unchanged task, got %s %+v", result, same)
+    }
+
+    updated, result := upsert(models.Task{Title: "buy oat milk", Done: true, UserID: 1})
+    if result != models.UpsertUpdated || updated.ID != created.ID || !updated.Done || updated.Version != 2 {
+        t.Errorf("expected update of the same task, got %s %+v", result, updated)
+    }
+
+    //тот же external_ref у другого владельца - другая задача
+    foreign, result := upsert(models.Task{Title: "buy oat milk", Done: true, UserID: 2})
+    if result != models.UpsertCreated || foreign.ID == created.ID {
+        t.Errorf("expected separate task for another owner, got %s %+v", result, foreign)
+    }
+    if task, _ := s.GetByID(1, created.ID); task.Version != 2 || s.Count() != 2 {
+        t.Errorf("expected owner's task to stay untouched, got %+v", task)
+    }
+
+    t.Run("Create failure is returned", func(t *testing.T) {
+        missing := 99
+        _, _, err := s.UpsertByExternalRef(ctx, models.Task{Title: "orphan", UserID: 1, ParentID: &missing, ExternalRef: "todos/2"})
+        var linkErr *LinkError
+        if !errors.As(err, &linkErr) || s.Count() != 2 {
+            t.Errorf("expected *LinkError and no new task, got %v", err)
+        }
+    })
+}
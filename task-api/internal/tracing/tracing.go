@@ -0,0 +1,169 @@
+package tracing
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "github.com/google/uuid"
+    "net/http"
+    "strings"
+)
+
+const (
+    HeaderRequestID   = "X-Request-ID"
+    HeaderTraceparent = "traceparent"
+    HeaderTracestate  = "tracestate"
+
+    maxRequestIDLength = 128
+)
+
+type contextKey string
+
+const (
+    requestIDKey contextKey = "request_id"
+    spanKey      contextKey = "span"
+)
+
+//SpanContext - W3C trace context текущего запроса
+type SpanContext struct {
+    TraceID [16]byte
+    SpanID  [8]byte
+    Flags   byte
+    State   string
+}
+
+func (sc SpanContext) TraceIDString() string {
+    return hex.EncodeToString(sc.TraceID[:])
+}
+
+func (sc SpanContext) SpanIDString() string {
+    return hex.EncodeToString(sc.SpanID[:])
+}
+
+//Traceparent форматирует заголовок версии 00
+func (sc SpanContext) Traceparent() string {
+    return fmt.Sprintf("00-%s-%s-%02x", sc.TraceIDString(), sc.SpanIDString(), sc.Flags)
+}
+
+//ParseTraceparent разбирает заголовок traceparent. Нулевые ID и версия ff невалидны,
+//у будущих версий читаем только первые четыре поля, как требует спецификация.
+func ParseTraceparent(value string) (SpanContext, bool) {
+    var sc SpanContext
+    value = strings.TrimSpace(value)
+    if len(value) < 55 {
+        return sc, false
+    }
+
+    version, err := hex.DecodeString(value[0:2])
+    if err != nil || version[0] == 0xff || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+        return sc, false
+    }
+    if version[0] == 0 && len(value) != 55 {
+        return sc, false
+    }
+    if version[0] != 0 && len(value) > 55 && value[55] != '-' {
+        return sc, false
+    }
+
+    if !isLowerHex(value[3:35]) || !isLowerHex(value[36:52]) || !isLowerHex(value[53:55]) {
+        return sc, false
+    }
+
+    hex.Decode(sc.TraceID[:], []byte(value[3:35]))
+    hex.Decode(sc.SpanID[:], []byte(value[36:52]))
+    flags, _ := hex.DecodeString(value[53:55])
+    sc.Flags = flags[0]
+
+    if sc.TraceID == [16]byte{} || sc.SpanID == [8]byte{} {
+        return SpanContext{}, false
+    }
+    return sc, true
+}
+
+//NewSpan продолжает трейс родителя с новым span ID или начинает новый трейс
+func NewSpan(parent *SpanContext) SpanContext {
+    var sc SpanContext
+    if parent != nil {
+        sc.TraceID = parent.TraceID
+        sc.Flags = parent.Flags
+        sc.State = parent.State
+    } else {
+        randomBytes(sc.TraceID[:])
+        sc.Flags = 0x01
+    }
+    randomBytes(sc.SpanID[:])
+    return sc
+}
+
+//NewRequestID генерирует UUIDv7: ID сортируются по времени, в том числе
+//внутри одной миллисекунды, и не совпадают при параллельных запросах
+func NewRequestID() string {
+    //ошибку дает только crypto/rand, а он в Go 1.24+ не возвращает ошибок
+    id, _ := uuid.NewV7()
+    return id.String()
+}
+
+//ValidRequestID пропускает входящие ID разумной длины из безопасных символов,
+//чтобы клиент не мог протащить в логи переводы строк и мусор
+func ValidRequestID(id string) bool {
+    if id == "" || len(id) > maxRequestIDLength {
+        return false
+    }
+    for _, c := range id {
+        switch {
+        case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+        case c == '-', c == '_', c == '.', c == ':':
+        default:
+            return false
+        }
+    }
+    return true
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, requestIDKey, id)
+}
+
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+    id, ok := ctx.Value(requestIDKey).(string)
+    return id, ok
+}
+
+func WithSpan(ctx context.Context, sc SpanContext) context.Context {
+    return context.WithValue(ctx, spanKey, sc)
+}
+
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+    sc, ok := ctx.Value(spanKey).(SpanContext)
+    return sc, ok
+}
+
+//Inject проставляет X-Request-ID, traceparent и tracestate для исходящего запроса.
+//Текущий span становится родителем вызова.
+func Inject(ctx context.Context, header http.Header) {
+    if id, ok := RequestIDFromContext(ctx); ok {
+        header.Set(HeaderRequestID, id)
+    }
+    if sc, ok := SpanFromContext(ctx); ok {
+        header.Set(HeaderTraceparent, sc.Traceparent())
+        if sc.State != "" {
+            header.Set(HeaderTracestate, sc.State)
+        }
+    }
+}
+
+func isLowerHex(s string) bool {
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+            return false
+        }
+    }
+    return true
+}
+
+func randomBytes(b []byte) {
+    //crypto/rand.Read в Go 1.24+ не возвращает ошибок
+    rand.Read(b)
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+    "context"
+    "net/http"
+    "regexp"
+    "testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+    cases := []struct {
+        name  string
+        value string
+        valid bool
+    }{
+        {"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+        {"future version with extra fields", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+        {"version 00 with extra fields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+        {"forbidden version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+        {"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+        {"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+        {"uppercase hex", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+        {"too short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+        {"empty", "", false},
+    }
+
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            sc, ok := ParseTraceparent(tc.value)
+            if ok != tc.valid {
+                t.Fatalf("expected valid=%v, got %v", tc.valid, ok)
+            }
+            if ok && tc.value[:2] == "00" && sc.Traceparent() != tc.value {
+                t.Errorf("expected round trip %q, got %q", tc.value, sc.Traceparent())
+            }
+        })
+    }
+}
+
+func TestNewRequestID(t *testing.T) {
+    uuidV7 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+    //ID идут по возрастанию и внутри одной миллисекунды, так что дубль тоже поймается
+    previous := ""
+    for i := 0; i < 10000; i++ {
+        id := NewRequestID()
+        if !uuidV7.MatchString(id) {
+            t.Fatalf("expected UUIDv7, got %q", id)
+        }
+        if id <= previous {
+            t.Fatalf("expected %q to sort after %q", id, previous)
+        }
+        previous = id
+    }
+}
+
+func TestValidRequestID(t *testing.T) {
+    if !ValidRequestID("01HZX3J8Q2W6V9K7T5R4M1N0PB") {
+        t.Error("expected ULID to be accepted")
+    }
+    if ValidRequestID("bad id\nwith newline") {
+        t.Error("expected id with whitespace to be rejected")
+    }
+}
+
+func TestInject(t *testing.T) {
+    parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    parent.State = "vendor=value"
+    span := NewSpan(&parent)
+
+    ctx := WithSpan(WithRequestID(context.Background(), "req-1"), span)
+    header := http.Header{}
+    Inject(ctx, header)
+
+    if header.Get(HeaderRequestID) != "req-1" {
+        t.Errorf("expected request id to be forwarded, got %q", header.Get(HeaderRequestID))
+    }
+    forwarded, ok := ParseTraceparent(header.Get(HeaderTraceparent))
+    if !ok || forwarded.TraceID != parent.TraceID || forwarded.SpanID == parent.SpanID {
+        t.Errorf("expected same trace with new span, got %q", header.Get(HeaderTraceparent))
+    }
+    if header.Get(HeaderTracestate) != "vendor=value" {
+        t.Errorf("expected tracestate to be forwarded, got %q", header.Get(HeaderTracestate))
+    }
+}
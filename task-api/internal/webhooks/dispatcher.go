@@ -0,0 +1,538 @@
+package webhooks
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "math/rand"
+    "net"
+    "net/http"
+    "strconv"
+    "sync"
+    "syscall"
+    "task-api/internal/models"
+    "time"
+)
+
+type Config struct {
+    Workers     int
+    QueueSize   int
+    MaxAttempts int
+    Timeout     time.Duration
+    BaseBackoff time.Duration
+    MaxBackoff  time.Duration
+    //LogSize - сколько последних попыток и dead letters хранится на подписку
+    LogSize int
+    //AllowPrivateTargets разрешает доставку на loopback и внутренние сети.
+    //По умолчанию выключено, иначе подписка превращается в SSRF.
+    AllowPrivateTargets bool
+}
+
+func DefaultConfig() Config {
+    return Config{
+        Workers:     4,
+        QueueSize:   1000,
+        MaxAttempts: 6,
+        Timeout:     10 * time.Second,
+        BaseBackoff: time.Second,
+        MaxBackoff:  5 * time.Minute,
+        LogSize:     100,
+    }
+}
+
+type subscriptionState struct {
+    sub         Subscription
+    deliveries  []Delivery
+    deadLetters []DeadLetter
+}
+
+type job struct {
+    subscriptionID string
+    deliveryID     string
+    eventID        string
+    event          string
+    payload        []byte
+    attempt        int
+}
+
+//Dispatcher хранит подписки и доставляет события в фоне: очередь, пул
+//воркеров, ретраи с экспоненциальной задержкой через таймеры, чтобы ожидание
+//повтора не занимало воркер.
+type Dispatcher struct {
+    mu     sync.Mutex
+    subs   map[string]*subscriptionState
+    timers map[*time.Timer]struct{}
+    closed bool
+
+    cfg    Config
+    client *http.Client
+    queue  chan *job
+    wg     sync.WaitGroup
+    ctx    context.Context
+    cancel context.CancelFunc
+    now    func() time.Time
+    logger *slog.Logger
+}
+
+func NewDispatcher(cfg Config, logger *slog.Logger) *Dispatcher {
+    defaults := DefaultConfig()
+    if cfg.Workers <= 0 {
+        cfg.Workers = defaults.Workers
+    }
+    if cfg.QueueSize <= 0 {
+        cfg.QueueSize = defaults.QueueSize
+    }
+    if cfg.MaxAttempts <= 0 {
+        cfg.MaxAttempts = defaults.MaxAttempts
+    }
+    if cfg.LogSize <= 0 {
+        cfg.LogSize = defaults.LogSize
+    }
+    if logger == nil {
+        logger = slog.Default()
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    d := &Dispatcher{
+        subs:   make(map[string]*subscriptionState),
+        timers: make(map[*time.Timer]struct{}),
+        cfg:    cfg,
+        client: newClient(cfg),
+        queue:  make(chan *job, cfg.QueueSize),
+        ctx:    ctx,
+        cancel: cancel,
+        now:    time.Now,
+        logger: logger,
+    }
+
+    for i := 0; i < cfg.Workers; i++ {
+        d.wg.Add(1)
+        go d.worker()
+    }
+    return d
+}
+
+//newClient не ходит по редиректам и, если не разрешено явно, не соединяется
+//с внутренними адресами; проверка идет по уже разрешенному IP, так что DNS не обманет
+func newClient(cfg Config) *http.Client {
+    dialer := &net.Dialer{Timeout: 5 * time.Second}
+    if !cfg.AllowPrivateTargets {
+        dialer.Control = func(network, address string, _ syscall.RawConn) error {
+            host, _, err := net.SplitHostPort(address)
+            if err != nil {
+                return err
+            }
+            ip := net.ParseIP(host)
+            if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+                ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+                return fmt.Errorf("webhook target %s is not a public address", host)
+            }
+            return nil
+        }
+    }
+
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.DialContext = dialer.DialContext
+    transport.Proxy = nil
+
+    return &http.Client{
+        Timeout:   cfg.Timeout,
+        Transport: transport,
+        CheckRedirect: func(req *http.Request, via []*http.Request) error {
+            return http.ErrUseLastResponse
+        },
+    }
+}
+
+//Create регистрирует подписку. Пустой secret генерируется; секрет возвращается
+//один раз, дальше он нужен только для подписи.
+func (d *Dispatcher) Create(userID int, rawURL string, events []string, secret string) (Subscription, string, error) {
+    if secret == "" {
+        generated, err := generateSecret()
+        if err != nil {
+            return Subscription{}, "", err
+        }
+        secret = generated
+    }
+    id, err := generateID("wh_")
+    if err != nil {
+        return Subscription{}, "", err
+    }
+
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    count := 0
+    for _, state := range d.subs {
+        if state.sub.UserID == userID {
+            count++
+        }
+    }
+    if count >= MaxSubscriptionsPerUser {
+        return Subscription{}, "", ErrTooManySubscriptions
+    }
+
+    sub := Subscription{
+        ID:        id,
+        UserID:    userID,
+        URL:       rawURL,
+        Events:    normalizeEvents(events),
+        CreatedAt: d.now().UTC(),
+        secret:    secret,
+    }
+    d.subs[id] = &subscriptionState{sub: sub}
+    return sub, secret, nil
+}
+
+func (d *Dispatcher) List(userID int) []Subscription {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    subs := []Subscription{}
+    for _, state := range d.subs {
+        if state.sub.UserID == userID {
+            subs = append(subs, state.sub)
+        }
+    }
+    sortSubscriptions(subs)
+    return subs
+}
+
+//Get, как и хранилище задач, не отличает чужую подписку от несуществующей
+func (d *Dispatcher) Get(userID int, id string) (Subscription, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    state, err := d.ownedLocked(userID, id)
+    if err != nil {
+        return Subscription{}, err
+    }
+    return state.sub, nil
+}
+
+//Delete удаляет подписку; ее запланированные ретраи тихо отбрасываются
+func (d *Dispatcher) Delete(userID int, id string) error {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    if _, err := d.ownedLocked(userID, id); err != nil {
+        return err
+    }
+    delete(d.subs, id)
+    return nil
+}
+
+//Deliveries отдает журнал попыток, свежие сначала
+func (d *Dispatcher) Deliveries(userID int, id string) ([]Delivery, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    state, err := d.ownedLocked(userID, id)
+    if err != nil {
+        return nil, err
+    }
+    out := make([]Delivery, len(state.deliveries))
+    for i, delivery := range state.deliveries {
+        out[len(out)-1-i] = delivery
+    }
+    return out, nil
+}
+
+//DeadLetters отдает доставки, от которых отказались, свежие сначала
+func (d *Dispatcher) DeadLetters(userID int, id string) ([]DeadLetter, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    state, err := d.ownedLocked(userID, id)
+    if err != nil {
+        return nil, err
+    }
+    out := make([]DeadLetter, len(state.deadLetters))
+    for i, dl := range state.deadLetters {
+        out[len(out)-1-i] = dl
+    }
+    return out, nil
+}
+
+func (d *Dispatcher) ownedLocked(userID int, id string) (*subscriptionState, error) {
+    state, ok := d.subs[id]
+    if !ok || state.sub.UserID != userID {
+        return nil, ErrSubscriptionNotFound
+    }
+    return state, nil
+}
+
+//Handle подходит как storage.ChangeListener. Вызывается под блокировкой
+//хранилища, поэтому только ставит доставки в очередь и не ждет.
+func (d *Dispatcher) Handle(change models.TaskChange) {
+    events := eventsFor(change)
+    occurredAt := d.now().UTC()
+
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    if d.closed {
+        return
+    }
+
+    for _, event := range events {
+        var eventID string
+        for _, state := range d.subs {
+            if state.sub.UserID != change.Task.UserID || !state.sub.wants(event) {
+                continue
+            }
+
+            //один event_id на событие для всех подписок, чтобы получатель мог дедуплицировать
+            if eventID == "" {
+                id, err := generateID("evt_")
+                if err != nil {
+                    d.logger.Error("webhook event id generation failed", "error", err)
+                    return
+                }
+                eventID = id
+            }
+
+            payload, err := json.Marshal(Payload{
+                ID:         eventID,
+                Event:      event,
+                OccurredAt: occurredAt,
+                Task:       change.Task,
+                Previous:   change.Previous,
+            })
+            if err != nil {
+                d.logger.Error("webhook payload marshal failed", "error", err)
+                continue
+            }
+
+            deliveryID, err := generateID("dlv_")
+            if err != nil {
+                d.logger.Error("webhook delivery id generation failed", "error", err)
+                continue
+            }
+
+            d.enqueueLocked(&job{
+                subscriptionID: state.sub.ID,
+                deliveryID:     deliveryID,
+                eventID:        eventID,
+                event:          event,
+                payload:        payload,
+                attempt:        1,
+            })
+        }
+    }
+}
+
+//enqueueLocked не блокируется: при переполненной очереди доставка сразу
+//уходит в dead letters, а не тормозит запись задач
+func (d *Dispatcher) enqueueLocked(j *job) {
+    select {
+    case d.queue <- j:
+    default:
+        if state, ok := d.subs[j.subscriptionID]; ok {
+            d.deadLetterLocked(state, j, 0, "delivery queue is full")
+        }
+        d.logger.Warn("webhook queue full, delivery dead-lettered",
+            "subscription_id", j.subscriptionID, "delivery_id", j.deliveryID)
+    }
+}
+
+func (d *Dispatcher) worker() {
+    defer d.wg.Done()
+    for j := range d.queue {
+        d.deliver(j)
+    }
+}
+
+func (d *Dispatcher) deliver(j *job) {
+    d.mu.Lock()
+    state, ok := d.subs[j.subscriptionID]
+    var sub Subscription
+    if ok {
+        sub = state.sub
+    }
+    d.mu.Unlock()
+    if !ok {
+        return
+    }
+
+    start := d.now()
+    status, retryAfter, err := d.send(sub, j)
+    elapsed := d.now().Sub(start)
+
+    delivery := Delivery{
+        ID:          j.deliveryID,
+        EventID:     j.eventID,
+        Event:       j.event,
+        Attempt:     j.attempt,
+        StatusCode:  status,
+        DurationMS:  float64(elapsed.Microseconds()) / 1000,
+        AttemptedAt: start.UTC(),
+    }
+
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    state, ok = d.subs[j.subscriptionID]
+    if !ok {
+        return
+    }
+
+    if err == nil {
+        delivery.Outcome = OutcomeDelivered
+        d.recordLocked(state, delivery)
+        return
+    }
+    delivery.Error = err.Error()
+
+    if d.closed {
+        delivery.Outcome = OutcomeDropped
+        d.recordLocked(state, delivery)
+        return
+    }
+
+    if !retryable(status) || j.attempt >= d.cfg.MaxAttempts {
+        delivery.Outcome = OutcomeFailed
+        d.recordLocked(state, delivery)
+        d.deadLetterLocked(state, j, status, delivery.Error)
+        return
+    }
+
+    wait := d.backoff(j.attempt)
+    if retryAfter > wait && retryAfter <= d.cfg.MaxBackoff {
+        wait = retryAfter
+    }
+    next := d.now().Add(wait).UTC()
+    delivery.Outcome = OutcomeRetrying
+    delivery.NextRetryAt = &next
+    d.recordLocked(state, delivery)
+
+    retry := *j
+    retry.attempt++
+    var timer *time.Timer
+    timer = time.AfterFunc(wait, func() {
+        d.mu.Lock()
+        defer d.mu.Unlock()
+
+        delete(d.timers, timer)
+        if !d.closed {
+            d.enqueueLocked(&retry)
+        }
+    })
+    d.timers[timer] = struct{}{}
+}
+
+//send возвращает код ответа, Retry-After и ошибку для всего, что не 2xx
+func (d *Dispatcher) send(sub Subscription, j *job) (int, time.Duration, error) {
+    req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, sub.URL, bytes.NewReader(j.payload))
+    if err != nil {
+        return 0, 0, err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "task-api-webhooks/1")
+    req.Header.Set(HeaderEvent, j.event)
+    req.Header.Set(HeaderDelivery, j.deliveryID)
+    req.Header.Set(HeaderAttempt, strconv.Itoa(j.attempt))
+    req.Header.Set(HeaderSignature, Sign(sub.secret, d.now().Unix(), j.payload))
+
+    resp, err := d.client.Do(req)
+    if err != nil {
+        return 0, 0, err
+    }
+    defer resp.Body.Close()
+    //тело не нужно, но дочитываем немного, чтобы соединение вернулось в пул
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        return resp.StatusCode, 0, nil
+    }
+
+    var retryAfter time.Duration
+    if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+        retryAfter = time.Duration(seconds) * time.Second
+    }
+    return resp.StatusCode, retryAfter, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+}
+
+//retryable: сетевые ошибки, 408, 429 и 5xx. Остальные 3xx/4xx повтором не исправить.
+func retryable(status int) bool {
+    return status == 0 || status == http.StatusRequestTimeout ||
+        status == http.StatusTooManyRequests || status >= 500
+}
+
+//backoff - экспоненциальная задержка с джиттером в верхней половине интервала
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+    delay := d.cfg.BaseBackoff << (attempt - 1)
+    if delay <= 0 || delay > d.cfg.MaxBackoff {
+        delay = d.cfg.MaxBackoff
+    }
+    if delay <= 0 {
+        return 0
+    }
+    half := delay / 2
+    return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+func (d *Dispatcher) recordLocked(state *subscriptionState, delivery Delivery) {
+    state.deliveries = append(state.deliveries, delivery)
+    if over := len(state.deliveries) - d.cfg.LogSize; over > 0 {
+        state.deliveries = append([]Delivery(nil), state.deliveries[over:]...)
+    }
+}
+
+func (d *Dispatcher) deadLetterLocked(state *subscriptionState, j *job, status int, reason string) {
+    state.deadLetters = append(state.deadLetters, DeadLetter{
+        DeliveryID: j.deliveryID,
+        EventID:    j.eventID,
+        Event:      j.event,
+        Attempts:   j.attempt,
+        StatusCode: status,
+        LastError:  reason,
+        FailedAt:   d.now().UTC(),
+        Payload:    json.RawMessage(j.payload),
+    })
+    if over := len(state.deadLetters) - d.cfg.LogSize; over > 0 {
+        state.deadLetters = append([]DeadLetter(nil), state.deadLetters[over:]...)
+    }
+}
+
+//Close перестает принимать события, отменяет запланированные ретраи и ждет,
+//пока воркеры разберут очередь. По истечении ctx текущие запросы прерываются.
+func (d *Dispatcher) Close(ctx context.Context) error {
+    d.mu.Lock()
+    if d.closed {
+        d.mu.Unlock()
+        return nil
+    }
+    d.closed = true
+    pending := len(d.timers)
+    for timer := range d.timers {
+        timer.Stop()
+    }
+    d.timers = nil
+    close(d.queue)
+    d.mu.Unlock()
+
+    if pending > 0 {
+        d.logger.Warn("webhook retries dropped on shutdown", "pending", pending)
+    }
+
+    done := make(chan struct{})
+    go func() {
+        d.wg.Wait()
+        close(done)
+    }()
+
+    select {
+    case <-done:
+        d.cancel()
+        return nil
+    case <-ctx.Done():
+        d.cancel()
+        <-done
+        return errors.Join(ErrDispatcherClosed, ctx.Err())
+    }
+}
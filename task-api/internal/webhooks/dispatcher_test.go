@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "task-api/internal/models"
+)
+
+func testDispatcher(maxAttempts int, allowPrivate bool) *Dispatcher {
+    return NewDispatcher(Config{
+        Workers:             2,
+        QueueSize:           10,
+        MaxAttempts:         maxAttempts,
+        Timeout:             time.Second,
+        BaseBackoff:         time.Millisecond,
+        MaxBackoff:          5 * time.Millisecond,
+        AllowPrivateTargets: allowPrivate,
+    }, nil)
+}
+
+//waitFor опрашивает условие, доставки идут в фоне
+func waitFor(t *testing.T, cond func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(2 * time.Second)
+    for !cond() {
+        if time.Now().After(deadline) {
+            t.Fatal("condition not met in time")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func completeTask(d *Dispatcher, userID int) {
+    previous := models.Task{ID: 1, UserID: userID, Title: "t"}
+    task := previous
+    task.Done = true
+    d.Handle(models.TaskChange{Type: models.TaskUpdated, Task: task, Previous: &previous})
+}
+
+func TestDispatcher(t *testing.T) {
+    t.Run("Delivers signed completion event", func(t *testing.T) {
+        received := make(chan *http.Request, 1)
+        bodies := make(chan []byte, 1)
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            body, _ := io.ReadAll(r.Body)
+            received <- r
+            bodies <- body
+        }))
+        defer server.Close()
+
+        d := testDispatcher(3, true)
+        defer d.Close(context.Background())
+
+        sub, secret, err := d.Create(1, server.URL, []string{EventTaskCompleted}, "")
+        if err != nil {
+            t.Fatalf("expected no error, got %v", err)
+        }
+        completeTask(d, 1)
+
+        r := <-received
+        body := <-bodies
+        if r.Header.Get(HeaderEvent) != EventTaskCompleted {
+            t.Errorf("expected %s event, got %q", EventTaskCompleted, r.Header.Get(HeaderEvent))
+        }
+
+        signature := r.Header.Get(HeaderSignature)
+        ts, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+        timestamp, _ := strconv.ParseInt(ts, 10, 64)
+        if signature != Sign(secret, timestamp, body) {
+            t.Errorf("signature %q does not match body", signature)
+        }
+
+        waitFor(t, func() bool {
+            deliveries, _ := d.Deliveries(1, sub.ID)
+            return len(deliveries) == 1 && deliveries[0].Outcome == OutcomeDelivered
+        })
+    })
+
+    t.Run("Retries with backoff until success", func(t *testing.T) {
+        var calls int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if atomic.AddInt32(&calls, 1) < 3 {
+                w.WriteHeader(http.StatusServiceUnavailable)
+            }
+        }))
+        defer server.Close()
+
+        d := testDispatcher(5, true)
+        defer d.Close(context.Background())
+
+        sub, _, _ := d.Create(1, server.URL, []string{EventAll}, "")
+        d.Handle(models.TaskChange{Type: models.TaskCreated, Task: models.Task{ID: 1, UserID: 1}})
+
+        waitFor(t, func() bool {
+            deliveries, _ := d.Deliveries(1, sub.ID)
+            return len(deliveries) == 3 && deliveries[0].Outcome == OutcomeDelivered
+        })
+        deliveries, _ := d.Deliveries(1, sub.ID)
+        if deliveries[1].Outcome != OutcomeRetrying || deliveries[1].NextRetryAt == nil || deliveries[0].Attempt != 3 {
+            t.Errorf("unexpected delivery log: %+v", deliveries)
+        }
+    })
+
+    t.Run("Dead-letters after max attempts and on permanent errors", func(t *testing.T) {
+        status := int32(http.StatusInternalServerError)
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(int(atomic.LoadInt32(&status)))
+        }))
+        defer server.Close()
+
+        d := testDispatcher(2, true)
+        defer d.Close(context.Background())
+
+        sub, _, _ := d.Create(1, server.URL, []string{EventTaskCreated}, "")
+        d.Handle(models.TaskChange{Type: models.TaskCreated, Task: models.Task{ID: 1, UserID: 1}})
+        waitFor(t, func() bool {
+            dead, _ := d.DeadLetters(1, sub.ID)
+            return len(dead) == 1
+        })
+        dead, _ := d.DeadLetters(1, sub.ID)
+        if dead[0].Attempts != 2 || dead[0].StatusCode != 500 || len(dead[0].Payload) == 0 {
+            t.Errorf("unexpected dead letter: %+v", dead[0])
+        }
+
+        atomic.StoreInt32(&status, http.StatusGone)
+        d.Handle(models.TaskChange{Type: models.TaskCreated, Task: models.Task{ID: 2, UserID: 1}})
+        waitFor(t, func() bool {
+            dead, _ := d.DeadLetters(1, sub.ID)
+            return len(dead) == 2
+        })
+        dead, _ = d.DeadLetters(1, sub.ID)
+        if dead[0].Attempts != 1 {
+            t.Errorf("expected permanent error not to be retried, got %d attempts", dead[0].Attempts)
+        }
+    })
+
+    t.Run("Only owner's events and subscriptions", func(t *testing.T) {
+        var calls int32
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            atomic.AddInt32(&calls, 1)
+        }))
+        defer server.Close()
+
+        d := testDispatcher(1, true)
+        sub, _, _ := d.Create(1, server.URL, []string{EventAll}, "")
+        completeTask(d, 2)
+        d.Close(context.Background())
+
+        if atomic.LoadInt32(&calls) != 0 {
+            t.Errorf("expected no deliveries for foreign task, got %d", calls)
+        }
+        if _, err := d.Get(2, sub.ID); err != ErrSubscriptionNotFound {
+            t.Errorf("expected foreign subscription to be hidden, got %v", err)
+        }
+    })
+
+    t.Run("Blocks private targets by default", func(t *testing.T) {
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            t.Error("loopback target must not be reached")
+        }))
+        defer server.Close()
+
+        d := testDispatcher(1, false)
+        defer d.Close(context.Background())
+
+        sub, _, _ := d.Create(1, server.URL, []string{EventAll}, "")
+        d.Handle(models.TaskChange{Type: models.TaskDeleted, Task: models.Task{ID: 1, UserID: 1}})
+
+        waitFor(t, func() bool {
+            dead, _ := d.DeadLetters(1, sub.ID)
+            return len(dead) == 1 && strings.Contains(dead[0].LastError, "not a public address")
+        })
+    })
+}
+
+func TestEventsFor(t *testing.T) {
+    done := models.Task{Done: true}
+    open := models.Task{}
+
+    cases := []struct {
+        name     string
+        change   models.TaskChange
+        expected string
+    }{
+        {"created open", models.TaskChange{Type: models.TaskCreated, Task: open}, "task.created"},
+        {"created done", models.TaskChange{Type: models.TaskCreated, Task: done}, "task.created,task.completed"},
+        {"completed", models.TaskChange{Type: models.TaskUpdated, Task: done, Previous: &open}, "task.updated,task.completed"},
+        {"already done", models.TaskChange{Type: models.TaskUpdated, Task: done, Previous: &done}, "task.updated"},
+        {"deleted done", models.TaskChange{Type: models.TaskDeleted, Task: done, Previous: &done}, "task.deleted"},
+    }
+    for _, c := range cases {
+        if got := strings.Join(eventsFor(c.change), ","); got != c.expected {
+            t.Errorf("%s: expected %s, got %s", c.name, c.expected, got)
+        }
+    }
+}
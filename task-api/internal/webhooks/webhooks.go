@@ -0,0 +1,198 @@
+package webhooks
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/url"
+    "sort"
+    "strconv"
+    "task-api/internal/models"
+    "time"
+)
+
+const (
+    EventTaskCreated   = "task.created"
+    EventTaskUpdated   = "task.updated"
+    EventTaskDeleted   = "task.deleted"
+    EventTaskCompleted = "task.completed"
+    EventAll           = "*"
+)
+
+var knownEvents = map[string]bool{
+    EventTaskCreated:   true,
+    EventTaskUpdated:   true,
+    EventTaskDeleted:   true,
+    EventTaskCompleted: true,
+    EventAll:           true,
+}
+
+func ValidEvent(event string) bool {
+    return knownEvents[event]
+}
+
+const (
+    HeaderSignature = "X-Webhook-Signature"
+    HeaderEvent     = "X-Webhook-Event"
+    HeaderDelivery  = "X-Webhook-Delivery"
+    HeaderAttempt   = "X-Webhook-Attempt"
+
+    //MinSecretLength - короче секрет легко подобрать
+    MinSecretLength = 16
+    //MaxSubscriptionsPerUser ограничивает размножение доставок от одного владельца
+    MaxSubscriptionsPerUser = 20
+)
+
+const (
+    OutcomeDelivered = "delivered"
+    OutcomeRetrying  = "retrying"
+    OutcomeFailed    = "failed"
+    OutcomeDropped   = "dropped"
+)
+
+var (
+    ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+    ErrTooManySubscriptions = fmt.Errorf("at most %d webhook subscriptions per user", MaxSubscriptionsPerUser)
+    ErrDispatcherClosed     = errors.New("webhook dispatcher is closed")
+)
+
+//Subscription - подписка владельца на события его задач. Секрет наружу
+//отдается только при создании.
+type Subscription struct {
+    ID        string    `json:"id"`
+    UserID    int       `json:"userId"`
+    URL       string    `json:"url"`
+    Events    []string  `json:"events"`
+    CreatedAt time.Time `json:"created_at"`
+    secret    string
+}
+
+func (s Subscription) wants(event string) bool {
+    for _, e := range s.Events {
+        if e == EventAll || e == event {
+            return true
+        }
+    }
+    return false
+}
+
+//Delivery - одна попытка доставки в журнале подписки
+type Delivery struct {
+    ID          string     `json:"id"`
+    EventID     string     `json:"event_id"`
+    Event       string     `json:"event"`
+    Attempt     int        `json:"attempt"`
+    Outcome     string     `json:"outcome"`
+    StatusCode  int        `json:"status_code,omitempty"`
+    Error       string     `json:"error,omitempty"`
+    DurationMS  float64    `json:"duration_ms"`
+    AttemptedAt time.Time  `json:"attempted_at"`
+    NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+}
+
+//DeadLetter - доставка, от которой отказались: ретраи кончились или ответ не исправить повтором
+type DeadLetter struct {
+    DeliveryID string          `json:"delivery_id"`
+    EventID    string          `json:"event_id"`
+    Event      string          `json:"event"`
+    Attempts   int             `json:"attempts"`
+    StatusCode int             `json:"status_code,omitempty"`
+    LastError  string          `json:"last_error"`
+    FailedAt   time.Time       `json:"failed_at"`
+    Payload    json.RawMessage `json:"payload"`
+}
+
+//Payload - тело POST-запроса на URL подписки
+type Payload struct {
+    ID         string       `json:"id"`
+    Event      string       `json:"event"`
+    OccurredAt time.Time    `json:"occurred_at"`
+    Task       models.Task  `json:"task"`
+    Previous   *models.Task `json:"previous,omitempty"`
+}
+
+//Sign считает подпись заголовка X-Webhook-Signature: "t=<unix>,v1=<hex>".
+//Подписывается "<timestamp>.<body>", чтобы старую доставку нельзя было
+//переиграть с новой меткой времени.
+func Sign(secret string, timestamp int64, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+    mac.Write([]byte("."))
+    mac.Write(body)
+    return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+//eventsFor переводит изменение хранилища в типы вебхуков. task.completed
+//приходит дополнительно, когда задача переходит в done.
+func eventsFor(change models.TaskChange) []string {
+    var events []string
+    switch change.Type {
+    case models.TaskCreated:
+        events = append(events, EventTaskCreated)
+    case models.TaskUpdated:
+        events = append(events, EventTaskUpdated)
+    case models.TaskDeleted:
+        return []string{EventTaskDeleted}
+    }
+    if change.Task.Done && (change.Previous == nil || !change.Previous.Done) {
+        events = append(events, EventTaskCompleted)
+    }
+    return events
+}
+
+//ValidateURL допускает только абсолютные http(s) адреса без логина в URL
+func ValidateURL(raw string) error {
+    u, err := url.Parse(raw)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return fmt.Errorf("expected absolute http(s) URL")
+    }
+    if u.User != nil {
+        return fmt.Errorf("credentials in URL are not allowed, sign requests with the secret instead")
+    }
+    return nil
+}
+
+//normalizeEvents убирает дубли и сортирует, "*" поглощает остальные
+func normalizeEvents(events []string) []string {
+    seen := make(map[string]bool, len(events))
+    out := make([]string, 0, len(events))
+    for _, e := range events {
+        if e == EventAll {
+            return []string{EventAll}
+        }
+        if !seen[e] {
+            seen[e] = true
+            out = append(out, e)
+        }
+    }
+    sort.Strings(out)
+    return out
+}
+
+func generateSecret() (string, error) {
+    buf := make([]byte, 32)
+    if _, err := rand.Read(buf); err != nil {
+        return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+    }
+    return "whsec_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func generateID(prefix string) (string, error) {
+    buf := make([]byte, 8)
+    if _, err := rand.Read(buf); err != nil {
+        return "", fmt.Errorf("failed to generate id: %w", err)
+    }
+    return prefix + hex.EncodeToString(buf), nil
+}
+
+func sortSubscriptions(subs []Subscription) {
+    sort.Slice(subs, func(i, j int) bool {
+        return subs[i].CreatedAt.Before(subs[j].CreatedAt) ||
+            subs[i].CreatedAt.Equal(subs[j].CreatedAt) && subs[i].ID < subs[j].ID
+    })
+}